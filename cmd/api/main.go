@@ -10,8 +10,12 @@ import (
 	"syscall"
 
 	"github.com/aykhans/bsky-feedgen/pkg/api"
+	"github.com/aykhans/bsky-feedgen/pkg/api/handler"
 	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"github.com/aykhans/bsky-feedgen/pkg/didresolver"
 	"github.com/aykhans/bsky-feedgen/pkg/feed"
+	"github.com/aykhans/bsky-feedgen/pkg/generator"
+	_ "github.com/aykhans/bsky-feedgen/pkg/generator/all"
 	"github.com/aykhans/bsky-feedgen/pkg/logger"
 	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb"
 	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
@@ -51,17 +55,114 @@ func main() {
 		os.Exit(1)
 	}
 
-	feedAzCollection, err := collections.NewFeedAzCollection(client)
+	feedRankedCollection, err := collections.NewFeedRankedCollection(client)
 	if err != nil {
 		logger.Log.Error(err.Error())
 		os.Exit(1)
 	}
 
-	feeds := []feed.Feed{
-		feed.NewFeedAz("AzPulse", apiConfig.FeedgenPublisherDID, feedAzCollection),
+	feedAuthorCollection, err := collections.NewFeedAuthorCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	feedModerationCollection, err := collections.NewFeedModerationCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	blockCollection, err := collections.NewBlockCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	viewerMuteCollection, err := collections.NewViewerMuteCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	viewerFilter := feed.NewViewerFilter(blockCollection, viewerMuteCollection)
+	viewerHandler := handler.NewViewerHandler(viewerMuteCollection)
+
+	feeds := make([]feed.Feed, 0, len(apiConfig.Feeds))
+	generators := make([]generator.Generator, 0, len(apiConfig.Feeds))
+	adminFeeds := make([]*handler.AdminFeed, 0, len(apiConfig.Feeds))
+	for _, feedConfig := range apiConfig.Feeds {
+		gen, err := generator.New(feedConfig, feedAuthorCollection)
+		if err != nil {
+			logger.Log.Error("generator error", "generator", feedConfig.GeneratorName, "error", err)
+			os.Exit(1)
+		}
+		generators = append(generators, gen)
+
+		feedCollection, err := collections.NewFeedCollection(client, gen.Name())
+		if err != nil {
+			logger.Log.Error(err.Error())
+			os.Exit(1)
+		}
+
+		feeds = append(feeds, feed.NewGeneratedFeed(
+			gen.FeedName(),
+			apiConfig.FeedgenPublisherDID,
+			feedConfig.Ranking.Algorithm,
+			feedCollection,
+			feedRankedCollection,
+			feedModerationCollection,
+			feedConfig.Diversity.AuthorMaxConsecutive,
+			viewerFilter,
+		))
+		adminFeeds = append(adminFeeds, &handler.AdminFeed{Generator: gen, FeedCollection: feedCollection})
+	}
+
+	var adminHandler *handler.AdminHandler
+	if apiConfig.IsAdminEnabled() {
+		postCollection, err := collections.NewPostCollection(client)
+		if err != nil {
+			logger.Log.Error(err.Error())
+			os.Exit(1)
+		}
+
+		feedgenTaskCollection, err := collections.NewFeedgenTaskCollection(client)
+		if err != nil {
+			logger.Log.Error(err.Error())
+			os.Exit(1)
+		}
+
+		generatorStatCollection, err := collections.NewGeneratorStatCollection(client)
+		if err != nil {
+			logger.Log.Error(err.Error())
+			os.Exit(1)
+		}
+
+		duplicateClusterCollection, err := collections.NewDuplicateClusterCollection(client)
+		if err != nil {
+			logger.Log.Error(err.Error())
+			os.Exit(1)
+		}
+
+		adminHandler = handler.NewAdminHandler(
+			adminFeeds,
+			postCollection,
+			feedAuthorCollection,
+			feedModerationCollection,
+			feedRankedCollection,
+			feedgenTaskCollection,
+			generatorStatCollection,
+			duplicateClusterCollection,
+		)
+	}
+
+	didResolver, err := didresolver.NewDirectory(apiConfig.DIDResolver)
+	if err != nil {
+		logger.Log.Error("Failed to create DID resolver", "error", err)
+		os.Exit(1)
 	}
 
-	if err := api.Run(ctx, apiConfig, feeds); err != nil {
+	if err := api.Run(ctx, apiConfig, didResolver, feeds, generators, viewerHandler, adminHandler); err != nil {
 		logger.Log.Error("API error", "error", err)
 	}
 }
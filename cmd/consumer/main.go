@@ -8,9 +8,12 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/aykhans/bsky-feedgen/pkg/consumer"
+	"github.com/aykhans/bsky-feedgen/pkg/generator"
+	_ "github.com/aykhans/bsky-feedgen/pkg/generator/all"
 	"github.com/aykhans/bsky-feedgen/pkg/types"
 
 	"github.com/aykhans/bsky-feedgen/pkg/config"
@@ -21,8 +24,12 @@ import (
 )
 
 type flags struct {
-	version      bool
-	cursorOption types.ConsumerCursor
+	version        bool
+	status         bool
+	cursorOption   types.ConsumerCursor
+	recordPath     string
+	replayPath     string
+	replayRealTime bool
 }
 
 func main() {
@@ -37,13 +44,12 @@ func main() {
 	}
 
 	if flags.cursorOption == "" {
-		_ = flags.cursorOption.Set("")
-	}
-
-	consumerConfig, errMap := config.NewConsumerConfig()
-	if errMap != nil {
-		logger.Log.Error("consumer ENV error", "error", errMap.ToStringMap())
-		os.Exit(1)
+		if flags.replayPath != "" {
+			// Replays are expected to be deterministic, so they start from the beginning by default
+			flags.cursorOption = types.ConsumerCursorFirstStream
+		} else {
+			_ = flags.cursorOption.Set("")
+		}
 	}
 
 	mongoDBConfig, errMap := config.NewMongoDBConfig()
@@ -58,19 +64,178 @@ func main() {
 		os.Exit(1)
 	}
 
+	consumerCheckpointCollection, err := collections.NewConsumerCheckpointCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if flags.status {
+		if err := printStatus(ctx, consumerCheckpointCollection); err != nil {
+			logger.Log.Error("consumer status error", "error", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	consumerConfig, errMap := config.NewConsumerConfig()
+	if errMap != nil {
+		logger.Log.Error("consumer ENV error", "error", errMap.ToStringMap())
+		os.Exit(1)
+	}
+
 	postCollection, err := collections.NewPostCollection(client)
 	if err != nil {
 		logger.Log.Error(err.Error())
 		os.Exit(1)
 	}
 
-	startCrons(ctx, consumerConfig, postCollection)
+	postTombstoneCollection, err := collections.NewPostTombstoneCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	accountCollection, err := collections.NewAccountCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	engagementCollection, err := collections.NewEngagementCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	engagementRecordCollection, err := collections.NewEngagementRecordCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	blockCollection, err := collections.NewBlockCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Deletions and account status changes are applied to the feeds of all registered generators,
+	// so the consumer doesn't depend on which generators are enabled.
+	var feedCollections []consumer.FeedCollection
+	for _, generatorName := range generator.Names() {
+		feedCollection, err := collections.NewFeedCollection(client, generatorName)
+		if err != nil {
+			logger.Log.Error(err.Error())
+			os.Exit(1)
+		}
+		feedCollections = append(feedCollections, feedCollection)
+	}
+
+	feedRankedCollection, err := collections.NewFeedRankedCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+	feedCollections = append(feedCollections, feedRankedCollection)
+
+	// Pinned posts are shown regardless of the generators, so they follow deletions too
+	feedModerationCollection, err := collections.NewFeedModerationCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+	feedCollections = append(feedCollections, feedModerationCollection)
+
+	var source consumer.Source
+	if flags.replayPath != "" {
+		source = consumer.NewReplaySource(flags.replayPath, flags.replayRealTime)
+	} else {
+		var recorder *consumer.Recorder
+		if flags.recordPath != "" {
+			if !consumerConfig.Source.IsFirehose() {
+				logger.Log.Error("recording is only supported for the firehose source")
+				os.Exit(1)
+			}
+			recorder, err = consumer.NewRecorder(flags.recordPath)
+			if err != nil {
+				logger.Log.Error(err.Error())
+				os.Exit(1)
+			}
+			defer func() {
+				if err := recorder.Close(); err != nil {
+					logger.Log.Error("recording close error", "error", err)
+				}
+			}()
+		}
+
+		var sources []consumer.Source
+		switch consumerConfig.Source {
+		case types.ConsumerSourceFirehose:
+			for _, relayHost := range consumerConfig.RelayHosts {
+				sources = append(sources, consumer.NewFirehoseSource(relayHost, recorder))
+			}
+		case types.ConsumerSourceJetstream:
+			var zstdDictionary []byte
+			if consumerConfig.JetstreamZstdDictionaryPath != "" {
+				zstdDictionary, err = os.ReadFile(consumerConfig.JetstreamZstdDictionaryPath)
+				if err != nil {
+					logger.Log.Error("jetstream zstd dictionary read error", "error", err)
+					os.Exit(1)
+				}
+			}
+			for _, jetstreamHost := range consumerConfig.JetstreamHosts {
+				sources = append(sources, consumer.NewJetstreamSource(jetstreamHost, zstdDictionary))
+			}
+		}
+
+		relayPool, err := consumer.NewRelayPool(
+			sources,
+			consumerConfig.SourceStallTimeout,
+			consumerCheckpointCollection.GetCursor,
+		)
+		if err != nil {
+			logger.Log.Error(err.Error())
+			os.Exit(1)
+		}
+		source = relayPool
+
+		// Relay pool status
+		go func() {
+			for {
+				time.Sleep(time.Minute)
+				logger.Log.Info(
+					"Consumer source status",
+					"source", relayPool.Name(),
+					"activeFor", time.Since(relayPool.ActiveSince()).Round(time.Second),
+					"failovers", relayPool.Failovers(),
+				)
+			}
+		}()
+	}
+
+	startCrons(
+		ctx,
+		consumerConfig,
+		postCollection,
+		postTombstoneCollection,
+		accountCollection,
+		engagementCollection,
+		engagementRecordCollection,
+	)
 	logger.Log.Info("Cron jobs started")
 
 	err = consumer.ConsumeAndSaveToMongoDB(
 		ctx,
 		postCollection,
-		"wss://bsky.network",
+		postTombstoneCollection,
+		accountCollection,
+		engagementCollection,
+		engagementRecordCollection,
+		blockCollection,
+		consumerCheckpointCollection,
+		feedCollections,
+		source,
 		flags.cursorOption,
 		consumerConfig.PostMaxDate, // Save only posts created before PostMaxDate
 		10*time.Second,             // Save consumed data to MongoDB every 10 seconds
@@ -80,7 +245,15 @@ func main() {
 	}
 }
 
-func startCrons(ctx context.Context, consumerConfig *config.ConsumerConfig, postCollection *collections.PostCollection) {
+func startCrons(
+	ctx context.Context,
+	consumerConfig *config.ConsumerConfig,
+	postCollection *collections.PostCollection,
+	postTombstoneCollection *collections.PostTombstoneCollection,
+	accountCollection *collections.AccountCollection,
+	engagementCollection *collections.EngagementCollection,
+	engagementRecordCollection *collections.EngagementRecordCollection,
+) {
 	// Post collection cutoff
 	go func() {
 		for {
@@ -95,6 +268,91 @@ func startCrons(ctx context.Context, consumerConfig *config.ConsumerConfig, post
 			time.Sleep(consumerConfig.PostCollectionCutoffCronDelay)
 		}
 	}()
+
+	// Post tombstone collection cutoff
+	// Posts older than PostMaxDate are never stored, so their tombstones are not needed either.
+	go func() {
+		for {
+			startTime := time.Now()
+			deleteCount, err := postTombstoneCollection.CutoffByDate(ctx, time.Now().UTC().Add(-consumerConfig.PostMaxDate))
+			if err != nil {
+				logger.Log.Error("Post tombstone collection cutoff cron error", "error", err)
+			}
+			elapsedTime := time.Since(startTime)
+			logger.Log.Info("Post tombstone collection cutoff cron completed", "count", deleteCount, "time", elapsedTime)
+
+			time.Sleep(consumerConfig.PostCollectionCutoffCronDelay)
+		}
+	}()
+
+	// Account collection cutoff
+	// Statuses that haven't changed within PostMaxDate can't affect any stored post anymore.
+	go func() {
+		for {
+			startTime := time.Now()
+			deleteCount, err := accountCollection.CutoffByDate(ctx, time.Now().UTC().Add(-consumerConfig.PostMaxDate))
+			if err != nil {
+				logger.Log.Error("Account collection cutoff cron error", "error", err)
+			}
+			elapsedTime := time.Since(startTime)
+			logger.Log.Info("Account collection cutoff cron completed", "count", deleteCount, "time", elapsedTime)
+
+			time.Sleep(consumerConfig.PostCollectionCutoffCronDelay)
+		}
+	}()
+
+	// Engagement collection cutoff
+	// The counters of posts older than PostMaxDate and the records counted in them are no longer needed.
+	go func() {
+		for {
+			startTime := time.Now()
+			before := time.Now().UTC().Add(-consumerConfig.PostMaxDate)
+			deleteCount, err := engagementCollection.CutoffByDate(ctx, before)
+			if err != nil {
+				logger.Log.Error("Engagement collection cutoff cron error", "error", err)
+			}
+			recordDeleteCount, err := engagementRecordCollection.CutoffByDate(ctx, before)
+			if err != nil {
+				logger.Log.Error("Engagement record collection cutoff cron error", "error", err)
+			}
+			elapsedTime := time.Since(startTime)
+			logger.Log.Info(
+				"Engagement collection cutoff cron completed",
+				"count", deleteCount,
+				"recordCount", recordDeleteCount,
+				"time", elapsedTime,
+			)
+
+			time.Sleep(consumerConfig.PostCollectionCutoffCronDelay)
+		}
+	}()
+}
+
+func printStatus(ctx context.Context, consumerCheckpointCollection *collections.ConsumerCheckpointCollection) error {
+	checkpoints, err := consumerCheckpointCollection.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(checkpoints) == 0 {
+		fmt.Println("No consumer checkpoints found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "SOURCE\tCURSOR\tUPDATED AT\tAGE")
+	for _, checkpoint := range checkpoints {
+		_, _ = fmt.Fprintf(
+			w,
+			"%s\t%d\t%s\t%s\n",
+			checkpoint.ID,
+			checkpoint.Cursor,
+			checkpoint.UpdatedAt.Format(time.RFC3339),
+			time.Since(checkpoint.UpdatedAt).Round(time.Second),
+		)
+	}
+
+	return w.Flush()
 }
 
 func listenForTermination(do func()) {
@@ -112,22 +370,35 @@ func getFlags() *flags {
 			`Usage:
 
 consumer [flags]
+consumer status    Print the last consumed cursor of every source
 
 Flags:
     -version         version information
     -h, -help        Display this help message
     -cursor string   Specify the starting point for data consumption (default: last-consumed)
         Options:
-       	    last-consumed: Resume from the last processed data in storage
+       	    last-consumed: Resume from the checkpoint of the last processed data
        	    first-stream: Start from the beginning of the firehose
-       	    current-stream: Start from the current position in the firehose stream`)
+       	    current-stream: Start from the current position in the firehose stream
+    -record string   Write the received firehose events to the given gzip compressed file
+    -replay string   Consume the events of a recording file instead of the relays (default cursor: first-stream)
+    -replay-realtime Replay with the recorded delays instead of as fast as possible`)
 	}
 
 	flag.BoolVar(&flags.version, "version", false, "print version information")
 	flag.Var(&flags.cursorOption, "cursor", "Specify the starting point for data consumption")
+	flag.StringVar(&flags.recordPath, "record", "", "Write the received firehose commits to the given file")
+	flag.StringVar(&flags.replayPath, "replay", "", "Consume the commits of a recording file")
+	flag.BoolVar(&flags.replayRealTime, "replay-realtime", false, "Replay with the recorded delays")
 	flag.Parse()
 
-	if args := flag.Args(); len(args) > 0 {
+	args := flag.Args()
+	if len(args) == 1 && args[0] == "status" {
+		flags.status = true
+		args = nil
+	}
+
+	if len(args) > 0 {
 		if len(args) == 1 {
 			fmt.Printf("unexpected argument: %s\n\n", args[0])
 		} else {
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"github.com/aykhans/bsky-feedgen/pkg/generator"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+	"github.com/aykhans/bsky-feedgen/pkg/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type explainFlags struct {
+	generator string
+	uri       string
+}
+
+func parseExplainFlags(args []string) *explainFlags {
+	flags := &explainFlags{}
+	flagSet := flag.NewFlagSet("explain", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Println(
+			`Usage:
+
+feedgen explain [flags] <post AT-URI>
+
+Evaluates a stored post with the current rules of a generator and prints the decision with every
+evaluated rule, and whether the post is currently in the feed.
+
+Flags:
+    -h, -help          Display this help message
+    -generator string  Generator to explain (default: the only generator in FEEDGEN_GENERATORS)`)
+	}
+
+	flagSet.StringVar(&flags.generator, "generator", "", "Generator to explain")
+	_ = flagSet.Parse(args)
+
+	if flagSet.NArg() != 1 {
+		fmt.Printf("expected a single post AT-URI\n\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+	flags.uri = flagSet.Arg(0)
+
+	return flags
+}
+
+func explain(
+	ctx context.Context,
+	flags *explainFlags,
+	feedGenConfig *config.FeedGenConfig,
+	client *mongo.Client,
+	postCollection *collections.PostCollection,
+	feedAuthorCollection *collections.FeedAuthorCollection,
+	feedModerationCollection *collections.FeedModerationCollection,
+) error {
+	did, recordKey, err := utils.ParsePostURI(flags.uri)
+	if err != nil {
+		return err
+	}
+
+	generatorConfig, err := getGeneratorConfig(feedGenConfig, flags.generator)
+	if err != nil {
+		return err
+	}
+
+	gen, err := generator.New(generatorConfig.FeedConfig, feedAuthorCollection)
+	if err != nil {
+		return err
+	}
+
+	feedCollection, err := collections.NewFeedCollection(client, gen.Name())
+	if err != nil {
+		return err
+	}
+
+	explanation, err := generator.ExplainPost(
+		ctx,
+		gen,
+		postCollection,
+		feedCollection,
+		feedModerationCollection,
+		did+"/"+recordKey,
+	)
+	if err != nil {
+		if errors.Is(err, types.ErrNotfound) {
+			return errors.New("post not found, it may be older than the stored posts or deleted")
+		}
+		return err
+	}
+
+	printExplanation(gen, explanation)
+	return nil
+}
+
+func printExplanation(gen generator.Generator, explanation *generator.PostExplanation) {
+	post := explanation.Post
+
+	detectedLang := "-"
+	if post.DetectedLang != "" {
+		detectedLang = fmt.Sprintf("%s (confidence %.2f)", post.DetectedLang, post.DetectedLangConfidence)
+	}
+	moderation := "-"
+	if explanation.Moderation != nil {
+		moderation = fmt.Sprintf("%s by %s", explanation.Moderation.Action, explanation.Moderation.AddedBy)
+		if explanation.Moderation.Reason != "" {
+			moderation += ": " + explanation.Moderation.Reason
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintf(w, "Generator:\t%s (feed %s)\n", gen.Name(), gen.FeedName())
+	_, _ = fmt.Fprintf(w, "Post:\t%s\n", post.ID)
+	_, _ = fmt.Fprintf(w, "Created at:\t%s\n", post.CreatedAt.Format(time.RFC3339))
+	_, _ = fmt.Fprintf(w, "Languages:\t%s\n", strings.Join(post.Langs, ", "))
+	_, _ = fmt.Fprintf(w, "Detected language:\t%s\n", detectedLang)
+	_, _ = fmt.Fprintf(w, "Text:\t%s\n", truncateText(post.Text))
+	_, _ = fmt.Fprintf(w, "Hidden:\t%t\n", post.Hidden)
+	_, _ = fmt.Fprintf(w, "Selected:\t%t\n", explanation.Selected)
+	_, _ = fmt.Fprintf(w, "In feed:\t%t\n", explanation.InFeed)
+	_, _ = fmt.Fprintf(w, "Moderation:\t%s\n", moderation)
+	_ = w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "RULE\tPASSED\tDETAIL")
+	for _, step := range explanation.Steps {
+		_, _ = fmt.Fprintf(w, "%s\t%t\t%s\n", step.Rule, step.Passed, step.Detail)
+	}
+	_ = w.Flush()
+}
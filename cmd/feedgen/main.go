@@ -0,0 +1,539 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/dedup"
+	"github.com/aykhans/bsky-feedgen/pkg/generator"
+	_ "github.com/aykhans/bsky-feedgen/pkg/generator/all"
+	"github.com/aykhans/bsky-feedgen/pkg/ranking"
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"github.com/aykhans/bsky-feedgen/pkg/logger"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	_ "go.uber.org/automaxprocs"
+)
+
+type flags struct {
+	version      bool
+	cursorOption types.GeneratorCursor
+	reclassify   *reclassifyFlags
+	explain      *explainFlags
+}
+
+// statCutoffCronDelay is the interval of deleting old generator stats, tasks and duplicate clusters.
+const statCutoffCronDelay = time.Hour
+
+// feedGenerator is a running generator with its configuration and feed collection.
+type feedGenerator struct {
+	gen            generator.Generator
+	config         *config.GeneratorConfig
+	feedCollection *collections.FeedCollection
+}
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go listenForTermination(func() { cancel() })
+
+	flags := getFlags()
+	if flags.version == true {
+		fmt.Printf("Feedgen version: %v\n", version)
+		os.Exit(0)
+	}
+
+	if flags.cursorOption == "" {
+		_ = flags.cursorOption.Set("")
+	}
+
+	feedGenConfig, errMap := config.NewFeedGenConfig()
+	if errMap != nil {
+		logger.Log.Error("feedgen ENV error", "error", errMap.ToStringMap())
+		os.Exit(1)
+	}
+
+	mongoDBConfig, errMap := config.NewMongoDBConfig()
+	if errMap != nil {
+		logger.Log.Error("mongodb ENV error", "error", errMap.ToStringMap())
+		os.Exit(1)
+	}
+
+	client, err := mongodb.NewDB(ctx, mongoDBConfig)
+	if err != nil {
+		logger.Log.Error("mongodb connection error", "error", err)
+		os.Exit(1)
+	}
+
+	postCollection, err := collections.NewPostCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	postTombstoneCollection, err := collections.NewPostTombstoneCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	engagementCollection, err := collections.NewEngagementCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	feedRankedCollection, err := collections.NewFeedRankedCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	feedAuthorCollection, err := collections.NewFeedAuthorCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	feedModerationCollection, err := collections.NewFeedModerationCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	feedgenTaskCollection, err := collections.NewFeedgenTaskCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	generatorStatCollection, err := collections.NewGeneratorStatCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	changeStreamCheckpointCollection, err := collections.NewChangeStreamCheckpointCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	duplicateClusterCollection, err := collections.NewDuplicateClusterCollection(client)
+	if err != nil {
+		logger.Log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if flags.reclassify != nil {
+		err := reclassify(
+			ctx,
+			flags.reclassify,
+			feedGenConfig,
+			client,
+			postCollection,
+			postTombstoneCollection,
+			feedAuthorCollection,
+			feedModerationCollection,
+			feedRankedCollection,
+			generatorStatCollection,
+			duplicateClusterCollection,
+		)
+		if err != nil {
+			logger.Log.Error("feedgen reclassify error", "error", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if flags.explain != nil {
+		err := explain(
+			ctx,
+			flags.explain,
+			feedGenConfig,
+			client,
+			postCollection,
+			feedAuthorCollection,
+			feedModerationCollection,
+		)
+		if err != nil {
+			logger.Log.Error("feedgen explain error", "error", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	runner := generator.NewRunner(
+		postCollection,
+		postTombstoneCollection,
+		feedModerationCollection,
+		generatorStatCollection,
+		duplicateClusterCollection,
+	)
+	feedGenerators := make(map[string]*feedGenerator, len(feedGenConfig.Generators))
+	for _, generatorConfig := range feedGenConfig.Generators {
+		gen, err := generator.New(generatorConfig.FeedConfig, feedAuthorCollection)
+		if err != nil {
+			logger.Log.Error("generator error", "generator", generatorConfig.GeneratorName, "error", err)
+			os.Exit(1)
+		}
+
+		feedCollection, err := collections.NewFeedCollection(client, gen.Name())
+		if err != nil {
+			logger.Log.Error(err.Error())
+			os.Exit(1)
+		}
+
+		// The author lists are loaded before the first generation, so the feed never uses empty lists
+		seedCount, err := gen.Authors().Seed(ctx, gen.DefaultUsers(), "feedgen")
+		if err != nil {
+			logger.Log.Error("feed authors seed error", "generator", gen.Name(), "error", err)
+			os.Exit(1)
+		}
+		if seedCount > 0 {
+			logger.Log.Info("Feed authors seeded from the feed definition", "generator", gen.Name(), "count", seedCount)
+		}
+		if err := reloadAuthors(ctx, gen, feedCollection); err != nil {
+			logger.Log.Error("feed authors load error", "generator", gen.Name(), "error", err)
+			os.Exit(1)
+		}
+
+		feedGen := &feedGenerator{gen: gen, config: generatorConfig, feedCollection: feedCollection}
+		feedGenerators[gen.Name()] = feedGen
+
+		var duplicates *dedup.Tracker
+		if !generatorConfig.Duplicates.Action.IsOff() {
+			duplicates = dedup.NewTracker(generatorConfig.Duplicates)
+		}
+		runner.Add(
+			gen,
+			feedCollection,
+			generatorConfig.BatchSize,
+			generatorConfig.GeneratorCronDelay,
+			duplicates,
+			generatorConfig.Diversity,
+		)
+		startCutoffCron(ctx, feedGen, generatorStatCollection)
+		startAuthorsCron(ctx, gen, generatorConfig, feedCollection)
+
+		// Chronological feeds are served directly from their feed collection, other rankings are materialized
+		if !generatorConfig.Ranking.Algorithm.IsLatest() {
+			ranker, err := ranking.New(generatorConfig.Ranking)
+			if err != nil {
+				logger.Log.Error(err.Error())
+				os.Exit(1)
+			}
+
+			materializer := ranking.NewMaterializer(
+				gen.FeedName(),
+				feedCollection,
+				engagementCollection,
+				feedRankedCollection,
+				ranker,
+				generatorConfig.Ranking.Window,
+				generatorConfig.Ranking.MaxItems,
+			)
+			startRankingCron(ctx, gen, generatorConfig.Ranking, materializer)
+		}
+	}
+
+	if feedGenConfig.Mode.IsStream() {
+		go runner.Stream(ctx, flags.cursorOption, changeStreamCheckpointCollection, feedGenConfig.StreamFlushDelay)
+	} else {
+		go runner.Run(ctx, flags.cursorOption)
+	}
+	startTaskCron(
+		ctx,
+		runner,
+		feedGenerators,
+		feedgenTaskCollection,
+		generatorStatCollection,
+		feedGenConfig.TaskCronDelay,
+		flags.cursorOption,
+	)
+	startStatCutoffCron(
+		ctx,
+		generatorStatCollection,
+		feedgenTaskCollection,
+		duplicateClusterCollection,
+		feedGenConfig.StatMaxDate,
+	)
+	logger.Log.Info("Cron jobs started")
+
+	<-ctx.Done()
+}
+
+func startCutoffCron(
+	ctx context.Context,
+	feedGen *feedGenerator,
+	generatorStatCollection *collections.GeneratorStatCollection,
+) {
+	collectionName := collections.FeedCollectionName(feedGen.gen.Name())
+	go func() {
+		for {
+			startTime := time.Now()
+			deleteCount, err := runCutoff(ctx, feedGen, generatorStatCollection, "cron")
+			if err != nil {
+				logger.Log.Error(collectionName+" collection cutoff cron error", "error", err)
+			}
+			elapsedTime := time.Since(startTime)
+			logger.Log.Info(collectionName+" collection cutoff cron completed", "count", deleteCount, "time", elapsedTime)
+
+			time.Sleep(feedGen.config.CutoffCronDelay)
+		}
+	}()
+}
+
+// runCutoff deletes the oldest posts of the generator's feed collection above its max document count
+// and stores the stats of the run.
+func runCutoff(
+	ctx context.Context,
+	feedGen *feedGenerator,
+	generatorStatCollection *collections.GeneratorStatCollection,
+	trigger string,
+) (int64, error) {
+	startTime := time.Now()
+	deleteCount, err := feedGen.feedCollection.CutoffByCount(ctx, feedGen.config.CollectionMaxDocument)
+
+	stat := &collections.GeneratorStat{
+		Generator: feedGen.gen.Name(),
+		Type:      collections.FeedgenTaskTypeCutoff,
+		Trigger:   trigger,
+		StartedAt: startTime,
+		Duration:  time.Since(startTime),
+		Count:     deleteCount,
+	}
+	if err != nil {
+		stat.Error = err.Error()
+	}
+	if statErr := generatorStatCollection.Insert(ctx, stat); statErr != nil {
+		logger.Log.Error("failed to store generator stats", "error", statErr)
+	}
+
+	return deleteCount, err
+}
+
+// startTaskCron executes the generator runs and cutoffs requested with the admin API of the API service.
+func startTaskCron(
+	ctx context.Context,
+	runner *generator.Runner,
+	feedGenerators map[string]*feedGenerator,
+	feedgenTaskCollection *collections.FeedgenTaskCollection,
+	generatorStatCollection *collections.GeneratorStatCollection,
+	delay time.Duration,
+	cursorOption types.GeneratorCursor,
+) {
+	generatorNames := make([]string, 0, len(feedGenerators))
+	for name := range feedGenerators {
+		generatorNames = append(generatorNames, name)
+	}
+
+	go func() {
+		for {
+			for {
+				task, err := feedgenTaskCollection.ClaimPending(ctx, generatorNames...)
+				if err != nil {
+					logger.Log.Error("Feedgen task cron error", "error", err)
+					break
+				}
+				if task == nil {
+					break
+				}
+
+				startTime := time.Now()
+				var taskErr error
+				switch task.Type {
+				case collections.FeedgenTaskTypeGenerate:
+					taskErr = runner.RunNow(ctx, task.Generator, cursorOption)
+				case collections.FeedgenTaskTypeCutoff:
+					_, taskErr = runCutoff(ctx, feedGenerators[task.Generator], generatorStatCollection, "task")
+				default:
+					taskErr = fmt.Errorf("unknown task type: %s", task.Type)
+				}
+				if err := feedgenTaskCollection.Complete(ctx, task.ID, taskErr); err != nil {
+					logger.Log.Error("Feedgen task cron error", "error", err)
+				}
+				elapsedTime := time.Since(startTime)
+				logger.Log.Info(
+					"Feedgen task completed",
+					"generator", task.Generator,
+					"type", task.Type,
+					"requested_by", task.RequestedBy,
+					"error", taskErr,
+					"time", elapsedTime,
+				)
+			}
+
+			time.Sleep(delay)
+		}
+	}()
+}
+
+func startStatCutoffCron(
+	ctx context.Context,
+	generatorStatCollection *collections.GeneratorStatCollection,
+	feedgenTaskCollection *collections.FeedgenTaskCollection,
+	duplicateClusterCollection *collections.DuplicateClusterCollection,
+	maxDate time.Duration,
+) {
+	go func() {
+		for {
+			startTime := time.Now()
+			before := startTime.Add(-maxDate)
+			statCount, err := generatorStatCollection.CutoffByDate(ctx, before)
+			if err != nil {
+				logger.Log.Error("generator_stat collection cutoff cron error", "error", err)
+			}
+			taskCount, err := feedgenTaskCollection.CutoffByDate(ctx, before)
+			if err != nil {
+				logger.Log.Error("feedgen_task collection cutoff cron error", "error", err)
+			}
+			clusterCount, err := duplicateClusterCollection.CutoffByDate(ctx, before)
+			if err != nil {
+				logger.Log.Error("duplicate_cluster collection cutoff cron error", "error", err)
+			}
+			elapsedTime := time.Since(startTime)
+			logger.Log.Info(
+				"Generator stat cutoff cron completed",
+				"stat_count", statCount,
+				"task_count", taskCount,
+				"cluster_count", clusterCount,
+				"time", elapsedTime,
+			)
+
+			time.Sleep(statCutoffCronDelay)
+		}
+	}()
+}
+
+func startAuthorsCron(
+	ctx context.Context,
+	gen generator.Generator,
+	generatorConfig *config.GeneratorConfig,
+	feedCollection *collections.FeedCollection,
+) {
+	go func() {
+		for {
+			time.Sleep(generatorConfig.AuthorsReloadCronDelay)
+
+			startTime := time.Now()
+			if err := reloadAuthors(ctx, gen, feedCollection); err != nil {
+				logger.Log.Error("Feed authors reload cron error", "generator", gen.Name(), "error", err)
+			}
+			elapsedTime := time.Since(startTime)
+			logger.Log.Info("Feed authors reload cron completed", "generator", gen.Name(), "time", elapsedTime)
+		}
+	}()
+}
+
+// reloadAuthors reloads the author lists of the generator and removes the posts of newly denied authors from its feed.
+func reloadAuthors(ctx context.Context, gen generator.Generator, feedCollection *collections.FeedCollection) error {
+	denied, err := gen.Authors().Reload(ctx)
+	if err != nil {
+		return err
+	}
+	if len(denied) == 0 {
+		return nil
+	}
+
+	deleteCount, err := feedCollection.DeleteByDIDs(ctx, denied...)
+	if err != nil {
+		return err
+	}
+	logger.Log.Info("Removed posts of denied authors", "generator", gen.Name(), "authors", len(denied), "count", deleteCount)
+
+	return nil
+}
+
+func startRankingCron(
+	ctx context.Context,
+	gen generator.Generator,
+	rankingConfig *config.FeedRankingConfig,
+	materializer *ranking.Materializer,
+) {
+	go func() {
+		for {
+			startTime := time.Now()
+			count, err := materializer.Run(ctx)
+			if err != nil {
+				logger.Log.Error("Feed ranking cron error", "generator", gen.Name(), "error", err)
+			}
+			elapsedTime := time.Since(startTime)
+			logger.Log.Info(
+				"Feed ranking cron completed",
+				"generator", gen.Name(),
+				"ranking", rankingConfig.Algorithm,
+				"count", count,
+				"time", elapsedTime,
+			)
+
+			time.Sleep(rankingConfig.CronDelay)
+		}
+	}()
+}
+
+func listenForTermination(do func()) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+	do()
+}
+
+func getFlags() *flags {
+	flags := &flags{}
+
+	flag.Usage = func() {
+		fmt.Println(
+			`Usage:
+
+feedgen [flags]
+feedgen reclassify [flags]          Re-evaluate the stored posts with the current rules, see feedgen reclassify -h
+feedgen explain [flags] <post URI>  Explain why a post is or isn't in a feed, see feedgen explain -h
+
+Runs the generators listed in FEEDGEN_GENERATORS.
+
+Flags:
+    -version         version information
+    -h, -help        Display this help message
+    -cursor string   Specify the starting point for feed data generation (default: last-generated)
+        Options:
+       	    last-generated: Resume from the last generated data in storage
+       	    first-post: Start from the beginning of the posts`)
+	}
+
+	flag.BoolVar(&flags.version, "version", false, "print version information")
+	flag.Var(&flags.cursorOption, "cursor", "Specify the starting point for feed data generation")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) > 0 {
+		switch args[0] {
+		case "reclassify":
+			flags.reclassify = parseReclassifyFlags(args[1:])
+			args = nil
+		case "explain":
+			flags.explain = parseExplainFlags(args[1:])
+			args = nil
+		}
+	}
+
+	if len(args) > 0 {
+		if len(args) == 1 {
+			fmt.Printf("unexpected argument: %s\n\n", args[0])
+		} else {
+			fmt.Printf("unexpected arguments: %v\n\n", strings.Join(args, ", "))
+		}
+		flag.CommandLine.Usage()
+		os.Exit(1)
+	}
+
+	return flags
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"github.com/aykhans/bsky-feedgen/pkg/dedup"
+	"github.com/aykhans/bsky-feedgen/pkg/generator"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type reclassifyFlags struct {
+	generator string
+	since     time.Time
+	until     time.Time
+	samples   int
+	apply     bool
+}
+
+// sampleTextLength is the maximum number of characters of a printed sample post text.
+const sampleTextLength = 80
+
+func parseReclassifyFlags(args []string) *reclassifyFlags {
+	flags := &reclassifyFlags{}
+	flagSet := flag.NewFlagSet("reclassify", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Println(
+			`Usage:
+
+feedgen reclassify [flags]
+
+Re-evaluates the stored posts with the current rules of a generator and prints the posts that would be
+added to and removed from its feed. The feed is only changed with -apply.
+
+Flags:
+    -h, -help          Display this help message
+    -generator string  Generator to reclassify (default: the only generator in FEEDGEN_GENERATORS)
+    -since string      Only posts created at or after this time, RFC 3339 or a duration before now, e.g. 72h
+    -until string      Only posts created before this time, RFC 3339 or a duration before now
+    -samples int       Number of added and removed sample posts to print (default: 10)
+    -apply             Apply the changes to the feed`)
+	}
+
+	flagSet.StringVar(&flags.generator, "generator", "", "Generator to reclassify")
+	flagSet.Func("since", "Only posts created at or after this time", func(value string) (err error) {
+		flags.since, err = parseTime(value)
+		return err
+	})
+	flagSet.Func("until", "Only posts created before this time", func(value string) (err error) {
+		flags.until, err = parseTime(value)
+		return err
+	})
+	flagSet.IntVar(&flags.samples, "samples", 10, "Number of sample posts to print")
+	flagSet.BoolVar(&flags.apply, "apply", false, "Apply the changes to the feed")
+	_ = flagSet.Parse(args)
+
+	if args := flagSet.Args(); len(args) > 0 {
+		fmt.Printf("unexpected arguments: %v\n\n", strings.Join(args, ", "))
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	return flags
+}
+
+// parseTime parses an RFC 3339 time, or a duration that is subtracted from the current time.
+func parseTime(value string) (time.Time, error) {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("expected an RFC 3339 time or a duration")
+	}
+
+	return t, nil
+}
+
+func reclassify(
+	ctx context.Context,
+	flags *reclassifyFlags,
+	feedGenConfig *config.FeedGenConfig,
+	client *mongo.Client,
+	postCollection *collections.PostCollection,
+	postTombstoneCollection *collections.PostTombstoneCollection,
+	feedAuthorCollection *collections.FeedAuthorCollection,
+	feedModerationCollection *collections.FeedModerationCollection,
+	feedRankedCollection *collections.FeedRankedCollection,
+	generatorStatCollection *collections.GeneratorStatCollection,
+	duplicateClusterCollection *collections.DuplicateClusterCollection,
+) error {
+	generatorConfig, err := getGeneratorConfig(feedGenConfig, flags.generator)
+	if err != nil {
+		return err
+	}
+
+	gen, err := generator.New(generatorConfig.FeedConfig, feedAuthorCollection)
+	if err != nil {
+		return err
+	}
+
+	feedCollection, err := collections.NewFeedCollection(client, gen.Name())
+	if err != nil {
+		return err
+	}
+
+	// The stored author lists are used like in the running service, the feed isn't changed here
+	if _, err := gen.Authors().Seed(ctx, gen.DefaultUsers(), "feedgen"); err != nil {
+		return fmt.Errorf("feed authors seed error: %v", err)
+	}
+	if _, err := gen.Authors().Reload(ctx); err != nil {
+		return fmt.Errorf("feed authors load error: %v", err)
+	}
+
+	// The posts are selected and inserted like in the running service
+	runner := generator.NewRunner(
+		postCollection,
+		postTombstoneCollection,
+		feedModerationCollection,
+		generatorStatCollection,
+		duplicateClusterCollection,
+	)
+	var duplicates *dedup.Tracker
+	if !generatorConfig.Duplicates.Action.IsOff() {
+		duplicates = dedup.NewTracker(generatorConfig.Duplicates)
+	}
+	runner.Add(
+		gen,
+		feedCollection,
+		generatorConfig.BatchSize,
+		generatorConfig.GeneratorCronDelay,
+		duplicates,
+		generatorConfig.Diversity,
+	)
+
+	startTime := time.Now()
+	reclassification, err := runner.Reclassify(ctx, gen.Name(), flags.since, flags.until, flags.samples)
+	if err != nil {
+		return err
+	}
+
+	printReclassification(gen, flags, reclassification, time.Since(startTime))
+
+	if !flags.apply {
+		fmt.Println("\nDry run, run with -apply to change the feed")
+		return nil
+	}
+
+	insertCount, deleteCount, err := runner.ApplyReclassification(ctx, gen.Name(), reclassification, feedRankedCollection)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nApplied: %d posts added, %d posts removed\n", insertCount, deleteCount)
+
+	return nil
+}
+
+// getGeneratorConfig returns the configuration of the named generator, or of the only enabled generator if the name is empty.
+func getGeneratorConfig(feedGenConfig *config.FeedGenConfig, generatorName string) (*config.GeneratorConfig, error) {
+	if generatorName == "" {
+		if len(feedGenConfig.Generators) > 1 {
+			return nil, errors.New("-generator is required when more than one generator is enabled")
+		}
+		return feedGenConfig.Generators[0], nil
+	}
+
+	for _, generatorConfig := range feedGenConfig.Generators {
+		if generatorConfig.GeneratorName == generatorName {
+			return generatorConfig, nil
+		}
+	}
+
+	return nil, fmt.Errorf("generator %s is not in FEEDGEN_GENERATORS", generatorName)
+}
+
+func printReclassification(
+	gen generator.Generator,
+	flags *reclassifyFlags,
+	reclassification *generator.Reclassification,
+	elapsedTime time.Duration,
+) {
+	formatTime := func(t time.Time, zero string) string {
+		if t.IsZero() {
+			return zero
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintf(w, "Generator:\t%s (feed %s)\n", gen.Name(), gen.FeedName())
+	_, _ = fmt.Fprintf(w, "Range:\t%s - %s\n", formatTime(flags.since, "first post"), formatTime(flags.until, "now"))
+	_, _ = fmt.Fprintf(w, "Scanned posts:\t%d\t(%s)\n", reclassification.Scanned, elapsedTime.Round(time.Millisecond))
+	_, _ = fmt.Fprintf(w, "Kept:\t%d\n", reclassification.Kept)
+	_, _ = fmt.Fprintf(w, "Added:\t+%d\n", len(reclassification.Added))
+	_, _ = fmt.Fprintf(w, "Removed:\t-%d\n", len(reclassification.Removed))
+	_, _ = fmt.Fprintf(w, "Skipped (removed by admin):\t%d\n", reclassification.SkippedRemoved)
+	_, _ = fmt.Fprintf(w, "Skipped (near-duplicates):\t%d\n", reclassification.SkippedDuplicates)
+	_, _ = fmt.Fprintf(w, "Unchecked (post no longer stored):\t%d\n", reclassification.Unchecked)
+	_ = w.Flush()
+
+	printSamples("Added", len(reclassification.Added), reclassification.AddedSamples)
+	printSamples("Removed", len(reclassification.Removed), reclassification.RemovedSamples)
+}
+
+func printSamples(title string, count int, samples []*collections.Post) {
+	if len(samples) == 0 {
+		return
+	}
+
+	fmt.Printf("\n%s (%d of %d):\n", title, len(samples), count)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "CREATED AT\tID\tLANGS\tDETECTED\tTEXT")
+	for _, post := range samples {
+		detectedLang := "-"
+		if post.DetectedLang != "" {
+			detectedLang = fmt.Sprintf("%s %.2f", post.DetectedLang, post.DetectedLangConfidence)
+		}
+		_, _ = fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%s\n",
+			post.CreatedAt.Format(time.RFC3339),
+			post.ID,
+			strings.Join(post.Langs, ","),
+			detectedLang,
+			truncateText(post.Text),
+		)
+	}
+	_ = w.Flush()
+}
+
+// truncateText returns the text on a single line, shortened to sampleTextLength characters.
+func truncateText(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= sampleTextLength {
+		return text
+	}
+
+	return string([]rune(text)[:sampleTextLength-3]) + "..."
+}
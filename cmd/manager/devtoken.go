@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/manage"
+	atcrypto "github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/spf13/cobra"
+)
+
+func newDevTokenCmd() *cobra.Command {
+	var devTokenCmd = &cobra.Command{
+		Use:   "dev-token",
+		Short: "Create keys and service JWTs for testing the feed generator authentication locally",
+	}
+
+	var (
+		keyType   string
+		keyDID    string
+		keyHandle string
+		docPath   string
+	)
+	var keygenCmd = &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate a signing key and a DID document with its public key",
+		Run: func(cmd *cobra.Command, args []string) {
+			did, err := syntax.ParseDID(keyDID)
+			if err != nil {
+				fmt.Printf("Error: invalid DID: %v\n", err)
+				os.Exit(1)
+			}
+
+			key, err := manage.GenerateDevKey(keyType)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			doc, err := manage.NewDevDIDDocument(did, keyHandle, key)
+			if err != nil {
+				fmt.Printf("Error: failed to create DID document: %v\n", err)
+				os.Exit(1)
+			}
+			docJSON, err := json.MarshalIndent(doc, "", "  ")
+			if err != nil {
+				fmt.Printf("Error: failed to encode DID document: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("DID: %s\n", did)
+			fmt.Printf("Private key (keep it secret): %s\n", key.Multibase())
+			if docPath == "" {
+				fmt.Printf("DID document:\n%s\n", docJSON)
+				return
+			}
+			if err := os.WriteFile(docPath, append(docJSON, '\n'), 0o644); err != nil {
+				fmt.Printf("Error: failed to write DID document: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("DID document: %s\n", docPath)
+		},
+	}
+	keygenCmd.Flags().StringVar(&keyType, "type", manage.DevKeyTypeK256, "Key type, k256 (ES256K) or p256 (ES256)")
+	keygenCmd.Flags().StringVar(&keyDID, "did", "did:web:localhost", "DID of the DID document")
+	keygenCmd.Flags().StringVar(&keyHandle, "handle", "", "Optional handle of the DID document")
+	keygenCmd.Flags().StringVar(&docPath, "out", "", "File to write the DID document to (default: stdout)")
+
+	var (
+		privateKey    string
+		issuer        string
+		audience      string
+		lexiconMethod string
+		expiresIn     time.Duration
+	)
+	var mintCmd = &cobra.Command{
+		Use:   "mint",
+		Short: "Sign a service JWT",
+		Run: func(cmd *cobra.Command, args []string) {
+			if privateKey == "" {
+				privateKey = os.Getenv("DEV_TOKEN_KEY")
+			}
+			if privateKey == "" {
+				fmt.Println("Error: private key is required (--key or DEV_TOKEN_KEY)")
+				os.Exit(1)
+			}
+			key, err := atcrypto.ParsePrivateMultibase(privateKey)
+			if err != nil {
+				fmt.Printf("Error: invalid private key: %v\n", err)
+				os.Exit(1)
+			}
+
+			token, err := manage.MintServiceToken(key, issuer, audience, lexiconMethod, expiresIn)
+			if err != nil {
+				fmt.Printf("Error: failed to sign token: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Println(token)
+		},
+	}
+	mintCmd.Flags().StringVar(&privateKey, "key", "", "Multibase private key from keygen (default: DEV_TOKEN_KEY)")
+	mintCmd.Flags().StringVar(&issuer, "iss", "did:web:localhost", "Issuer DID, the DID of the key")
+	mintCmd.Flags().StringVar(&audience, "aud", "did:web:localhost", "Audience, the service DID of the feed generator")
+	mintCmd.Flags().StringVar(&lexiconMethod, "lxm", "app.bsky.feed.getFeedSkeleton", "Lexicon method of the token, empty for an unscoped token")
+	mintCmd.Flags().DurationVar(&expiresIn, "exp", time.Hour, "Lifetime of the token, negative for an expired token")
+
+	devTokenCmd.AddCommand(keygenCmd)
+	devTokenCmd.AddCommand(mintCmd)
+
+	return devTokenCmd
+}
@@ -200,6 +200,7 @@ func main() {
 	rootCmd.AddCommand(createCmd)
 	rootCmd.AddCommand(updateCmd)
 	rootCmd.AddCommand(deleteCmd)
+	rootCmd.AddCommand(newDevTokenCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
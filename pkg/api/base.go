@@ -10,22 +10,28 @@ import (
 	"github.com/aykhans/bsky-feedgen/pkg/api/middleware"
 	"github.com/aykhans/bsky-feedgen/pkg/config"
 	"github.com/aykhans/bsky-feedgen/pkg/feed"
+	"github.com/aykhans/bsky-feedgen/pkg/generator"
 	"github.com/aykhans/bsky-feedgen/pkg/logger"
+	"github.com/bluesky-social/indigo/atproto/identity"
 )
 
 func Run(
 	ctx context.Context,
 	apiConfig *config.APIConfig,
+	didResolver identity.Directory,
 	feeds []feed.Feed,
+	generators []generator.Generator,
+	viewerHandler *handler.ViewerHandler,
+	adminHandler *handler.AdminHandler, // nil if the admin API is disabled
 ) error {
 	baseHandler, err := handler.NewBaseHandler(apiConfig.FeedgenHostname, apiConfig.ServiceDID)
 	if err != nil {
 		return err
 	}
 	feedHandler := handler.NewFeedHandler(feeds, apiConfig.FeedgenPublisherDID)
-	generatorHandler := handler.NewGeneratorHandler()
+	generatorHandler := handler.NewGeneratorHandler(generators)
 
-	authMiddleware := middleware.NewAuth(apiConfig.ServiceDID)
+	authMiddleware := middleware.NewAuth(apiConfig.ServiceDID, didResolver, apiConfig.AuthMode, apiConfig.AuthClockSkew)
 
 	mux := http.NewServeMux()
 
@@ -39,6 +45,35 @@ func Run(
 	mux.HandleFunc("GET /{feed}/users/valid/", generatorHandler.GetValidUsers)
 	mux.HandleFunc("GET /{feed}/users/invalid/", generatorHandler.GetInvalidUsers)
 
+	viewerRoutes := map[string]http.HandlerFunc{
+		"GET /viewer/mute-lists":           viewerHandler.GetMuteLists,
+		"PUT /viewer/mute-lists/{list}":    viewerHandler.PutMuteList,
+		"DELETE /viewer/mute-lists/{list}": viewerHandler.DeleteMuteList,
+	}
+	for pattern, handlerFunc := range viewerRoutes {
+		mux.Handle(pattern, authMiddleware.RequireJWTAuthMiddleware(handlerFunc))
+	}
+
+	if adminHandler != nil {
+		adminAuth := middleware.NewAdminAuth(authMiddleware, apiConfig.AdminToken, apiConfig.AdminDIDs)
+		adminRoutes := map[string]http.HandlerFunc{
+			"GET /admin/feeds/{feed}/moderation":       adminHandler.GetModeration,
+			"POST /admin/feeds/{feed}/posts/remove":    adminHandler.RemovePost,
+			"POST /admin/feeds/{feed}/posts/restore":   adminHandler.RestorePost,
+			"POST /admin/feeds/{feed}/posts/pin":       adminHandler.PinPost,
+			"POST /admin/feeds/{feed}/posts/unpin":     adminHandler.UnpinPost,
+			"PUT /admin/feeds/{feed}/authors/{did}":    adminHandler.PutAuthor,
+			"DELETE /admin/feeds/{feed}/authors/{did}": adminHandler.DeleteAuthor,
+			"POST /admin/feeds/{feed}/tasks":           adminHandler.CreateTask,
+			"GET /admin/feeds/{feed}/stats":            adminHandler.GetStats,
+			"GET /admin/feeds/{feed}/explain":          adminHandler.ExplainPost,
+			"GET /admin/feeds/{feed}/duplicates":       adminHandler.GetDuplicates,
+		}
+		for pattern, handlerFunc := range adminRoutes {
+			mux.Handle(pattern, adminAuth.AdminAuthMiddleware(handlerFunc))
+		}
+	}
+
 	httpServer := &http.Server{
 		Addr:    fmt.Sprintf(":%d", apiConfig.APIPort),
 		Handler: mux,
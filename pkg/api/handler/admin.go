@@ -0,0 +1,559 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/api/middleware"
+	"github.com/aykhans/bsky-feedgen/pkg/api/response"
+	"github.com/aykhans/bsky-feedgen/pkg/generator"
+	"github.com/aykhans/bsky-feedgen/pkg/logger"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+	"github.com/aykhans/bsky-feedgen/pkg/utils"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// AdminFeed is a feed managed by the admin API.
+type AdminFeed struct {
+	Generator      generator.Generator
+	FeedCollection *collections.FeedCollection
+}
+
+type AdminHandler struct {
+	feeds                      map[string]*AdminFeed
+	postCollection             *collections.PostCollection
+	feedAuthorCollection       *collections.FeedAuthorCollection
+	feedModerationCollection   *collections.FeedModerationCollection
+	feedRankedCollection       *collections.FeedRankedCollection
+	feedgenTaskCollection      *collections.FeedgenTaskCollection
+	generatorStatCollection    *collections.GeneratorStatCollection
+	duplicateClusterCollection *collections.DuplicateClusterCollection
+}
+
+func NewAdminHandler(
+	feeds []*AdminFeed,
+	postCollection *collections.PostCollection,
+	feedAuthorCollection *collections.FeedAuthorCollection,
+	feedModerationCollection *collections.FeedModerationCollection,
+	feedRankedCollection *collections.FeedRankedCollection,
+	feedgenTaskCollection *collections.FeedgenTaskCollection,
+	generatorStatCollection *collections.GeneratorStatCollection,
+	duplicateClusterCollection *collections.DuplicateClusterCollection,
+) *AdminHandler {
+	feedsMap := make(map[string]*AdminFeed, len(feeds))
+	for _, feed := range feeds {
+		feedsMap[feed.Generator.FeedName()] = feed
+	}
+
+	return &AdminHandler{
+		feeds:                      feedsMap,
+		postCollection:             postCollection,
+		feedAuthorCollection:       feedAuthorCollection,
+		feedModerationCollection:   feedModerationCollection,
+		feedRankedCollection:       feedRankedCollection,
+		feedgenTaskCollection:      feedgenTaskCollection,
+		generatorStatCollection:    generatorStatCollection,
+		duplicateClusterCollection: duplicateClusterCollection,
+	}
+}
+
+type adminPostRequest struct {
+	URI    string `json:"uri"`
+	Reason string `json:"reason"`
+}
+
+type adminAuthorRequest struct {
+	Allowed *bool  `json:"allowed"`
+	Reason  string `json:"reason"`
+}
+
+type adminTaskRequest struct {
+	Type collections.FeedgenTaskType `json:"type"`
+}
+
+// RemovePost removes a post from the feed. The generator doesn't add it to the feed again until it is restored.
+func (handler *AdminHandler) RemovePost(w http.ResponseWriter, r *http.Request) {
+	handler.moderatePost(w, r, collections.FeedModerationActionRemoved)
+}
+
+// PinPost shows a post at the top of the first page of the feed.
+func (handler *AdminHandler) PinPost(w http.ResponseWriter, r *http.Request) {
+	handler.moderatePost(w, r, collections.FeedModerationActionPinned)
+}
+
+// RestorePost allows the generator to add a removed post to the feed again.
+func (handler *AdminHandler) RestorePost(w http.ResponseWriter, r *http.Request) {
+	handler.unmoderatePost(w, r, collections.FeedModerationActionRemoved)
+}
+
+func (handler *AdminHandler) UnpinPost(w http.ResponseWriter, r *http.Request) {
+	handler.unmoderatePost(w, r, collections.FeedModerationActionPinned)
+}
+
+func (handler *AdminHandler) moderatePost(w http.ResponseWriter, r *http.Request, action collections.FeedModerationAction) {
+	feed, ok := handler.getFeed(w, r)
+	if !ok {
+		return
+	}
+
+	var request adminPostRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	did, recordKey, err := utils.ParsePostURI(request.URI)
+	if err != nil {
+		response.JSON(w, 400, response.M{"error": err.Error()})
+		return
+	}
+
+	feedName := feed.Generator.FeedName()
+	postID := did + "/" + recordKey
+	moderation := &collections.FeedModeration{
+		ID:        collections.FeedModerationID(feedName, postID),
+		Feed:      feedName,
+		PostID:    postID,
+		DID:       did,
+		RecordKey: recordKey,
+		Action:    action,
+		Reason:    request.Reason,
+		AddedBy:   getAdmin(r),
+		CreatedAt: time.Now(),
+	}
+	if err := handler.feedModerationCollection.Upsert(r.Context(), moderation); err != nil {
+		logger.Log.Error("Failed to store feed moderation", "feed", feedName, "error", err)
+		response.JSON500(w)
+		return
+	}
+
+	if action == collections.FeedModerationActionRemoved {
+		if _, err := feed.FeedCollection.DeleteByIDs(r.Context(), postID); err != nil {
+			logger.Log.Error("Failed to remove feed post", "feed", feedName, "error", err)
+			response.JSON500(w)
+			return
+		}
+		if _, err := handler.feedRankedCollection.DeleteByFeedIDs(r.Context(), feedName, postID); err != nil {
+			logger.Log.Error("Failed to remove ranked feed post", "feed", feedName, "error", err)
+			response.JSON500(w)
+			return
+		}
+	}
+
+	logger.Log.Info("Feed post moderated", "feed", feedName, "post", postID, "action", action, "admin", moderation.AddedBy)
+	response.JSON(w, 200, feedModerationResponse(moderation))
+}
+
+func (handler *AdminHandler) unmoderatePost(w http.ResponseWriter, r *http.Request, action collections.FeedModerationAction) {
+	feed, ok := handler.getFeed(w, r)
+	if !ok {
+		return
+	}
+
+	var request adminPostRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	did, recordKey, err := utils.ParsePostURI(request.URI)
+	if err != nil {
+		response.JSON(w, 400, response.M{"error": err.Error()})
+		return
+	}
+
+	feedName := feed.Generator.FeedName()
+	postID := did + "/" + recordKey
+	deleteCount, err := handler.feedModerationCollection.Delete(r.Context(), feedName, postID, action)
+	if err != nil {
+		logger.Log.Error("Failed to delete feed moderation", "feed", feedName, "error", err)
+		response.JSON500(w)
+		return
+	}
+	if deleteCount == 0 {
+		response.JSON404(w)
+		return
+	}
+
+	logger.Log.Info("Feed post moderation deleted", "feed", feedName, "post", postID, "action", action, "admin", getAdmin(r))
+	response.JSON(w, 200, response.M{"feed": feedName, "post_id": postID, "action": action, "deleted": true})
+}
+
+// GetModeration returns the removed and pinned posts of the feed.
+func (handler *AdminHandler) GetModeration(w http.ResponseWriter, r *http.Request) {
+	feed, ok := handler.getFeed(w, r)
+	if !ok {
+		return
+	}
+
+	feedName := feed.Generator.FeedName()
+	responseData := response.M{"feed": feedName}
+	for _, action := range []collections.FeedModerationAction{
+		collections.FeedModerationActionRemoved,
+		collections.FeedModerationActionPinned,
+	} {
+		moderations, err := handler.feedModerationCollection.GetByFeed(r.Context(), feedName, action)
+		if err != nil {
+			logger.Log.Error("Failed to get feed moderation", "feed", feedName, "error", err)
+			response.JSON500(w)
+			return
+		}
+
+		items := make([]response.M, len(moderations))
+		for i, moderation := range moderations {
+			items[i] = feedModerationResponse(moderation)
+		}
+		responseData[string(action)] = items
+	}
+
+	response.JSON(w, 200, responseData)
+}
+
+// ExplainPost evaluates the post given by the uri query parameter with the feed's generator and returns
+// the decision with every evaluated rule, and whether the post is currently in the feed.
+func (handler *AdminHandler) ExplainPost(w http.ResponseWriter, r *http.Request) {
+	feed, ok := handler.getFeed(w, r)
+	if !ok {
+		return
+	}
+
+	did, recordKey, err := utils.ParsePostURI(r.URL.Query().Get("uri"))
+	if err != nil {
+		response.JSON(w, 400, response.M{"error": err.Error()})
+		return
+	}
+
+	explanation, err := generator.ExplainPost(
+		r.Context(),
+		feed.Generator,
+		handler.postCollection,
+		feed.FeedCollection,
+		handler.feedModerationCollection,
+		did+"/"+recordKey,
+	)
+	if err != nil {
+		if errors.Is(err, types.ErrNotfound) {
+			response.JSON(w, 404, response.M{"error": "post not found, it may be older than the stored posts or deleted"})
+			return
+		}
+		logger.Log.Error("Failed to explain feed post", "feed", feed.Generator.FeedName(), "error", err)
+		response.JSON500(w)
+		return
+	}
+
+	steps := make([]response.M, len(explanation.Steps))
+	for i, step := range explanation.Steps {
+		steps[i] = response.M{"rule": step.Rule, "passed": step.Passed, "detail": step.Detail}
+	}
+
+	var moderation response.M
+	if explanation.Moderation != nil {
+		moderation = feedModerationResponse(explanation.Moderation)
+	}
+
+	post := explanation.Post
+	response.JSON(w, 200, response.M{
+		"feed":       feed.Generator.FeedName(),
+		"uri":        "at://" + post.DID + "/app.bsky.feed.post/" + post.RecordKey,
+		"selected":   explanation.Selected,
+		"in_feed":    explanation.InFeed,
+		"moderation": moderation,
+		"post": response.M{
+			"created_at":               post.CreatedAt,
+			"text":                     post.Text,
+			"langs":                    post.Langs,
+			"detected_lang":            post.DetectedLang,
+			"detected_lang_confidence": post.DetectedLangConfidence,
+			"hidden":                   post.Hidden,
+		},
+		"steps": steps,
+	})
+}
+
+// PutAuthor allows or denies an author in the feed.
+func (handler *AdminHandler) PutAuthor(w http.ResponseWriter, r *http.Request) {
+	feed, ok := handler.getFeed(w, r)
+	if !ok {
+		return
+	}
+
+	did, err := syntax.ParseDID(r.PathValue("did"))
+	if err != nil {
+		response.JSON(w, 400, response.M{"error": "invalid DID"})
+		return
+	}
+
+	var request adminAuthorRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	if request.Allowed == nil {
+		response.JSON(w, 400, response.M{"error": "allowed is required"})
+		return
+	}
+
+	feedName := feed.Generator.FeedName()
+	now := time.Now()
+	author := &collections.FeedAuthor{
+		ID:        collections.FeedAuthorID(feedName, did.String()),
+		Feed:      feedName,
+		DID:       did.String(),
+		Allowed:   *request.Allowed,
+		Reason:    request.Reason,
+		AddedBy:   getAdmin(r),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := handler.feedAuthorCollection.Upsert(r.Context(), author); err != nil {
+		logger.Log.Error("Failed to store feed author", "feed", feedName, "error", err)
+		response.JSON500(w)
+		return
+	}
+
+	logger.Log.Info("Feed author stored", "feed", feedName, "did", author.DID, "allowed", author.Allowed, "admin", author.AddedBy)
+	response.JSON(w, 200, response.M{
+		"feed":     feedName,
+		"did":      author.DID,
+		"allowed":  author.Allowed,
+		"reason":   author.Reason,
+		"added_by": author.AddedBy,
+	})
+}
+
+// DeleteAuthor removes an author from the allow or deny list of the feed.
+func (handler *AdminHandler) DeleteAuthor(w http.ResponseWriter, r *http.Request) {
+	feed, ok := handler.getFeed(w, r)
+	if !ok {
+		return
+	}
+
+	did := r.PathValue("did")
+	feedName := feed.Generator.FeedName()
+	deleteCount, err := handler.feedAuthorCollection.Delete(r.Context(), feedName, did)
+	if err != nil {
+		logger.Log.Error("Failed to delete feed author", "feed", feedName, "error", err)
+		response.JSON500(w)
+		return
+	}
+	if deleteCount == 0 {
+		response.JSON404(w)
+		return
+	}
+
+	logger.Log.Info("Feed author deleted", "feed", feedName, "did", did, "admin", getAdmin(r))
+	response.JSON(w, 200, response.M{"feed": feedName, "did": did, "deleted": true})
+}
+
+// CreateTask requests a generator run or cutoff from the feedgen service.
+func (handler *AdminHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
+	feed, ok := handler.getFeed(w, r)
+	if !ok {
+		return
+	}
+
+	var request adminTaskRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	if !request.Type.IsValid() {
+		response.JSON(w, 400, response.M{"error": "type must be generate or cutoff"})
+		return
+	}
+
+	task := &collections.FeedgenTask{
+		Generator:   feed.Generator.Name(),
+		Type:        request.Type,
+		Status:      collections.FeedgenTaskStatusPending,
+		RequestedBy: getAdmin(r),
+		CreatedAt:   time.Now(),
+	}
+	if err := handler.feedgenTaskCollection.Insert(r.Context(), task); err != nil {
+		logger.Log.Error("Failed to store feedgen task", "generator", task.Generator, "error", err)
+		response.JSON500(w)
+		return
+	}
+
+	logger.Log.Info("Feedgen task requested", "generator", task.Generator, "type", task.Type, "admin", task.RequestedBy)
+	response.JSON(w, 202, feedgenTaskResponse(task))
+}
+
+// GetStats returns the latest runs and tasks of the feed's generator. The limit query parameter
+// sets the number of returned runs and tasks (default: 20, max: 100).
+func (handler *AdminHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	feed, ok := handler.getFeed(w, r)
+	if !ok {
+		return
+	}
+
+	var limit int64 = 20
+	if limitQuery := r.URL.Query().Get("limit"); limitQuery != "" {
+		parsedLimit, err := strconv.ParseInt(limitQuery, 10, 64)
+		if err == nil && parsedLimit >= 1 && parsedLimit <= 100 {
+			limit = parsedLimit
+		}
+	}
+
+	generatorName := feed.Generator.Name()
+	stats, err := handler.generatorStatCollection.GetLatest(r.Context(), generatorName, limit)
+	if err != nil {
+		logger.Log.Error("Failed to get generator stats", "generator", generatorName, "error", err)
+		response.JSON500(w)
+		return
+	}
+	tasks, err := handler.feedgenTaskCollection.GetLatest(r.Context(), generatorName, limit)
+	if err != nil {
+		logger.Log.Error("Failed to get feedgen tasks", "generator", generatorName, "error", err)
+		response.JSON500(w)
+		return
+	}
+
+	feedCount, err := feed.FeedCollection.Collection.EstimatedDocumentCount(r.Context())
+	if err != nil {
+		logger.Log.Error("Failed to count feed posts", "generator", generatorName, "error", err)
+		response.JSON500(w)
+		return
+	}
+
+	runs := make([]response.M, len(stats))
+	for i, stat := range stats {
+		runs[i] = response.M{
+			"type":        stat.Type,
+			"trigger":     stat.Trigger,
+			"started_at":  stat.StartedAt,
+			"duration_ms": stat.Duration.Milliseconds(),
+			"scanned":     stat.Scanned,
+			"count":       stat.Count,
+		}
+		if stat.Error != "" {
+			runs[i]["error"] = stat.Error
+		}
+	}
+
+	taskItems := make([]response.M, len(tasks))
+	for i, task := range tasks {
+		taskItems[i] = feedgenTaskResponse(task)
+	}
+
+	response.JSON(w, 200, response.M{
+		"feed":       feed.Generator.FeedName(),
+		"generator":  generatorName,
+		"feed_count": feedCount,
+		"runs":       runs,
+		"tasks":      taskItems,
+	})
+}
+
+// GetDuplicates returns the latest flagged clusters of near-identical posts of the feed. The limit
+// query parameter sets the number of returned clusters (default: 20, max: 100).
+func (handler *AdminHandler) GetDuplicates(w http.ResponseWriter, r *http.Request) {
+	feed, ok := handler.getFeed(w, r)
+	if !ok {
+		return
+	}
+
+	var limit int64 = 20
+	if limitQuery := r.URL.Query().Get("limit"); limitQuery != "" {
+		parsedLimit, err := strconv.ParseInt(limitQuery, 10, 64)
+		if err == nil && parsedLimit >= 1 && parsedLimit <= 100 {
+			limit = parsedLimit
+		}
+	}
+
+	feedName := feed.Generator.FeedName()
+	clusters, err := handler.duplicateClusterCollection.GetLatest(r.Context(), feedName, limit)
+	if err != nil {
+		logger.Log.Error("Failed to get duplicate clusters", "feed", feedName, "error", err)
+		response.JSON500(w)
+		return
+	}
+
+	items := make([]response.M, len(clusters))
+	for i, cluster := range clusters {
+		uris := make([]string, len(cluster.PostIDs))
+		for j, postID := range cluster.PostIDs {
+			did, recordKey, _ := strings.Cut(postID, "/")
+			uris[j] = "at://" + did + "/app.bsky.feed.post/" + recordKey
+		}
+
+		items[i] = response.M{
+			"id":            cluster.ID,
+			"action":        cluster.Action,
+			"fingerprint":   cluster.Fingerprint,
+			"sample_text":   cluster.SampleText,
+			"post_count":    cluster.PostCount,
+			"author_count":  cluster.AuthorCount,
+			"dropped_count": cluster.DroppedCount,
+			"uris":          uris,
+			"dids":          cluster.DIDs,
+			"first_seen_at": cluster.FirstSeenAt,
+			"last_seen_at":  cluster.LastSeenAt,
+			"updated_at":    cluster.UpdatedAt,
+		}
+	}
+
+	response.JSON(w, 200, response.M{"feed": feedName, "clusters": items})
+}
+
+// getFeed returns the feed of the request, or writes a 404 response if it is unknown.
+func (handler *AdminHandler) getFeed(w http.ResponseWriter, r *http.Request) (*AdminFeed, bool) {
+	feed, ok := handler.feeds[r.PathValue("feed")]
+	if !ok {
+		response.JSON(w, 404, response.M{"error": "feed not found"})
+		return nil, false
+	}
+
+	return feed, true
+}
+
+// decodeRequest decodes the JSON body of the request into v, or writes a 400 response if it is invalid.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		response.JSON(w, 400, response.M{"error": "invalid request body: " + err.Error()})
+		return false
+	}
+
+	return true
+}
+
+func getAdmin(r *http.Request) string {
+	admin, _ := middleware.GetValue[string](r, middleware.AdminKey)
+	return admin
+}
+
+func feedModerationResponse(moderation *collections.FeedModeration) response.M {
+	return response.M{
+		"feed":       moderation.Feed,
+		"post_id":    moderation.PostID,
+		"uri":        "at://" + moderation.DID + "/app.bsky.feed.post/" + moderation.RecordKey,
+		"action":     moderation.Action,
+		"reason":     moderation.Reason,
+		"added_by":   moderation.AddedBy,
+		"created_at": moderation.CreatedAt,
+		"hidden":     moderation.Hidden,
+	}
+}
+
+func feedgenTaskResponse(task *collections.FeedgenTask) response.M {
+	responseData := response.M{
+		"id":           task.ID.Hex(),
+		"generator":    task.Generator,
+		"type":         task.Type,
+		"status":       task.Status,
+		"requested_by": task.RequestedBy,
+		"created_at":   task.CreatedAt,
+	}
+	if task.StartedAt != nil {
+		responseData["started_at"] = task.StartedAt
+	}
+	if task.CompletedAt != nil {
+		responseData["completed_at"] = task.CompletedAt
+	}
+	if task.Error != "" {
+		responseData["error"] = task.Error
+	}
+
+	return responseData
+}
@@ -4,42 +4,62 @@ import (
 	"net/http"
 
 	"github.com/aykhans/bsky-feedgen/pkg/api/response"
-	generatorAz "github.com/aykhans/bsky-feedgen/pkg/generator/az"
+	"github.com/aykhans/bsky-feedgen/pkg/generator"
+	"github.com/aykhans/bsky-feedgen/pkg/logger"
 )
 
-type GeneratorHandler struct{}
+type GeneratorHandler struct {
+	generators map[string]generator.Generator
+}
+
+func NewGeneratorHandler(generators []generator.Generator) *GeneratorHandler {
+	generatorsMap := make(map[string]generator.Generator, len(generators))
+	for _, gen := range generators {
+		generatorsMap[gen.FeedName()] = gen
+	}
+
+	return &GeneratorHandler{generators: generatorsMap}
+}
+
+// loadUsers reads the stored author lists of the feed. Unknown feeds have no authors.
+func (handler *GeneratorHandler) loadUsers(r *http.Request, feed string) (generator.Users, error) {
+	gen, ok := handler.generators[feed]
+	if !ok {
+		return generator.Users{}, nil
+	}
 
-func NewGeneratorHandler() *GeneratorHandler {
-	return &GeneratorHandler{}
+	return gen.Authors().Load(r.Context())
 }
 
 func (handler *GeneratorHandler) GetValidUsers(w http.ResponseWriter, r *http.Request) {
 	feed := r.PathValue("feed")
 
-	validUsers := make([]string, 0)
-	switch feed {
-	case "AzPulse":
-		validUsers = generatorAz.Users.GetValidUsers()
+	users, err := handler.loadUsers(r, feed)
+	if err != nil {
+		logger.Log.Error("Failed to load feed authors", "feed", feed, "error", err)
+		response.JSON500(w)
+		return
 	}
 
 	response.JSON(w, 200, response.M{
 		"feed":  feed,
-		"users": validUsers,
+		"users": users.GetValidUsers(),
 	})
 }
 
 func (handler *GeneratorHandler) GetInvalidUsers(w http.ResponseWriter, r *http.Request) {
 	feed := r.PathValue("feed")
 
-	invalidUsers := make([]string, 0)
-	switch feed {
-	case "AzPulse":
-		invalidUsers = generatorAz.Users.GetInvalidUsers()
+	users, err := handler.loadUsers(r, feed)
+	if err != nil {
+		logger.Log.Error("Failed to load feed authors", "feed", feed, "error", err)
+		response.JSON500(w)
+		return
 	}
 
 	response.JSON(w, 200, response.M{
 		"feed":  feed,
-		"users": invalidUsers,
+		"users": users.GetInvalidUsers(),
 	})
 }
 
@@ -47,10 +67,16 @@ func (handler *GeneratorHandler) GetAllUsers(w http.ResponseWriter, r *http.Requ
 	feed := r.PathValue("feed")
 
 	responseData := response.M{"feed": feed}
-	switch feed {
-	case "AzPulse":
-		responseData["valid_users"] = generatorAz.Users.GetValidUsers()
-		responseData["invalid_users"] = generatorAz.Users.GetInvalidUsers()
+	if _, ok := handler.generators[feed]; ok {
+		users, err := handler.loadUsers(r, feed)
+		if err != nil {
+			logger.Log.Error("Failed to load feed authors", "feed", feed, "error", err)
+			response.JSON500(w)
+			return
+		}
+
+		responseData["valid_users"] = users.GetValidUsers()
+		responseData["invalid_users"] = users.GetInvalidUsers()
 	}
 
 	response.JSON(w, 200, responseData)
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/aykhans/bsky-feedgen/pkg/api/middleware"
+	"github.com/aykhans/bsky-feedgen/pkg/api/response"
+	"github.com/aykhans/bsky-feedgen/pkg/logger"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+const (
+	// maxViewerMuteLists is the maximum number of mute lists of a viewer.
+	maxViewerMuteLists = 10
+	// maxViewerMuteListDIDs is the maximum number of accounts on a mute list.
+	maxViewerMuteListDIDs = 1000
+)
+
+// ViewerHandler manages the mute lists of the viewers. Every request is authenticated with the
+// viewer's service JWT, so viewers only manage their own lists.
+type ViewerHandler struct {
+	viewerMuteCollection *collections.ViewerMuteCollection
+}
+
+func NewViewerHandler(viewerMuteCollection *collections.ViewerMuteCollection) *ViewerHandler {
+	return &ViewerHandler{viewerMuteCollection: viewerMuteCollection}
+}
+
+type viewerMuteListRequest struct {
+	DIDs []string `json:"dids"`
+}
+
+// GetMuteLists returns the mute lists of the viewer.
+func (handler *ViewerHandler) GetMuteLists(w http.ResponseWriter, r *http.Request) {
+	viewerDID, _ := middleware.GetValue[string](r, middleware.UserDIDKey)
+
+	lists, err := handler.viewerMuteCollection.GetLists(r.Context(), viewerDID)
+	if err != nil {
+		logger.Log.Error("Failed to get viewer mute lists", "viewer", viewerDID, "error", err)
+		response.JSON500(w)
+		return
+	}
+
+	items := make([]response.M, len(lists))
+	for i, list := range lists {
+		items[i] = response.M{"name": list.Name, "count": list.Count, "updated_at": list.UpdatedAt}
+	}
+
+	response.JSON(w, 200, response.M{"viewer": viewerDID, "lists": items})
+}
+
+// PutMuteList replaces the accounts of the viewer's mute list. The posts of the accounts are not
+// shown to the viewer in any feed.
+func (handler *ViewerHandler) PutMuteList(w http.ResponseWriter, r *http.Request) {
+	viewerDID, _ := middleware.GetValue[string](r, middleware.UserDIDKey)
+
+	listName, err := syntax.ParseRecordKey(r.PathValue("list"))
+	if err != nil {
+		response.JSON(w, 400, response.M{"error": "invalid list name: " + err.Error()})
+		return
+	}
+
+	var request viewerMuteListRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+
+	dids := make([]string, 0, len(request.DIDs))
+	for _, didValue := range request.DIDs {
+		did, err := syntax.ParseDID(didValue)
+		if err != nil {
+			response.JSON(w, 400, response.M{"error": "invalid DID: " + didValue})
+			return
+		}
+		if !slices.Contains(dids, did.String()) {
+			dids = append(dids, did.String())
+		}
+	}
+	if len(dids) > maxViewerMuteListDIDs {
+		response.JSON(w, 400, response.M{"error": "a mute list can have at most 1000 accounts"})
+		return
+	}
+
+	lists, err := handler.viewerMuteCollection.GetLists(r.Context(), viewerDID)
+	if err != nil {
+		logger.Log.Error("Failed to get viewer mute lists", "viewer", viewerDID, "error", err)
+		response.JSON500(w)
+		return
+	}
+	listExists := slices.ContainsFunc(lists, func(list *collections.ViewerMuteList) bool {
+		return list.Name == listName.String()
+	})
+	if !listExists && len(lists) >= maxViewerMuteLists {
+		response.JSON(w, 400, response.M{"error": "a viewer can have at most 10 mute lists"})
+		return
+	}
+
+	if err := handler.viewerMuteCollection.ReplaceList(r.Context(), viewerDID, listName.String(), dids...); err != nil {
+		logger.Log.Error("Failed to store viewer mute list", "viewer", viewerDID, "list", listName, "error", err)
+		response.JSON500(w)
+		return
+	}
+
+	response.JSON(w, 200, response.M{"viewer": viewerDID, "name": listName.String(), "count": len(dids)})
+}
+
+// DeleteMuteList deletes the viewer's mute list.
+func (handler *ViewerHandler) DeleteMuteList(w http.ResponseWriter, r *http.Request) {
+	viewerDID, _ := middleware.GetValue[string](r, middleware.UserDIDKey)
+	listName := r.PathValue("list")
+
+	deleteCount, err := handler.viewerMuteCollection.DeleteList(r.Context(), viewerDID, listName)
+	if err != nil {
+		logger.Log.Error("Failed to delete viewer mute list", "viewer", viewerDID, "list", listName, "error", err)
+		response.JSON500(w)
+		return
+	}
+	if deleteCount == 0 {
+		response.JSON(w, 404, response.M{"error": "mute list not found"})
+		return
+	}
+
+	response.JSON(w, 200, response.M{"viewer": viewerDID, "name": listName, "deleted": true})
+}
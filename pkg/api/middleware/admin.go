@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aykhans/bsky-feedgen/pkg/api/response"
+)
+
+// AdminKey is the context key of the authenticated admin: its DID, or "token" for the static admin token.
+const AdminKey ContextKey = "admin"
+
+type AdminAuth struct {
+	auth      *Auth
+	token     string
+	adminDIDs map[string]bool
+}
+
+// NewAdminAuth creates the authentication of the admin API. Requests are authenticated with the static
+// token, or with a service JWT issued by one of adminDIDs. An empty token disables token authentication.
+func NewAdminAuth(auth *Auth, token string, adminDIDs []string) *AdminAuth {
+	adminDIDsMap := make(map[string]bool, len(adminDIDs))
+	for _, adminDID := range adminDIDs {
+		adminDIDsMap[adminDID] = true
+	}
+
+	return &AdminAuth{auth: auth, token: token, adminDIDs: adminDIDsMap}
+}
+
+func (adminAuth *AdminAuth) AdminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get(authorizationHeaderName)
+		if !strings.HasPrefix(authHeader, authorizationHeaderValuePrefix) {
+			response.JSON(w, 401, response.M{"error": "Authorization header is missing or invalid"})
+			return
+		}
+
+		bearer := strings.TrimSpace(strings.TrimPrefix(authHeader, authorizationHeaderValuePrefix))
+		if adminAuth.token != "" && subtle.ConstantTimeCompare([]byte(bearer), []byte(adminAuth.token)) == 1 {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), AdminKey, "token")))
+			return
+		}
+
+		if len(adminAuth.adminDIDs) == 0 {
+			response.JSON(w, 401, response.M{"error": "Invalid admin token"})
+			return
+		}
+
+		userDID, err := adminAuth.auth.validateAuth(r.Context(), r)
+		if err != nil {
+			message := "Invalid admin token"
+			var authErr *AuthorizationError
+			if errors.As(err, &authErr) {
+				message = authErr.Message
+			}
+			response.JSON(w, 401, response.M{"error": message})
+			return
+		}
+		if !adminAuth.adminDIDs[userDID] {
+			response.JSON(w, 403, response.M{"error": "Not an admin"})
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), AdminKey, userDID)))
+	})
+}
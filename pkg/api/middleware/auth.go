@@ -10,6 +10,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/aykhans/bsky-feedgen/pkg/api/response"
+	"github.com/aykhans/bsky-feedgen/pkg/logger"
+	"github.com/aykhans/bsky-feedgen/pkg/types"
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/atproto/syntax"
 	"github.com/golang-jwt/jwt/v5"
@@ -21,30 +24,12 @@ const UserDIDKey ContextKey = "user_did"
 const (
 	authorizationHeaderName        = "Authorization"
 	authorizationHeaderValuePrefix = "Bearer "
+	xrpcPathPrefix                 = "/xrpc/"
 )
 
-// Global (or dependency-injected) DID resolver with caching.
-var didResolver *identity.CacheDirectory
-
-func init() {
-	baseDir := identity.BaseDirectory{}
-
-	// Configure cache with appropriate TTLs.
-	// Capacity 0 means unlimited cache size.
-	// hitTTL: 24 hours for successful resolutions.
-	// errTTL: 5 minutes for failed resolutions.
-	// invalidHandleTTL: also 5 minutes for invalid handles.
-	resolver := identity.NewCacheDirectory(
-		&baseDir,
-		0,             // Unlimited capacity
-		24*time.Hour,  // hitTTL
-		5*time.Minute, // errTTL
-		5*time.Minute, // invalidHandleTTL
-	)
-	didResolver = &resolver
-}
-
+// AuthorizationError is the error of an invalid service JWT. Name is the XRPC error name returned to the client.
 type AuthorizationError struct {
+	Name    string
 	Message string
 	Err     error
 }
@@ -60,14 +45,28 @@ func (e *AuthorizationError) Unwrap() error {
 	return e.Err
 }
 
+// ServiceClaims are the claims of an atproto inter-service JWT.
+type ServiceClaims struct {
+	jwt.RegisteredClaims
+	// Lexicon method the token is scoped to, e.g. app.bsky.feed.getFeedSkeleton
+	LexiconMethod string `json:"lxm,omitempty"`
+}
+
 type Auth struct {
 	serviceDID *did.DID
+	// Resolves the signing keys of the token issuers, see didresolver.NewDirectory
+	didResolver identity.Directory
+	mode        types.AuthMode
+	clockSkew   time.Duration
 }
 
-func NewAuth(serviceDID *did.DID) *Auth {
-	return &Auth{serviceDID}
+func NewAuth(serviceDID *did.DID, didResolver identity.Directory, mode types.AuthMode, clockSkew time.Duration) *Auth {
+	return &Auth{serviceDID: serviceDID, didResolver: didResolver, mode: mode, clockSkew: clockSkew}
 }
 
+// JWTAuthMiddleware authenticates the requests with a service JWT. Requests without a token are served
+// anonymously. Requests with an invalid token are rejected in the strict mode and served anonymously
+// in the lenient mode.
 func (auth *Auth) JWTAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -77,25 +76,68 @@ func (auth *Auth) JWTAuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		userDID, _ := auth.validateAuth(r.Context(), r)
-		ctx := context.WithValue(r.Context(), UserDIDKey, userDID)
+		userDID, err := auth.validateAuth(r.Context(), r)
+		if err != nil {
+			if auth.mode.IsStrict() {
+				writeAuthError(w, r, err)
+				return
+			}
+
+			logger.Log.Warn("Serving request with invalid service JWT anonymously", "path", r.URL.Path, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), UserDIDKey, userDID)))
+	})
+}
+
+// RequireJWTAuthMiddleware authenticates the request like JWTAuthMiddleware, but rejects requests
+// without a valid service JWT regardless of the mode.
+func (auth *Auth) RequireJWTAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userDID, err := auth.validateAuth(r.Context(), r)
+		if err != nil {
+			writeAuthError(w, r, err)
+			return
+		}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), UserDIDKey, userDID)))
 	})
 }
 
+// writeAuthError responds with a 401 error. XRPC endpoints get XRPC errors, the other endpoints get
+// the plain JSON errors of the API.
+func writeAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	authErr := &AuthorizationError{Name: "AuthenticationRequired", Message: "Invalid token"}
+	errors.As(err, &authErr)
+
+	if _, ok := lexiconMethod(r); ok {
+		response.XRPCError(w, 401, authErr.Name, authErr.Message)
+		return
+	}
+	response.JSON(w, 401, response.M{"error": authErr.Message})
+}
+
+// lexiconMethod returns the lexicon method of an XRPC request.
+func lexiconMethod(r *http.Request) (string, bool) {
+	method, ok := strings.CutPrefix(r.URL.Path, xrpcPathPrefix)
+	if !ok || method == "" {
+		return "", false
+	}
+	return method, true
+}
+
 // getDIDSigningKey resolves a DID and extracts its public signing key.
 // It leverages indigo's identity package which handles multibase decoding and key parsing.
 func (auth *Auth) getDIDSigningKey(ctx context.Context, did string) (crypto.PublicKey, error) {
-	atID, err := syntax.ParseAtIdentifier(did)
+	atDID, err := syntax.ParseDID(did)
 	if err != nil {
 		return nil, fmt.Errorf("invalid DID syntax: %w", err)
 	}
 
-	// Use Lookup for bi-directional verification (handle -> DID -> handle).
-	// The `Lookup` method returns an `Identity` struct which contains `PublicKey()` method
-	// to get the signing key.
-	identity, err := didResolver.Lookup(ctx, *atID)
+	// The signing key is in the DID document, the handle isn't needed.
+	identity, err := auth.didResolver.LookupDID(ctx, atDID)
 	if err != nil {
 		return nil, fmt.Errorf("DID resolution failed for %s: %w", did, err)
 	}
@@ -111,24 +153,27 @@ func (auth *Auth) getDIDSigningKey(ctx context.Context, did string) (crypto.Publ
 	return publicKey, nil
 }
 
-// ValidateAuth validates the authorization header and returns the requester's DID.
+// validateAuth validates the authorization header and returns the requester's DID.
+// The token must be signed by the issuer's atproto signing key, be addressed to this service and,
+// if it's scoped to a lexicon method, be scoped to the method of the request. In the strict mode
+// tokens of XRPC requests must be scoped to a lexicon method.
 func (auth *Auth) validateAuth(ctx context.Context, r *http.Request) (string, error) {
 	authHeader := r.Header.Get(authorizationHeaderName)
 	if authHeader == "" {
-		return "", &AuthorizationError{Message: "Authorization header is missing"}
+		return "", &AuthorizationError{Name: "AuthMissing", Message: "Authorization header is missing"}
 	}
 
 	if !strings.HasPrefix(authHeader, authorizationHeaderValuePrefix) {
-		return "", &AuthorizationError{Message: "Invalid authorization header format"}
+		return "", &AuthorizationError{Name: "AuthMissing", Message: "Invalid authorization header format"}
 	}
 
 	jwtString := strings.TrimPrefix(authHeader, authorizationHeaderValuePrefix)
 	jwtString = strings.TrimSpace(jwtString)
 
-	claims := jwt.RegisteredClaims{}
+	claims := ServiceClaims{}
 
 	keyFunc := func(token *jwt.Token) (any, error) {
-		regClaims, ok := token.Claims.(*jwt.RegisteredClaims)
+		regClaims, ok := token.Claims.(*ServiceClaims)
 		if !ok {
 			return nil, fmt.Errorf("invalid JWT claims type")
 		}
@@ -146,31 +191,66 @@ func (auth *Auth) validateAuth(ctx context.Context, r *http.Request) (string, er
 		return publicKey, nil
 	}
 
-	token, err := jwt.ParseWithClaims(jwtString, &claims, keyFunc)
+	token, err := jwt.ParseWithClaims(
+		jwtString,
+		&claims,
+		keyFunc,
+		jwt.WithValidMethods([]string{SigningMethodES256K.Alg(), SigningMethodES256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(auth.clockSkew),
+	)
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
-			return "", &AuthorizationError{Message: "Invalid signature", Err: err}
+			return "", &AuthorizationError{Name: "BadJwtSignature", Message: "Invalid signature", Err: err}
 		}
 		if errors.Is(err, jwt.ErrTokenExpired) {
-			return "", &AuthorizationError{Message: "Token expired", Err: err}
+			return "", &AuthorizationError{Name: "JwtExpired", Message: "Token expired", Err: err}
+		}
+		if errors.Is(err, jwt.ErrTokenNotValidYet) || errors.Is(err, jwt.ErrTokenUsedBeforeIssued) {
+			return "", &AuthorizationError{Name: "BadJwt", Message: "Token not valid yet", Err: err}
 		}
-		if errors.Is(err, jwt.ErrTokenNotValidYet) {
-			return "", &AuthorizationError{Message: "Token not valid yet", Err: err}
+		if errors.Is(err, jwt.ErrTokenRequiredClaimMissing) {
+			return "", &AuthorizationError{Name: "BadJwt", Message: "Token has no expiration", Err: err}
 		}
 		if errors.Is(err, jwt.ErrTokenMalformed) {
-			return "", &AuthorizationError{Message: "Malformed token", Err: err}
+			return "", &AuthorizationError{Name: "BadJwt", Message: "Malformed token", Err: err}
 		}
-		return "", &AuthorizationError{Message: "Failed to parse or validate JWT", Err: err}
+		return "", &AuthorizationError{Name: "BadJwt", Message: "Failed to parse or validate JWT", Err: err}
 	}
 
 	if !token.Valid {
-		return "", &AuthorizationError{Message: "Token is invalid"}
+		return "", &AuthorizationError{Name: "BadJwt", Message: "Token is invalid"}
 	}
 
-	if slices.Contains(claims.Audience, auth.serviceDID.String()) {
-		return "", &AuthorizationError{Message: fmt.Sprintf("Invalid audience (expected %s)", auth.serviceDID)}
+	if !auth.isServiceAudience(claims.Audience) {
+		return "", &AuthorizationError{
+			Name:    "BadJwtAudience",
+			Message: fmt.Sprintf("Invalid audience (expected %s)", auth.serviceDID),
+		}
+	}
+
+	method, isXRPC := lexiconMethod(r)
+	if claims.LexiconMethod != "" && claims.LexiconMethod != method {
+		return "", &AuthorizationError{
+			Name:    "BadJwtLexiconMethod",
+			Message: fmt.Sprintf("Token is scoped to %s", claims.LexiconMethod),
+		}
+	}
+	// Unscoped tokens could be replayed against any method of the service
+	if claims.LexiconMethod == "" && isXRPC && auth.mode.IsStrict() {
+		return "", &AuthorizationError{Name: "BadJwtLexiconMethod", Message: "Token is not scoped to a lexicon method"}
 	}
 
 	// Return the issuer's DID.
 	return claims.Issuer, nil
 }
+
+// isServiceAudience reports whether the token audience is this service, either the service DID or
+// a service of its DID document, e.g. did:web:feeds.example.com#bsky_fg.
+func (auth *Auth) isServiceAudience(audience jwt.ClaimStrings) bool {
+	serviceDID := auth.serviceDID.String()
+	return slices.ContainsFunc(audience, func(aud string) bool {
+		audDID, _, _ := strings.Cut(aud, "#")
+		return audDID == serviceDID
+	})
+}
@@ -0,0 +1,350 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/didresolver"
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+	atcrypto "github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/whyrusleeping/go-did"
+)
+
+const (
+	testServiceDID = "did:web:feeds.example.com"
+	testK256DID    = "did:plc:k256k256k256k256k256k256"
+	testP256DID    = "did:plc:p256p256p256p256p256p256"
+	testMethod     = "app.bsky.feed.getFeedSkeleton"
+	testSkew       = 30 * time.Second
+)
+
+type authTestKeys struct {
+	k256  *atcrypto.PrivateKeyK256
+	p256  *atcrypto.PrivateKeyP256
+	other *atcrypto.PrivateKeyK256
+}
+
+func newAuthTestKeys(t *testing.T) *authTestKeys {
+	t.Helper()
+
+	k256, err := atcrypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, err := atcrypto.GeneratePrivateKeyP256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := atcrypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &authTestKeys{k256: k256, p256: p256, other: other}
+}
+
+// newTestAuth returns an Auth resolving the DIDs of the test keys from their DID documents in a local directory.
+func newTestAuth(t *testing.T, keys *authTestKeys, mode types.AuthMode) *Auth {
+	t.Helper()
+
+	directory := didresolver.NewLocalDirectory(nil)
+	for didString, key := range map[string]atcrypto.PrivateKey{testK256DID: keys.k256, testP256DID: keys.p256} {
+		publicKey, err := key.PublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = directory.Insert(&identity.DIDDocument{
+			DID: syntax.DID(didString),
+			VerificationMethod: []identity.DocVerificationMethod{
+				{
+					ID:                 didString + "#atproto",
+					Type:               "Multikey",
+					Controller:         didString,
+					PublicKeyMultibase: publicKey.Multibase(),
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	serviceDID, err := did.ParseDID(testServiceDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewAuth(&serviceDID, directory, mode, testSkew)
+}
+
+func signTestToken(t *testing.T, method jwt.SigningMethod, key atcrypto.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func testClaims(issuer string, modify func(jwt.MapClaims)) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": issuer,
+		"aud": testServiceDID,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Minute).Unix(),
+		"lxm": testMethod,
+	}
+	if modify != nil {
+		modify(claims)
+	}
+	return claims
+}
+
+func TestJWTAuthMiddleware(t *testing.T) {
+	keys := newAuthTestKeys(t)
+
+	tests := []struct {
+		name      string
+		mode      types.AuthMode
+		path      string
+		token     string
+		wantCode  int
+		wantDID   string
+		wantError string // XRPC error name of the 401 response
+	}{
+		{
+			name:     "valid ES256K",
+			mode:     types.AuthModeStrict,
+			token:    signTestToken(t, SigningMethodES256K, keys.k256, testClaims(testK256DID, nil)),
+			wantCode: 200,
+			wantDID:  testK256DID,
+		},
+		{
+			name:     "valid ES256",
+			mode:     types.AuthModeStrict,
+			token:    signTestToken(t, SigningMethodES256, keys.p256, testClaims(testP256DID, nil)),
+			wantCode: 200,
+			wantDID:  testP256DID,
+		},
+		{
+			name:      "bad signature",
+			mode:      types.AuthModeStrict,
+			token:     signTestToken(t, SigningMethodES256K, keys.other, testClaims(testK256DID, nil)),
+			wantCode:  401,
+			wantError: "BadJwtSignature",
+		},
+		{
+			name:      "issuer unknown to the directory",
+			mode:      types.AuthModeStrict,
+			token:     signTestToken(t, SigningMethodES256K, keys.other, testClaims("did:plc:unknownunknownunknownunk", nil)),
+			wantCode:  401,
+			wantError: "BadJwt",
+		},
+		{
+			name: "wrong aud",
+			mode: types.AuthModeStrict,
+			token: signTestToken(t, SigningMethodES256K, keys.k256, testClaims(testK256DID, func(claims jwt.MapClaims) {
+				claims["aud"] = "did:web:other.example.com"
+			})),
+			wantCode:  401,
+			wantError: "BadJwtAudience",
+		},
+		{
+			name: "aud with fragment",
+			mode: types.AuthModeStrict,
+			token: signTestToken(t, SigningMethodES256K, keys.k256, testClaims(testK256DID, func(claims jwt.MapClaims) {
+				claims["aud"] = testServiceDID + "#bsky_fg"
+			})),
+			wantCode: 200,
+			wantDID:  testK256DID,
+		},
+		{
+			name: "expired",
+			mode: types.AuthModeStrict,
+			token: signTestToken(t, SigningMethodES256K, keys.k256, testClaims(testK256DID, func(claims jwt.MapClaims) {
+				claims["exp"] = time.Now().Add(-2 * testSkew).Unix()
+			})),
+			wantCode:  401,
+			wantError: "JwtExpired",
+		},
+		{
+			name: "expired within skew",
+			mode: types.AuthModeStrict,
+			token: signTestToken(t, SigningMethodES256K, keys.k256, testClaims(testK256DID, func(claims jwt.MapClaims) {
+				claims["exp"] = time.Now().Add(-testSkew / 2).Unix()
+			})),
+			wantCode: 200,
+			wantDID:  testK256DID,
+		},
+		{
+			name: "issued in the future within skew",
+			mode: types.AuthModeStrict,
+			token: signTestToken(t, SigningMethodES256K, keys.k256, testClaims(testK256DID, func(claims jwt.MapClaims) {
+				claims["iat"] = time.Now().Add(testSkew / 2).Unix()
+			})),
+			wantCode: 200,
+			wantDID:  testK256DID,
+		},
+		{
+			name: "without exp",
+			mode: types.AuthModeStrict,
+			token: signTestToken(t, SigningMethodES256K, keys.k256, testClaims(testK256DID, func(claims jwt.MapClaims) {
+				delete(claims, "exp")
+			})),
+			wantCode:  401,
+			wantError: "BadJwt",
+		},
+		{
+			name: "lxm mismatch",
+			mode: types.AuthModeStrict,
+			token: signTestToken(t, SigningMethodES256K, keys.k256, testClaims(testK256DID, func(claims jwt.MapClaims) {
+				claims["lxm"] = "app.bsky.feed.getPosts"
+			})),
+			wantCode:  401,
+			wantError: "BadJwtLexiconMethod",
+		},
+		{
+			name: "without lxm strict",
+			mode: types.AuthModeStrict,
+			token: signTestToken(t, SigningMethodES256K, keys.k256, testClaims(testK256DID, func(claims jwt.MapClaims) {
+				delete(claims, "lxm")
+			})),
+			wantCode:  401,
+			wantError: "BadJwtLexiconMethod",
+		},
+		{
+			name: "without lxm lenient",
+			mode: types.AuthModeLenient,
+			token: signTestToken(t, SigningMethodES256K, keys.k256, testClaims(testK256DID, func(claims jwt.MapClaims) {
+				delete(claims, "lxm")
+			})),
+			wantCode: 200,
+			wantDID:  testK256DID,
+		},
+		{
+			name:      "malformed strict",
+			mode:      types.AuthModeStrict,
+			token:     "not.a.jwt",
+			wantCode:  401,
+			wantError: "BadJwt",
+		},
+		{
+			name:     "bad signature lenient",
+			mode:     types.AuthModeLenient,
+			token:    signTestToken(t, SigningMethodES256K, keys.other, testClaims(testK256DID, nil)),
+			wantCode: 200,
+		},
+		{
+			name:     "without token strict",
+			mode:     types.AuthModeStrict,
+			wantCode: 200,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth := newTestAuth(t, keys, test.mode)
+
+			var gotDID string
+			handler := auth.JWTAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotDID, _ = GetValue[string](r, UserDIDKey)
+			}))
+
+			request := httptest.NewRequest("GET", xrpcPathPrefix+testMethod, nil)
+			if test.token != "" {
+				request.Header.Set(authorizationHeaderName, authorizationHeaderValuePrefix+test.token)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.wantCode {
+				t.Fatalf("status = %d, want %d, body: %s", recorder.Code, test.wantCode, recorder.Body.String())
+			}
+			if gotDID != test.wantDID {
+				t.Errorf("user DID = %q, want %q", gotDID, test.wantDID)
+			}
+			if test.wantCode != 401 {
+				return
+			}
+
+			var body struct {
+				Error   string `json:"error"`
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid XRPC error body %q: %v", recorder.Body.String(), err)
+			}
+			if body.Error != test.wantError || body.Message == "" {
+				t.Errorf("body = %+v, want error %s with a message", body, test.wantError)
+			}
+		})
+	}
+}
+
+func TestRequireJWTAuthMiddleware(t *testing.T) {
+	keys := newAuthTestKeys(t)
+	unscoped := func(claims jwt.MapClaims) { delete(claims, "lxm") }
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+	}{
+		{
+			name:     "unscoped token",
+			token:    signTestToken(t, SigningMethodES256K, keys.k256, testClaims(testK256DID, unscoped)),
+			wantCode: 200,
+		},
+		{
+			name:     "token scoped to an XRPC method",
+			token:    signTestToken(t, SigningMethodES256K, keys.k256, testClaims(testK256DID, nil)),
+			wantCode: 401,
+		},
+		{
+			name:     "bad signature",
+			token:    signTestToken(t, SigningMethodES256K, keys.other, testClaims(testK256DID, unscoped)),
+			wantCode: 401,
+		},
+		{
+			name:     "without token",
+			wantCode: 401,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Non-XRPC endpoints don't depend on the mode
+			auth := newTestAuth(t, keys, types.AuthModeStrict)
+			handler := auth.RequireJWTAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			request := httptest.NewRequest("GET", "/viewer/mute-lists", nil)
+			if test.token != "" {
+				request.Header.Set(authorizationHeaderName, authorizationHeaderValuePrefix+test.token)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.wantCode {
+				t.Fatalf("status = %d, want %d, body: %s", recorder.Code, test.wantCode, recorder.Body.String())
+			}
+
+			if test.wantCode == 401 {
+				var body map[string]any
+				if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+					t.Fatalf("invalid error body %q: %v", recorder.Body.String(), err)
+				}
+				if _, ok := body["message"]; ok {
+					t.Errorf("non-XRPC endpoint returned an XRPC error: %v", body)
+				}
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ package middleware
 import (
 	"crypto"
 	"errors"
+	"fmt"
 
 	atcrypto "github.com/bluesky-social/indigo/atproto/crypto"
 	"github.com/golang-jwt/jwt/v5"
@@ -71,9 +72,38 @@ func (sm *SigningMethodAtproto) Verify(signingString string, sig []byte, key any
 	return pub.HashAndVerifyLenient([]byte(signingString), sig)
 }
 
+// Sign signs with an atproto private key of the curve of the method: a K-256 key for ES256K and a
+// P-256 key for ES256. The signatures are in the compact low-S form expected by atproto.
 func (sm *SigningMethodAtproto) Sign(signingString string, key any) ([]byte, error) {
-	// TODO: implement signatures
-	return nil, ErrFailedSigning
+	var priv atcrypto.PrivateKey
+	switch k := key.(type) {
+	case *atcrypto.PrivateKeyK256:
+		if sm.alg != SigningMethodES256K.alg {
+			return nil, ErrWrongKeyFormat
+		}
+		priv = k
+	case *atcrypto.PrivateKeyP256:
+		if sm.alg != SigningMethodES256.alg {
+			return nil, ErrWrongKeyFormat
+		}
+		priv = k
+	default:
+		return nil, ErrWrongKeyFormat
+	}
+
+	if !sm.hash.Available() {
+		return nil, ErrHashUnavailable
+	}
+
+	sig, err := priv.HashAndSign([]byte(signingString))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFailedSigning, err)
+	}
+	if len(sig) < sm.sigLen {
+		return nil, ErrFailedSigning
+	}
+
+	return sm.toOutSig(sig), nil
 }
 
 func (sm *SigningMethodAtproto) Alg() string {
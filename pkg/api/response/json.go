@@ -25,3 +25,8 @@ func JSON500(w http.ResponseWriter) {
 func JSON404(w http.ResponseWriter) {
 	JSON(w, 404, M{"error": "Not found"})
 }
+
+// XRPCError responds with an error in the XRPC error format, e.g. {"error":"BadJwt","message":"Malformed token"}.
+func XRPCError(w http.ResponseWriter, statusCode int, name string, message string) {
+	JSON(w, statusCode, M{"error": name, "message": message})
+}
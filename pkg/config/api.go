@@ -1,9 +1,12 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"maps"
 	"net/url"
 	"slices"
+	"time"
 
 	"github.com/aykhans/bsky-feedgen/pkg/types"
 	"github.com/aykhans/bsky-feedgen/pkg/utils"
@@ -15,6 +18,22 @@ type APIConfig struct {
 	ServiceDID          *did.DID
 	FeedgenPublisherDID *did.DID
 	APIPort             uint16
+	// Feeds of the enabled generators
+	Feeds []*FeedConfig
+	// Static bearer token of the admin API
+	AdminToken string
+	// DIDs whose service JWTs are accepted by the admin API
+	AdminDIDs []string
+	// Whether requests with an invalid service JWT are rejected or served anonymously
+	AuthMode types.AuthMode
+	// Tolerated clock difference when validating the times of service JWTs
+	AuthClockSkew time.Duration
+	DIDResolver   *DIDResolverConfig
+}
+
+// IsAdminEnabled reports whether the admin API is served. It is disabled unless a token or an admin DID is set.
+func (c *APIConfig) IsAdminEnabled() bool {
+	return c.AdminToken != "" || len(c.AdminDIDs) > 0
 }
 
 func NewAPIConfig() (*APIConfig, types.ErrMap) {
@@ -49,6 +68,53 @@ func NewAPIConfig() (*APIConfig, types.ErrMap) {
 		errs["API_PORT"] = err
 	}
 
+	generatorNames, err := getGeneratorNames()
+	if err != nil {
+		errs["FEEDGEN_GENERATORS"] = err
+	}
+	feeds := make([]*FeedConfig, 0, len(generatorNames))
+	for _, generatorName := range generatorNames {
+		feedConfig, feedErrs := NewFeedConfig(generatorName)
+		maps.Copy(errs, feedErrs)
+		feeds = append(feeds, feedConfig)
+	}
+
+	adminToken, err := utils.GetEnvOr("ADMIN_TOKEN", "")
+	if err != nil {
+		errs["ADMIN_TOKEN"] = err
+	} else if adminToken != "" && len(adminToken) < 32 {
+		errs["ADMIN_TOKEN"] = errors.New("admin token must be at least 32 characters long")
+	}
+	adminDIDs, err := utils.GetEnvOr("ADMIN_DIDS", []string{})
+	if err != nil {
+		errs["ADMIN_DIDS"] = err
+	} else {
+		for _, adminDID := range adminDIDs {
+			if _, err := did.ParseDID(adminDID); err != nil {
+				errs["ADMIN_DIDS"] = fmt.Errorf("invalid admin DID %s: %w", adminDID, err)
+				break
+			}
+		}
+	}
+
+	var authMode types.AuthMode
+	authModeValue, err := utils.GetEnvOr("AUTH_MODE", types.AuthModeLenient.String())
+	if err == nil {
+		err = authMode.Set(authModeValue)
+	}
+	if err != nil {
+		errs["AUTH_MODE"] = err
+	}
+	authClockSkew, err := utils.GetEnvOr("AUTH_CLOCK_SKEW", 30*time.Second)
+	if err != nil {
+		errs["AUTH_CLOCK_SKEW"] = err
+	} else if authClockSkew < 0 || authClockSkew > 5*time.Minute {
+		errs["AUTH_CLOCK_SKEW"] = errors.New("clock skew must be between 0 and 5m")
+	}
+
+	didResolverConfig, didResolverErrs := NewDIDResolverConfig()
+	maps.Copy(errs, didResolverErrs)
+
 	if len(errs) > 0 {
 		return nil, errs
 	}
@@ -66,5 +132,11 @@ func NewAPIConfig() (*APIConfig, types.ErrMap) {
 		ServiceDID:          &serviceDID,
 		FeedgenPublisherDID: feedgenPublisherDID,
 		APIPort:             apiPort,
+		Feeds:               feeds,
+		AdminToken:          adminToken,
+		AdminDIDs:           adminDIDs,
+		AuthMode:            authMode,
+		AuthClockSkew:       authClockSkew,
+		DIDResolver:         didResolverConfig,
 	}, nil
 }
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"time"
 
 	"github.com/aykhans/bsky-feedgen/pkg/types"
@@ -11,6 +12,14 @@ type ConsumerConfig struct {
 	PostMaxDate                         time.Duration
 	PostCollectionCutoffCronDelay       time.Duration
 	PostCollectionCutoffCronMaxDocument int64
+	Source                              types.ConsumerSource
+	// Ordered lists of hosts, the consumer fails over to the next host when the active one is unhealthy.
+	RelayHosts     []string
+	JetstreamHosts []string
+	// Path of the zstd dictionary used by Jetstream. Compression is disabled when empty.
+	JetstreamZstdDictionaryPath string
+	// The active host is considered stalled if it delivers no events for this duration.
+	SourceStallTimeout time.Duration
 }
 
 func NewConsumerConfig() (*ConsumerConfig, types.ErrMap) {
@@ -28,6 +37,40 @@ func NewConsumerConfig() (*ConsumerConfig, types.ErrMap) {
 		errs["POST_COLLECTION_CUTOFF_CRON_MAX_DOCUMENT"] = err
 	}
 
+	var source types.ConsumerSource
+	sourceValue, err := utils.GetEnvOr("CONSUMER_SOURCE", types.ConsumerSourceFirehose.String())
+	if err == nil {
+		err = source.Set(sourceValue)
+	}
+	if err != nil {
+		errs["CONSUMER_SOURCE"] = err
+	}
+	relayHosts, err := utils.GetEnvOr("RELAY_HOSTS", []string{"wss://bsky.network"})
+	if err != nil {
+		errs["RELAY_HOSTS"] = err
+	} else if len(relayHosts) == 0 {
+		errs["RELAY_HOSTS"] = errors.New("at least one relay host is required")
+	}
+	jetstreamHosts, err := utils.GetEnvOr(
+		"JETSTREAM_HOSTS",
+		[]string{"wss://jetstream1.us-east.bsky.network", "wss://jetstream2.us-east.bsky.network"},
+	)
+	if err != nil {
+		errs["JETSTREAM_HOSTS"] = err
+	} else if len(jetstreamHosts) == 0 {
+		errs["JETSTREAM_HOSTS"] = errors.New("at least one jetstream host is required")
+	}
+	jetstreamZstdDictionaryPath, err := utils.GetEnvOr("JETSTREAM_ZSTD_DICTIONARY", "")
+	if err != nil {
+		errs["JETSTREAM_ZSTD_DICTIONARY"] = err
+	}
+	sourceStallTimeout, err := utils.GetEnvOr("SOURCE_STALL_TIMEOUT", 25*time.Second)
+	if err != nil {
+		errs["SOURCE_STALL_TIMEOUT"] = err
+	} else if sourceStallTimeout < time.Second {
+		errs["SOURCE_STALL_TIMEOUT"] = errors.New("source stall timeout must be at least 1s")
+	}
+
 	if len(errs) > 0 {
 		return nil, errs
 	}
@@ -36,5 +79,10 @@ func NewConsumerConfig() (*ConsumerConfig, types.ErrMap) {
 		PostMaxDate:                         maxDate,
 		PostCollectionCutoffCronDelay:       cronDelay,
 		PostCollectionCutoffCronMaxDocument: cronMaxDocument,
+		Source:                              source,
+		RelayHosts:                          relayHosts,
+		JetstreamHosts:                      jetstreamHosts,
+		JetstreamZstdDictionaryPath:         jetstreamZstdDictionaryPath,
+		SourceStallTimeout:                  sourceStallTimeout,
 	}, nil
 }
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+	"github.com/aykhans/bsky-feedgen/pkg/utils"
+)
+
+// DIDResolverConfig configures how the API resolves the DIDs of the service JWT issuers.
+type DIDResolverConfig struct {
+	// Base URL of the PLC directory resolving did:plc DIDs
+	PLCURL string
+	// Maximum number of cached identities
+	CacheSize int
+	// How long resolved and failed identities are cached
+	CacheHitTTL time.Duration
+	CacheErrTTL time.Duration
+	// JSON file of DID documents resolved locally before the network, empty for none
+	DirectoryFile string
+	// Resolve only the DIDs of DirectoryFile, without any network requests
+	Offline bool
+}
+
+func NewDIDResolverConfig() (*DIDResolverConfig, types.ErrMap) {
+	errs := make(types.ErrMap)
+
+	defaultPLCURL, _ := url.Parse("https://plc.directory")
+	plcURL, err := utils.GetEnvOr("DID_PLC_URL", defaultPLCURL)
+	if err != nil {
+		errs["DID_PLC_URL"] = err
+	} else if (plcURL.Scheme != "http" && plcURL.Scheme != "https") || plcURL.Host == "" {
+		errs["DID_PLC_URL"] = errors.New("PLC URL must be an http or https URL")
+	}
+	cacheSize, err := utils.GetEnvOr("DID_CACHE_SIZE", 100_000)
+	if err != nil {
+		errs["DID_CACHE_SIZE"] = err
+	} else if cacheSize <= 0 {
+		errs["DID_CACHE_SIZE"] = errors.New("cache size must be greater than 0")
+	}
+	cacheHitTTL, err := utils.GetEnvOr("DID_CACHE_HIT_TTL", 24*time.Hour)
+	if err != nil {
+		errs["DID_CACHE_HIT_TTL"] = err
+	} else if cacheHitTTL <= 0 {
+		errs["DID_CACHE_HIT_TTL"] = errors.New("cache hit TTL must be greater than 0")
+	}
+	cacheErrTTL, err := utils.GetEnvOr("DID_CACHE_ERR_TTL", 5*time.Minute)
+	if err != nil {
+		errs["DID_CACHE_ERR_TTL"] = err
+	} else if cacheErrTTL <= 0 {
+		errs["DID_CACHE_ERR_TTL"] = errors.New("cache error TTL must be greater than 0")
+	}
+	directoryFile, err := utils.GetEnvOr("DID_DIRECTORY_FILE", "")
+	if err != nil {
+		errs["DID_DIRECTORY_FILE"] = err
+	}
+	offline, err := utils.GetEnvOr("DID_DIRECTORY_OFFLINE", false)
+	if err != nil {
+		errs["DID_DIRECTORY_OFFLINE"] = err
+	} else if offline && directoryFile == "" {
+		errs["DID_DIRECTORY_OFFLINE"] = errors.New("offline resolution requires DID_DIRECTORY_FILE")
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return &DIDResolverConfig{
+		PLCURL:        strings.TrimSuffix(plcURL.String(), "/"),
+		CacheSize:     cacheSize,
+		CacheHitTTL:   cacheHitTTL,
+		CacheErrTTL:   cacheErrTTL,
+		DirectoryFile: directoryFile,
+		Offline:       offline,
+	}, nil
+}
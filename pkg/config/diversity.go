@@ -0,0 +1,54 @@
+package config
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+	"github.com/aykhans/bsky-feedgen/pkg/utils"
+)
+
+// FeedDiversityConfig limits how much of a feed a single author can fill.
+// Every feed reads it from the environment variables with its own prefix, e.g. FEED_AZ_AUTHOR_MAX_POSTS.
+type FeedDiversityConfig struct {
+	// Maximum number of posts of an author added to the feed within AuthorWindow, 0 for no limit.
+	// Applied by the feedgen service when the posts are added to the feed.
+	AuthorMaxPosts int
+	AuthorWindow   time.Duration
+	// Maximum number of consecutive posts of an author in a page of the feed, 0 for no limit.
+	// Applied by the API service when the pages are served.
+	AuthorMaxConsecutive int
+}
+
+func NewFeedDiversityConfig(prefix string) (*FeedDiversityConfig, types.ErrMap) {
+	errs := make(types.ErrMap)
+
+	authorMaxPosts, err := utils.GetEnvOr(prefix+"_AUTHOR_MAX_POSTS", 0)
+	if err != nil {
+		errs[prefix+"_AUTHOR_MAX_POSTS"] = err
+	} else if authorMaxPosts < 0 {
+		errs[prefix+"_AUTHOR_MAX_POSTS"] = errors.New("author max posts must be at least 0")
+	}
+	authorWindow, err := utils.GetEnvOr(prefix+"_AUTHOR_WINDOW", 24*time.Hour)
+	if err != nil {
+		errs[prefix+"_AUTHOR_WINDOW"] = err
+	} else if authorWindow <= 0 {
+		errs[prefix+"_AUTHOR_WINDOW"] = errors.New("author window must be greater than 0")
+	}
+	authorMaxConsecutive, err := utils.GetEnvOr(prefix+"_AUTHOR_MAX_CONSECUTIVE", 0)
+	if err != nil {
+		errs[prefix+"_AUTHOR_MAX_CONSECUTIVE"] = err
+	} else if authorMaxConsecutive < 0 {
+		errs[prefix+"_AUTHOR_MAX_CONSECUTIVE"] = errors.New("author max consecutive must be at least 0")
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return &FeedDiversityConfig{
+		AuthorMaxPosts:       authorMaxPosts,
+		AuthorWindow:         authorWindow,
+		AuthorMaxConsecutive: authorMaxConsecutive,
+	}, nil
+}
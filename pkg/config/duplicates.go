@@ -0,0 +1,74 @@
+package config
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+	"github.com/aykhans/bsky-feedgen/pkg/utils"
+)
+
+// FeedDuplicatesConfig is the near-duplicate detection configuration of a single feed.
+// Every feed reads it from the environment variables with its own prefix, e.g. FEED_AZ_DUPLICATE_ACTION.
+type FeedDuplicatesConfig struct {
+	// What happens to a cluster of near-identical posts: nothing (off), it is only stored for
+	// inspection (flag), all of its posts are removed (drop), or only its first MaxPosts are kept (cap).
+	Action types.DuplicateAction
+	// Posts are compared with the posts created within this window before them.
+	Window time.Duration
+	// A cluster is flagged when its posts have at least this many different authors.
+	MinAuthors int
+	// Number of posts kept of a flagged cluster with the cap action.
+	MaxPosts int
+	// Maximum number of different bits of the fingerprints of near-identical posts (0-7).
+	MaxDistance int
+}
+
+func NewFeedDuplicatesConfig(prefix string) (*FeedDuplicatesConfig, types.ErrMap) {
+	errs := make(types.ErrMap)
+
+	var action types.DuplicateAction
+	actionValue, err := utils.GetEnvOr(prefix+"_DUPLICATE_ACTION", types.DuplicateActionOff.String())
+	if err == nil {
+		err = action.Set(actionValue)
+	}
+	if err != nil {
+		errs[prefix+"_DUPLICATE_ACTION"] = err
+	}
+	window, err := utils.GetEnvOr(prefix+"_DUPLICATE_WINDOW", 6*time.Hour)
+	if err != nil {
+		errs[prefix+"_DUPLICATE_WINDOW"] = err
+	} else if window <= 0 {
+		errs[prefix+"_DUPLICATE_WINDOW"] = errors.New("window must be greater than 0")
+	}
+	minAuthors, err := utils.GetEnvOr(prefix+"_DUPLICATE_MIN_AUTHORS", 3)
+	if err != nil {
+		errs[prefix+"_DUPLICATE_MIN_AUTHORS"] = err
+	} else if minAuthors < 2 {
+		errs[prefix+"_DUPLICATE_MIN_AUTHORS"] = errors.New("min authors must be at least 2")
+	}
+	maxPosts, err := utils.GetEnvOr(prefix+"_DUPLICATE_MAX_POSTS", 1)
+	if err != nil {
+		errs[prefix+"_DUPLICATE_MAX_POSTS"] = err
+	} else if maxPosts < 1 {
+		errs[prefix+"_DUPLICATE_MAX_POSTS"] = errors.New("max posts must be at least 1")
+	}
+	maxDistance, err := utils.GetEnvOr(prefix+"_DUPLICATE_MAX_DISTANCE", 6)
+	if err != nil {
+		errs[prefix+"_DUPLICATE_MAX_DISTANCE"] = err
+	} else if maxDistance < 0 || maxDistance > 7 {
+		errs[prefix+"_DUPLICATE_MAX_DISTANCE"] = errors.New("max distance must be between 0 and 7")
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return &FeedDuplicatesConfig{
+		Action:      action,
+		Window:      window,
+		MinAuthors:  minAuthors,
+		MaxPosts:    maxPosts,
+		MaxDistance: maxDistance,
+	}, nil
+}
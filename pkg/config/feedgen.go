@@ -1,40 +1,185 @@
 package config
 
 import (
+	"errors"
+	"maps"
+	"strings"
 	"time"
 
 	"github.com/aykhans/bsky-feedgen/pkg/types"
 	"github.com/aykhans/bsky-feedgen/pkg/utils"
 )
 
-type FeedGenAzConfig struct {
+// FeedConfig is the configuration of a generator's feed that is shared by the feedgen and API services.
+// It is read from the FEED_<GENERATOR NAME>_* environment variables, e.g. FEED_AZ_RULES.
+type FeedConfig struct {
+	GeneratorName string
+	// Path of the JSON feed definition. The generator's built-in definition is used when empty.
+	RulesPath string
+	Ranking   *FeedRankingConfig
+	Diversity *FeedDiversityConfig
+}
+
+func NewFeedConfig(generatorName string) (*FeedConfig, types.ErrMap) {
+	errs := make(types.ErrMap)
+	prefix := FeedEnvPrefix(generatorName)
+
+	rulesPath, err := utils.GetEnvOr(prefix+"_RULES", "")
+	if err != nil {
+		errs[prefix+"_RULES"] = err
+	}
+	ranking, rankingErrs := NewFeedRankingConfig(prefix)
+	maps.Copy(errs, rankingErrs)
+	diversity, diversityErrs := NewFeedDiversityConfig(prefix)
+	maps.Copy(errs, diversityErrs)
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return &FeedConfig{
+		GeneratorName: generatorName,
+		RulesPath:     rulesPath,
+		Ranking:       ranking,
+		Diversity:     diversity,
+	}, nil
+}
+
+// GeneratorConfig is the configuration of a generator in the feedgen service.
+type GeneratorConfig struct {
+	*FeedConfig
 	CollectionMaxDocument int64
 	GeneratorCronDelay    time.Duration
 	CutoffCronDelay       time.Duration
+	// Number of selected posts inserted into the feed collection at once.
+	BatchSize int
+	// Interval of reloading the stored author lists of the feed.
+	AuthorsReloadCronDelay time.Duration
+	Duplicates             *FeedDuplicatesConfig
+}
+
+func NewGeneratorConfig(generatorName string) (*GeneratorConfig, types.ErrMap) {
+	errs := make(types.ErrMap)
+	prefix := FeedEnvPrefix(generatorName)
+
+	feedConfig, feedErrs := NewFeedConfig(generatorName)
+	maps.Copy(errs, feedErrs)
+
+	maxDocument, err := utils.GetEnv[int64](prefix + "_COLLECTION_CUTOFF_CRON_MAX_DOCUMENT")
+	if err != nil {
+		errs[prefix+"_COLLECTION_CUTOFF_CRON_MAX_DOCUMENT"] = err
+	}
+	generatorCronDelay, err := utils.GetEnv[time.Duration](prefix + "_GENERATER_CRON_DELAY")
+	if err != nil {
+		errs[prefix+"_GENERATER_CRON_DELAY"] = err
+	}
+	cutoffCronDelay, err := utils.GetEnv[time.Duration](prefix + "_COLLECTION_CUTOFF_CRON_DELAY")
+	if err != nil {
+		errs[prefix+"_COLLECTION_CUTOFF_CRON_DELAY"] = err
+	}
+	batchSize, err := utils.GetEnvOr(prefix+"_GENERATER_BATCH_SIZE", 100)
+	if err != nil {
+		errs[prefix+"_GENERATER_BATCH_SIZE"] = err
+	} else if batchSize <= 0 {
+		errs[prefix+"_GENERATER_BATCH_SIZE"] = errors.New("batch size must be greater than 0")
+	}
+	authorsReloadCronDelay, err := utils.GetEnvOr(prefix+"_AUTHORS_RELOAD_CRON_DELAY", time.Minute)
+	if err != nil {
+		errs[prefix+"_AUTHORS_RELOAD_CRON_DELAY"] = err
+	}
+	duplicates, duplicatesErrs := NewFeedDuplicatesConfig(prefix)
+	maps.Copy(errs, duplicatesErrs)
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return &GeneratorConfig{
+		FeedConfig:             feedConfig,
+		CollectionMaxDocument:  maxDocument,
+		GeneratorCronDelay:     generatorCronDelay,
+		CutoffCronDelay:        cutoffCronDelay,
+		BatchSize:              batchSize,
+		AuthorsReloadCronDelay: authorsReloadCronDelay,
+		Duplicates:             duplicates,
+	}, nil
+}
+
+type FeedGenConfig struct {
+	Generators []*GeneratorConfig
+	// cron runs the generators every FEED_<NAME>_GENERATER_CRON_DELAY, stream evaluates the posts as they are stored.
+	Mode types.FeedgenMode
+	// Maximum time the posts received in stream mode are held before they are inserted into the feeds.
+	StreamFlushDelay time.Duration
+	// Interval of polling the tasks requested with the admin API.
+	TaskCronDelay time.Duration
+	// Generator stats, tasks and duplicate clusters older than this are deleted.
+	StatMaxDate time.Duration
 }
 
-func NewFeedGenAzConfig() (*FeedGenAzConfig, types.ErrMap) {
+func NewFeedGenConfig() (*FeedGenConfig, types.ErrMap) {
 	errs := make(types.ErrMap)
-	maxDocument, err := utils.GetEnv[int64]("FEED_AZ_COLLECTION_CUTOFF_CRON_MAX_DOCUMENT")
+
+	generatorNames, err := getGeneratorNames()
 	if err != nil {
-		errs["FEED_AZ_COLLECTION_CUTOFF_CRON_MAX_DOCUMENT"] = err
+		errs["FEEDGEN_GENERATORS"] = err
 	}
-	generatorCronDelay, err := utils.GetEnv[time.Duration]("FEED_AZ_GENERATER_CRON_DELAY")
+
+	generators := make([]*GeneratorConfig, 0, len(generatorNames))
+	for _, generatorName := range generatorNames {
+		generatorConfig, generatorErrs := NewGeneratorConfig(generatorName)
+		maps.Copy(errs, generatorErrs)
+		generators = append(generators, generatorConfig)
+	}
+
+	var mode types.FeedgenMode
+	modeValue, err := utils.GetEnvOr("FEEDGEN_MODE", types.FeedgenModeCron.String())
+	if err == nil {
+		err = mode.Set(modeValue)
+	}
+	if err != nil {
+		errs["FEEDGEN_MODE"] = err
+	}
+	streamFlushDelay, err := utils.GetEnvOr("FEEDGEN_STREAM_FLUSH_DELAY", time.Second)
 	if err != nil {
-		errs["FEED_AZ_GENERATER_CRON_DELAY"] = err
+		errs["FEEDGEN_STREAM_FLUSH_DELAY"] = err
 	}
-	cutoffCronDelay, err := utils.GetEnv[time.Duration]("FEED_AZ_COLLECTION_CUTOFF_CRON_DELAY")
+	taskCronDelay, err := utils.GetEnvOr("FEEDGEN_TASK_CRON_DELAY", 10*time.Second)
 	if err != nil {
-		errs["FEED_AZ_COLLECTION_CUTOFF_CRON_DELAY"] = err
+		errs["FEEDGEN_TASK_CRON_DELAY"] = err
+	}
+	statMaxDate, err := utils.GetEnvOr("FEEDGEN_STAT_MAX_DATE", 7*24*time.Hour)
+	if err != nil {
+		errs["FEEDGEN_STAT_MAX_DATE"] = err
 	}
 
 	if len(errs) > 0 {
 		return nil, errs
 	}
 
-	return &FeedGenAzConfig{
-		CollectionMaxDocument: maxDocument,
-		GeneratorCronDelay:    generatorCronDelay,
-		CutoffCronDelay:       cutoffCronDelay,
+	return &FeedGenConfig{
+		Generators:       generators,
+		Mode:             mode,
+		StreamFlushDelay: streamFlushDelay,
+		TaskCronDelay:    taskCronDelay,
+		StatMaxDate:      statMaxDate,
 	}, nil
 }
+
+// FeedEnvPrefix returns the environment variable prefix of a generator, e.g. FEED_AZ.
+func FeedEnvPrefix(generatorName string) string {
+	return "FEED_" + strings.ToUpper(strings.ReplaceAll(generatorName, "-", "_"))
+}
+
+// getGeneratorNames returns the names of the enabled generators.
+func getGeneratorNames() ([]string, error) {
+	generatorNames, err := utils.GetEnvOr("FEEDGEN_GENERATORS", []string{"az"})
+	if err != nil {
+		return nil, err
+	}
+	if len(generatorNames) == 0 {
+		return nil, errors.New("at least one generator is required")
+	}
+
+	return generatorNames, nil
+}
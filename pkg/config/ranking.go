@@ -0,0 +1,101 @@
+package config
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+	"github.com/aykhans/bsky-feedgen/pkg/utils"
+)
+
+// FeedRankingConfig is the ranking configuration of a single feed.
+// Every feed reads it from the environment variables with its own prefix, e.g. FEED_AZ_RANKING.
+type FeedRankingConfig struct {
+	Algorithm types.FeedRanking
+	// Exponent of the time decay of the hot score, higher values favor newer posts.
+	Gravity float64
+	// Multiplier applied to the score of every further post of the same author (0-1].
+	AuthorPenalty float64
+	// Multiplier applied to the score of the posts of reply-heavy authors (0-1], 1 to disable.
+	ReplyPenalty float64
+	// Authors are reply-heavy when at least this share of their ranked posts are replies (0-1].
+	ReplyHeavyRatio float64
+	// Engagement within this window counts twice, as a measure of velocity.
+	VelocityWindow time.Duration
+	// Only posts created within this window are ranked.
+	Window time.Duration
+	// Maximum number of ranked posts stored for the feed.
+	MaxItems  int64
+	CronDelay time.Duration
+}
+
+func NewFeedRankingConfig(prefix string) (*FeedRankingConfig, types.ErrMap) {
+	errs := make(types.ErrMap)
+
+	var algorithm types.FeedRanking
+	algorithmValue, err := utils.GetEnvOr(prefix+"_RANKING", types.FeedRankingLatest.String())
+	if err == nil {
+		err = algorithm.Set(algorithmValue)
+	}
+	if err != nil {
+		errs[prefix+"_RANKING"] = err
+	}
+	gravity, err := utils.GetEnvOr(prefix+"_RANKING_GRAVITY", 1.8)
+	if err != nil {
+		errs[prefix+"_RANKING_GRAVITY"] = err
+	} else if gravity <= 0 {
+		errs[prefix+"_RANKING_GRAVITY"] = errors.New("gravity must be greater than 0")
+	}
+	authorPenalty, err := utils.GetEnvOr(prefix+"_RANKING_AUTHOR_PENALTY", 0.7)
+	if err != nil {
+		errs[prefix+"_RANKING_AUTHOR_PENALTY"] = err
+	} else if authorPenalty <= 0 || authorPenalty > 1 {
+		errs[prefix+"_RANKING_AUTHOR_PENALTY"] = errors.New("author penalty must be greater than 0 and at most 1")
+	}
+	replyPenalty, err := utils.GetEnvOr(prefix+"_RANKING_REPLY_PENALTY", 1.0)
+	if err != nil {
+		errs[prefix+"_RANKING_REPLY_PENALTY"] = err
+	} else if replyPenalty <= 0 || replyPenalty > 1 {
+		errs[prefix+"_RANKING_REPLY_PENALTY"] = errors.New("reply penalty must be greater than 0 and at most 1")
+	}
+	replyHeavyRatio, err := utils.GetEnvOr(prefix+"_RANKING_REPLY_HEAVY_RATIO", 0.5)
+	if err != nil {
+		errs[prefix+"_RANKING_REPLY_HEAVY_RATIO"] = err
+	} else if replyHeavyRatio <= 0 || replyHeavyRatio > 1 {
+		errs[prefix+"_RANKING_REPLY_HEAVY_RATIO"] = errors.New("reply heavy ratio must be greater than 0 and at most 1")
+	}
+	velocityWindow, err := utils.GetEnvOr(prefix+"_RANKING_VELOCITY_WINDOW", 3*time.Hour)
+	if err != nil {
+		errs[prefix+"_RANKING_VELOCITY_WINDOW"] = err
+	}
+	window, err := utils.GetEnvOr(prefix+"_RANKING_WINDOW", 48*time.Hour)
+	if err != nil {
+		errs[prefix+"_RANKING_WINDOW"] = err
+	}
+	maxItems, err := utils.GetEnvOr[int64](prefix+"_RANKING_MAX_ITEMS", 1000)
+	if err != nil {
+		errs[prefix+"_RANKING_MAX_ITEMS"] = err
+	} else if maxItems <= 0 {
+		errs[prefix+"_RANKING_MAX_ITEMS"] = errors.New("max items must be greater than 0")
+	}
+	cronDelay, err := utils.GetEnvOr(prefix+"_RANKING_CRON_DELAY", 5*time.Minute)
+	if err != nil {
+		errs[prefix+"_RANKING_CRON_DELAY"] = err
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return &FeedRankingConfig{
+		Algorithm:       algorithm,
+		Gravity:         gravity,
+		AuthorPenalty:   authorPenalty,
+		ReplyPenalty:    replyPenalty,
+		ReplyHeavyRatio: replyHeavyRatio,
+		VelocityWindow:  velocityWindow,
+		Window:          window,
+		MaxItems:        maxItems,
+		CronDelay:       cronDelay,
+	}, nil
+}
@@ -7,13 +7,14 @@ package consumer
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
 	"time"
 
+	"github.com/aykhans/bsky-feedgen/pkg/langid"
 	"github.com/aykhans/bsky-feedgen/pkg/logger"
 	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
 	"github.com/aykhans/bsky-feedgen/pkg/types"
@@ -35,16 +36,50 @@ type CallbackData struct {
 	Sequence  int64
 	DID       syntax.DID
 	RecordKey syntax.RecordKey
-	Post      bsky.FeedPost
+	Action    repomgr.EventKind
+	Source    string // Name of the source that delivered the event
+
+	// Unordered events may be delivered before events with lower sequences, so their sequence is
+	// not a safe cursor. Sources delivering unordered events report the safe cursor with
+	// Checkpoint events, which carry no record: every event up to their sequence was delivered.
+	Unordered  bool
+	Checkpoint bool
+
+	// Collection is the NSID of the record. Only one of the record fields below is set,
+	// and none of them for delete actions.
+	Collection string
+	Post       bsky.FeedPost
+	Like       *bsky.FeedLike
+	Repost     *bsky.FeedRepost
+	Block      *bsky.GraphBlock
+
+	// Account and Identity are set for #account and #identity events, which carry no record.
+	Account  *comatproto.SyncSubscribeRepos_Account
+	Identity *comatproto.SyncSubscribeRepos_Identity
 }
 
-type CallbackFunc func(int64, syntax.DID, syntax.RecordKey, bsky.FeedPost)
+type CallbackFunc func(CallbackData)
+
+// FeedCollection is a feed storage that has to drop its references to posts deleted by their authors
+// and hide the posts of inactive accounts.
+type FeedCollection interface {
+	DeleteByIDs(ctx context.Context, ids ...string) (int64, error)
+	DeleteByDIDs(ctx context.Context, dids ...string) (int64, error)
+	SetHiddenByDIDs(ctx context.Context, hidden bool, dids ...string) (int64, error)
+}
+
+var (
+	_ FeedCollection = (*collections.FeedCollection)(nil)
+	_ FeedCollection = (*collections.FeedRankedCollection)(nil)
+	_ FeedCollection = (*collections.FeedModerationCollection)(nil)
+)
 
 func RunFirehoseConsumer(
 	ctx context.Context,
 	relayHost string,
 	callbackFunc CallbackFunc,
 	cursor *int64,
+	recorder *Recorder, // optional
 ) error {
 	dialer := websocket.DefaultDialer
 	u, err := url.Parse(relayHost)
@@ -60,32 +95,53 @@ func RunFirehoseConsumer(
 	}
 
 	logger.Log.Info("subscribing to repo event stream", "upstream", relayHost)
-	con, _, err := dialer.Dial(u.String(), http.Header{
+	con, _, err := dialer.DialContext(ctx, u.String(), http.Header{
 		"User-Agent": []string{"Firehose-Consumer"},
 	})
 	if err != nil {
 		return fmt.Errorf("subscribing to firehose failed (dialing): %w", err)
 	}
 
+	// The workers of the scheduler deliver the events of different repos out of order,
+	// so the cursor is only reported by the Checkpoint events of the tracker
+	tracker := newSequenceTracker()
+	unorderedCallback := func(data CallbackData) {
+		data.Unordered = true
+		callbackFunc(data)
+	}
+
 	rsc := &events.RepoStreamCallbacks{
 		RepoCommit: func(evt *comatproto.SyncSubscribeRepos_Commit) error {
-			return HandleRepoCommit(ctx, evt, callbackFunc)
+			return HandleRepoCommit(ctx, evt, unorderedCallback)
+		},
+		RepoAccount: func(evt *comatproto.SyncSubscribeRepos_Account) error {
+			return HandleRepoAccount(evt, unorderedCallback)
+		},
+		RepoIdentity: func(evt *comatproto.SyncSubscribeRepos_Identity) error {
+			return HandleRepoIdentity(evt, unorderedCallback)
 		},
 	}
 
 	var scheduler events.Scheduler
 	parallelism := 8
-	scheduler = parallel.NewScheduler(
-		parallelism,
-		100_000,
-		relayHost,
-		rsc.EventHandler,
-	)
+	scheduler = &trackingScheduler{
+		Scheduler: parallel.NewScheduler(
+			parallelism,
+			100_000,
+			relayHost,
+			trackedHandler(tracker, rsc.EventHandler, callbackFunc),
+		),
+		tracker: tracker,
+	}
+	// The events are recorded as they are dispatched, so the recording is in stream order
+	if recorder != nil {
+		scheduler = &recordingScheduler{Scheduler: scheduler, recorder: recorder}
+	}
 	logger.Log.Info("firehose scheduler configured", "workers", parallelism)
 
 	err = events.HandleRepoStream(ctx, con, scheduler, logger.Log)
 	if err != nil {
-		return fmt.Errorf("repoStream error: %v", err)
+		return fmt.Errorf("%w: repoStream error: %v", ErrStream, err)
 	}
 	return nil
 }
@@ -136,14 +192,52 @@ func HandleRepoCommit(
 				continue
 			}
 
+			data := CallbackData{
+				Sequence:   evt.Seq,
+				DID:        did,
+				RecordKey:  rkey,
+				Action:     ek,
+				Collection: collection.String(),
+			}
+
 			switch collection {
 			case "app.bsky.feed.post":
-				var post bsky.FeedPost
-				if err := post.UnmarshalCBOR(bytes.NewReader(*recordCBOR)); err != nil {
+				if err := data.Post.UnmarshalCBOR(bytes.NewReader(*recordCBOR)); err != nil {
 					localLogger.Error("failed to parse app.bsky.feed.post record", "err", err)
 					continue
 				}
-				postCallback(evt.Seq, did, rkey, post)
+			case "app.bsky.feed.like":
+				data.Like = &bsky.FeedLike{}
+				if err := data.Like.UnmarshalCBOR(bytes.NewReader(*recordCBOR)); err != nil {
+					localLogger.Error("failed to parse app.bsky.feed.like record", "err", err)
+					continue
+				}
+			case "app.bsky.feed.repost":
+				data.Repost = &bsky.FeedRepost{}
+				if err := data.Repost.UnmarshalCBOR(bytes.NewReader(*recordCBOR)); err != nil {
+					localLogger.Error("failed to parse app.bsky.feed.repost record", "err", err)
+					continue
+				}
+			case "app.bsky.graph.block":
+				data.Block = &bsky.GraphBlock{}
+				if err := data.Block.UnmarshalCBOR(bytes.NewReader(*recordCBOR)); err != nil {
+					localLogger.Error("failed to parse app.bsky.graph.block record", "err", err)
+					continue
+				}
+			default:
+				continue
+			}
+			postCallback(data)
+		case repomgr.EvtKindDeleteRecord:
+			switch collection {
+			case "app.bsky.feed.post", "app.bsky.feed.like", "app.bsky.feed.repost", "app.bsky.graph.block":
+				postCallback(CallbackData{
+					Sequence:   evt.Seq,
+					DID:        did,
+					RecordKey:  rkey,
+					Action:     ek,
+					Collection: collection.String(),
+				})
 			}
 		}
 	}
@@ -151,10 +245,94 @@ func HandleRepoCommit(
 	return nil
 }
 
+func HandleRepoAccount(evt *comatproto.SyncSubscribeRepos_Account, callbackFunc CallbackFunc) error {
+	did, err := syntax.ParseDID(evt.Did)
+	if err != nil {
+		logger.Log.Error("bad DID syntax in event", "event", "account", "did", evt.Did, "seq", evt.Seq, "err", err)
+		return nil
+	}
+
+	callbackFunc(CallbackData{
+		Sequence: evt.Seq,
+		DID:      did,
+		Account:  evt,
+	})
+	return nil
+}
+
+func HandleRepoIdentity(evt *comatproto.SyncSubscribeRepos_Identity, callbackFunc CallbackFunc) error {
+	did, err := syntax.ParseDID(evt.Did)
+	if err != nil {
+		logger.Log.Error("bad DID syntax in event", "event", "identity", "did", evt.Did, "seq", evt.Seq, "err", err)
+		return nil
+	}
+
+	callbackFunc(CallbackData{
+		Sequence: evt.Seq,
+		DID:      did,
+		Identity: evt,
+	})
+	return nil
+}
+
+// NewPost returns the stored post of a post record event, with the detected language of its text.
+func NewPost(data CallbackData) *collections.Post {
+	facets := &collections.Facets{}
+	for _, facet := range data.Post.Facets {
+		for _, feature := range facet.Features {
+			if feature.RichtextFacet_Mention != nil {
+				facets.Mentions = append(facets.Mentions, feature.RichtextFacet_Mention.Did)
+			}
+			if feature.RichtextFacet_Link != nil {
+				facets.Links = append(facets.Links, feature.RichtextFacet_Link.Uri)
+			}
+			if feature.RichtextFacet_Tag != nil {
+				facets.Tags = append(facets.Tags, feature.RichtextFacet_Tag.Tag)
+			}
+		}
+	}
+
+	reply := &collections.Reply{}
+	if data.Post.Reply != nil {
+		if data.Post.Reply.Root != nil {
+			reply.RootURI = data.Post.Reply.Root.Uri
+		}
+		if data.Post.Reply.Parent != nil {
+			reply.ParentURI = data.Post.Reply.Parent.Uri
+		}
+	}
+
+	createdAt, _ := time.Parse(time.RFC3339, data.Post.CreatedAt)
+	detectedLang := langid.Detect(data.Post.Text)
+	return &collections.Post{
+		ID:        fmt.Sprintf("%s/%s", data.DID, data.RecordKey),
+		Sequence:  data.Sequence,
+		DID:       data.DID.String(),
+		RecordKey: data.RecordKey.String(),
+		CreatedAt: createdAt,
+		Langs:     data.Post.Langs,
+		Tags:      data.Post.Tags,
+		Text:      data.Post.Text,
+		Facets:    facets,
+		Reply:     reply,
+		Embed:     newEmbed(data.Post.Embed),
+
+		DetectedLang:           detectedLang.Lang,
+		DetectedLangConfidence: detectedLang.Confidence,
+	}
+}
+
 func ConsumeAndSaveToMongoDB(
 	ctx context.Context,
 	postCollection *collections.PostCollection,
-	relayHost string,
+	postTombstoneCollection *collections.PostTombstoneCollection,
+	accountCollection *collections.AccountCollection,
+	engagementCollection *collections.EngagementCollection,
+	engagementRecordCollection *collections.EngagementRecordCollection,
+	blockCollection *collections.BlockCollection,
+	consumerCheckpointCollection *collections.ConsumerCheckpointCollection,
+	feedCollections []FeedCollection,
+	source Source,
 	cursorOption types.ConsumerCursor,
 	oldestPostDuration time.Duration,
 	batchFlushTime time.Duration,
@@ -167,48 +345,187 @@ func ConsumeAndSaveToMongoDB(
 	switch cursorOption {
 	case types.ConsumerCursorLastConsumed:
 		var err error
-		sequenceCursor, err = postCollection.GetMaxSequence(ctx)
+		sequenceCursor, err = consumerCheckpointCollection.GetCursor(ctx, source.Name())
 		if err != nil {
 			return err
 		}
+		if sequenceCursor == nil {
+			logger.Log.Info("no checkpoint found, starting from the current stream", "source", source.Name())
+		}
 	case types.ConsumerCursorFirstStream:
 		sequenceCursor = utils.ToPtr[int64](0)
 	case types.ConsumerCursorCurrentStream:
 		sequenceCursor = nil
 	}
 
-	consumerLastFlushingTime := time.Now()
+	var sourceErr error
 	go func() {
 		defer cancel()
-		for {
-			err := RunFirehoseConsumer(
-				localCtx,
-				relayHost,
-				func(sequence int64, did syntax.DID, recordKey syntax.RecordKey, post bsky.FeedPost) {
-					firehoseDataChan <- CallbackData{sequence, did, recordKey, post}
-				},
-				sequenceCursor,
-			)
-
-			if err != nil {
-				if localCtx.Err() != nil {
-					break
+		sourceErr = source.Run(
+			localCtx,
+			func(data CallbackData) {
+				if data.Source == "" {
+					data.Source = source.Name()
 				}
-				logger.Log.Error(err.Error())
-				if !strings.HasPrefix(err.Error(), "repoStream error") {
-					break
+				firehoseDataChan <- data
+			},
+			sequenceCursor,
+		)
+	}()
+
+	postBatch := []*collections.Post{}
+	tombstoneBatch := []*collections.PostTombstone{}
+	engagementBatch := []*collections.EngagementRecord{}
+	deletedEngagementBatch := []string{} // IDs of deleted engagement records
+	blockBatch := []*collections.Block{}
+	deletedBlockBatch := []string{}                   // IDs of deleted blocks
+	accountBatch := map[string]*collections.Account{} // Latest status per DID
+	handleBatch := map[string]string{}                // Latest handle per DID
+	batchCursors := map[string]int64{}                // Highest safe cursor of the batch per source
+
+	addToBatch := func(data CallbackData) {
+		if !data.Unordered && data.Sequence > batchCursors[data.Source] {
+			batchCursors[data.Source] = data.Sequence
+		}
+		if data.Checkpoint {
+			return
+		}
+
+		if data.Account != nil {
+			did := data.DID.String()
+			if existing, ok := accountBatch[did]; !ok || existing.Sequence < data.Sequence {
+				accountBatch[did] = &collections.Account{
+					ID:        did,
+					Active:    data.Account.Active,
+					Status:    utils.FromPtr(data.Account.Status),
+					Sequence:  data.Sequence,
+					UpdatedAt: time.Now().UTC(),
 				}
 			}
+			return
+		}
 
-			sequenceCursor, err = postCollection.GetMaxSequence(ctx)
-			if err != nil {
-				logger.Log.Error(err.Error())
-				break
+		if data.Identity != nil {
+			if data.Identity.Handle != nil {
+				handleBatch[data.DID.String()] = *data.Identity.Handle
 			}
+			return
 		}
-	}()
 
-	postBatch := []*collections.Post{}
+		if data.Collection == "app.bsky.graph.block" {
+			id := fmt.Sprintf("%s/%s", data.DID, data.RecordKey)
+			if data.Action == repomgr.EvtKindDeleteRecord {
+				deletedBlockBatch = append(deletedBlockBatch, id)
+				return
+			}
+			if _, err := syntax.ParseDID(data.Block.Subject); err != nil {
+				return
+			}
+			createdAt, _ := time.Parse(time.RFC3339, data.Block.CreatedAt)
+			blockBatch = append(blockBatch, &collections.Block{
+				ID:        id,
+				DID:       data.DID.String(),
+				Subject:   data.Block.Subject,
+				CreatedAt: createdAt,
+			})
+			return
+		}
+
+		if data.Action == repomgr.EvtKindDeleteRecord {
+			// Every deleted like, repost and post may have been counted as engagement
+			deletedEngagementBatch = append(deletedEngagementBatch, engagementRecordID(data))
+			if data.Collection != "app.bsky.feed.post" {
+				return
+			}
+			tombstoneBatch = append(tombstoneBatch, &collections.PostTombstone{
+				ID:        fmt.Sprintf("%s/%s", data.DID, data.RecordKey),
+				Sequence:  data.Sequence,
+				DID:       data.DID.String(),
+				RecordKey: data.RecordKey.String(),
+				DeletedAt: time.Now().UTC(),
+			})
+			return
+		}
+
+		// Updated records were already counted when they were created
+		if data.Action == repomgr.EvtKindCreateRecord {
+			if record := newEngagementRecord(data); record != nil {
+				engagementBatch = append(engagementBatch, record)
+			}
+		}
+		if data.Collection != "app.bsky.feed.post" {
+			return
+		}
+
+		createdAt, _ := time.Parse(time.RFC3339, data.Post.CreatedAt)
+		if createdAt.After(time.Now().UTC().Add(-oldestPostDuration)) {
+			postBatch = append(postBatch, NewPost(data))
+		}
+	}
+
+	flushBatch := func() error {
+		if len(batchCursors) == 0 {
+			return nil
+		}
+
+		// logger.Log.Info("flushing post batch", "count", len(postBatch))
+		err := postCollection.Insert(ctx, true, postBatch...)
+		if err != nil {
+			return fmt.Errorf("mongodb post insert error: %v", err)
+		}
+		postBatch = []*collections.Post{} // Clear batch after insert
+
+		err = updateEngagement(
+			ctx,
+			postCollection,
+			engagementCollection,
+			engagementRecordCollection,
+			engagementBatch,
+			deletedEngagementBatch,
+		)
+		if err != nil {
+			return fmt.Errorf("mongodb engagement update error: %v", err)
+		}
+		engagementBatch = []*collections.EngagementRecord{}
+		deletedEngagementBatch = []string{}
+
+		err = blockCollection.Insert(ctx, blockBatch...)
+		if err != nil {
+			return fmt.Errorf("mongodb block insert error: %v", err)
+		}
+		blockBatch = []*collections.Block{}
+		_, err = blockCollection.DeleteByIDs(ctx, deletedBlockBatch...)
+		if err != nil {
+			return fmt.Errorf("mongodb block delete error: %v", err)
+		}
+		deletedBlockBatch = []string{}
+
+		// Deletions are applied after the inserts so a post created and deleted
+		// within the same batch doesn't survive.
+		err = deletePosts(ctx, postCollection, postTombstoneCollection, engagementCollection, feedCollections, tombstoneBatch)
+		if err != nil {
+			return fmt.Errorf("mongodb post delete error: %v", err)
+		}
+		tombstoneBatch = []*collections.PostTombstone{}
+
+		// Account statuses are applied last, so the posts inserted above are hidden as well
+		err = updateAccounts(ctx, postCollection, accountCollection, feedCollections, accountBatch, handleBatch)
+		if err != nil {
+			return fmt.Errorf("mongodb account update error: %v", err)
+		}
+		accountBatch = map[string]*collections.Account{}
+		handleBatch = map[string]string{}
+
+		// The batch is fully processed, so its cursors are safe to resume from
+		err = consumerCheckpointCollection.Save(ctx, batchCursors)
+		if err != nil {
+			return fmt.Errorf("mongodb consumer checkpoint save error: %v", err)
+		}
+		batchCursors = map[string]int64{}
+
+		return nil
+	}
+
 	ticker := time.NewTicker(batchFlushTime)
 	defer ticker.Stop()
 
@@ -219,67 +536,187 @@ func ConsumeAndSaveToMongoDB(
 			return nil
 
 		case <-localCtx.Done():
-			logger.Log.Error("inactive firehose consumer error")
-			return nil
-
-		case data := <-firehoseDataChan:
-			facets := &collections.Facets{}
-			for _, facet := range data.Post.Facets {
-				for _, feature := range facet.Features {
-					if feature.RichtextFacet_Mention != nil {
-						facets.Mentions = append(facets.Mentions, feature.RichtextFacet_Mention.Did)
-					}
-					if feature.RichtextFacet_Link != nil {
-						facets.Links = append(facets.Links, feature.RichtextFacet_Link.Uri)
-					}
-					if feature.RichtextFacet_Tag != nil {
-						facets.Tags = append(facets.Tags, feature.RichtextFacet_Tag.Tag)
-					}
+			// The source stopped on its own, save what it has already delivered
+			for drained := false; !drained; {
+				select {
+				case data := <-firehoseDataChan:
+					addToBatch(data)
+				default:
+					drained = true
 				}
 			}
-
-			reply := &collections.Reply{}
-			if data.Post.Reply != nil {
-				if data.Post.Reply.Root != nil {
-					reply.RootURI = data.Post.Reply.Root.Uri
-				}
-				if data.Post.Reply.Parent != nil {
-					reply.ParentURI = data.Post.Reply.Parent.Uri
-				}
+			if err := flushBatch(); err != nil {
+				return err
 			}
 
-			createdAt, _ := time.Parse(time.RFC3339, data.Post.CreatedAt)
-			if createdAt.After(time.Now().UTC().Add(-oldestPostDuration)) {
-				postItem := &collections.Post{
-					ID:        fmt.Sprintf("%s/%s", data.DID, data.RecordKey),
-					Sequence:  data.Sequence,
-					DID:       data.DID.String(),
-					RecordKey: data.RecordKey.String(),
-					CreatedAt: createdAt,
-					Langs:     data.Post.Langs,
-					Tags:      data.Post.Tags,
-					Text:      data.Post.Text,
-					Facets:    facets,
-					Reply:     reply,
-				}
-				postBatch = append(postBatch, postItem)
+			if sourceErr == nil || errors.Is(sourceErr, ErrSourceExhausted) {
+				logger.Log.Info("consumer source finished", "source", source.Name())
+				return nil
 			}
+			logger.Log.Error("consumer source stopped", "source", source.Name(), "error", sourceErr)
+			return nil
+
+		case data := <-firehoseDataChan:
+			addToBatch(data)
 
 		case <-ticker.C:
-			if len(postBatch) > 0 {
-				consumerLastFlushingTime = time.Now()
-				// logger.Log.Info("flushing post batch", "count", len(postBatch))
-				err := postCollection.Insert(ctx, true, postBatch...)
-				if err != nil {
-					return fmt.Errorf("mongodb post insert error: %v", err)
-				}
-				postBatch = []*collections.Post{} // Clear batch after insert
-			} else {
-				// If we haven't seen any data for 25 seconds, cancel the consumer connection
-				if consumerLastFlushingTime.Add(time.Second * 25).Before(time.Now()) {
-					cancel()
-				}
+			if err := flushBatch(); err != nil {
+				return err
 			}
 		}
 	}
 }
+
+// deletePosts persists the tombstones and removes the deleted posts from the post collection,
+// the engagement collection and every feed collection.
+func deletePosts(
+	ctx context.Context,
+	postCollection *collections.PostCollection,
+	postTombstoneCollection *collections.PostTombstoneCollection,
+	engagementCollection *collections.EngagementCollection,
+	feedCollections []FeedCollection,
+	tombstones []*collections.PostTombstone,
+) error {
+	if len(tombstones) == 0 {
+		return nil
+	}
+
+	if err := postTombstoneCollection.Insert(ctx, tombstones...); err != nil {
+		return err
+	}
+
+	ids := make([]string, len(tombstones))
+	for i, tombstone := range tombstones {
+		ids[i] = tombstone.ID
+	}
+
+	if _, err := postCollection.DeleteByIDs(ctx, ids...); err != nil {
+		return err
+	}
+
+	if _, err := engagementCollection.DeleteByIDs(ctx, ids...); err != nil {
+		return err
+	}
+
+	for _, feedCollection := range feedCollections {
+		if _, err := feedCollection.DeleteByIDs(ctx, ids...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateAccounts persists the account statuses and handles. The posts of deleted accounts are
+// removed, the posts of otherwise inactive accounts are hidden, and the posts of reactivated
+// accounts are restored.
+func updateAccounts(
+	ctx context.Context,
+	postCollection *collections.PostCollection,
+	accountCollection *collections.AccountCollection,
+	feedCollections []FeedCollection,
+	accounts map[string]*collections.Account,
+	handles map[string]string,
+) error {
+	var deletedDIDs, inactiveDIDs, activeDIDs []string
+	accountList := make([]*collections.Account, 0, len(accounts))
+	for did, account := range accounts {
+		accountList = append(accountList, account)
+		switch {
+		case account.IsDeleted():
+			deletedDIDs = append(deletedDIDs, did)
+		case !account.Active:
+			inactiveDIDs = append(inactiveDIDs, did)
+		default:
+			activeDIDs = append(activeDIDs, did)
+		}
+	}
+
+	if err := accountCollection.UpsertStatus(ctx, accountList...); err != nil {
+		return err
+	}
+	if err := accountCollection.UpdateHandles(ctx, handles); err != nil {
+		return err
+	}
+
+	if _, err := postCollection.DeleteByDIDs(ctx, deletedDIDs...); err != nil {
+		return err
+	}
+	if _, err := postCollection.SetHiddenByDIDs(ctx, true, inactiveDIDs...); err != nil {
+		return err
+	}
+	if _, err := postCollection.SetHiddenByDIDs(ctx, false, activeDIDs...); err != nil {
+		return err
+	}
+
+	for _, feedCollection := range feedCollections {
+		if _, err := feedCollection.DeleteByDIDs(ctx, deletedDIDs...); err != nil {
+			return err
+		}
+		if _, err := feedCollection.SetHiddenByDIDs(ctx, true, inactiveDIDs...); err != nil {
+			return err
+		}
+		if _, err := feedCollection.SetHiddenByDIDs(ctx, false, activeDIDs...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newEmbed summarizes the embed of a post. It returns nil if the post has no embed.
+func newEmbed(postEmbed *bsky.FeedPost_Embed) *collections.Embed {
+	if postEmbed == nil {
+		return nil
+	}
+
+	embed := &collections.Embed{}
+	var images *bsky.EmbedImages
+	var video *bsky.EmbedVideo
+	var external *bsky.EmbedExternal
+	var record *bsky.EmbedRecord
+
+	switch {
+	case postEmbed.EmbedImages != nil:
+		images = postEmbed.EmbedImages
+	case postEmbed.EmbedVideo != nil:
+		video = postEmbed.EmbedVideo
+	case postEmbed.EmbedExternal != nil:
+		external = postEmbed.EmbedExternal
+	case postEmbed.EmbedRecord != nil:
+		record = postEmbed.EmbedRecord
+	case postEmbed.EmbedRecordWithMedia != nil:
+		record = postEmbed.EmbedRecordWithMedia.Record
+		if media := postEmbed.EmbedRecordWithMedia.Media; media != nil {
+			images, video, external = media.EmbedImages, media.EmbedVideo, media.EmbedExternal
+		}
+	default:
+		return nil
+	}
+
+	if images != nil {
+		embed.MediaType = collections.EmbedMediaTypeImages
+		embed.ImageCount = len(images.Images)
+		for _, image := range images.Images {
+			if image != nil && image.Alt != "" {
+				embed.ImageAlts = append(embed.ImageAlts, image.Alt)
+			}
+		}
+	}
+	if video != nil {
+		embed.MediaType = collections.EmbedMediaTypeVideo
+		embed.VideoAlt = utils.FromPtr(video.Alt)
+	}
+	if external != nil && external.External != nil {
+		embed.External = &collections.External{
+			URI:         external.External.Uri,
+			Title:       external.External.Title,
+			Description: external.External.Description,
+		}
+	}
+	if record != nil && record.Record != nil {
+		embed.QuoteURI = record.Record.Uri
+	}
+
+	return embed
+}
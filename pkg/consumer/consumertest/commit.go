@@ -0,0 +1,103 @@
+// Package consumertest builds firehose events for the tests of the consumer and the feed generators.
+package consumertest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/repo"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+)
+
+// Record is a record operation of a commit. A nil Value deletes the record.
+type Record struct {
+	Collection string
+	RecordKey  string
+	Value      repo.CborMarshaler
+}
+
+// NewCommit returns a #commit event of the DID creating and deleting the records. Its blocks are a CAR
+// file of the whole repo, and its signature is not valid.
+func NewCommit(seq int64, did string, records ...Record) (*comatproto.SyncSubscribeRepos_Commit, error) {
+	ctx := context.Background()
+	store := newBlockstore()
+	r := repo.NewRepo(ctx, did, store)
+
+	var ops []*comatproto.SyncSubscribeRepos_RepoOp
+	for _, record := range records {
+		path := record.Collection + "/" + record.RecordKey
+		if record.Value == nil {
+			ops = append(ops, &comatproto.SyncSubscribeRepos_RepoOp{Action: "delete", Path: path})
+			continue
+		}
+
+		recordCID, err := r.PutRecord(ctx, path, record.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to put record %s: %w", path, err)
+		}
+		link := lexutil.LexLink(recordCID)
+		ops = append(ops, &comatproto.SyncSubscribeRepos_RepoOp{Action: "create", Path: path, Cid: &link})
+	}
+
+	root, rev, err := r.Commit(ctx, func(context.Context, string, []byte) ([]byte, error) {
+		return []byte("signature"), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit: %w", err)
+	}
+
+	var carFile bytes.Buffer
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{root}, Version: 1}, &carFile); err != nil {
+		return nil, err
+	}
+	for _, block := range store.blocks {
+		if err := carutil.LdWrite(&carFile, block.Cid().Bytes(), block.RawData()); err != nil {
+			return nil, err
+		}
+	}
+
+	return &comatproto.SyncSubscribeRepos_Commit{
+		Seq:    seq,
+		Repo:   did,
+		Rev:    rev,
+		Commit: lexutil.LexLink(root),
+		Ops:    ops,
+		Blocks: carFile.Bytes(),
+		Time:   time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// blockstore is an in-memory blockstore that keeps the blocks in the order they were put.
+type blockstore struct {
+	blocks []blocks.Block
+	index  map[cid.Cid]blocks.Block
+}
+
+func newBlockstore() *blockstore {
+	return &blockstore{index: make(map[cid.Cid]blocks.Block)}
+}
+
+func (s *blockstore) Get(_ context.Context, c cid.Cid) (blocks.Block, error) {
+	block, ok := s.index[c]
+	if !ok {
+		return nil, &ipld.ErrNotFound{Cid: c}
+	}
+	return block, nil
+}
+
+func (s *blockstore) Put(_ context.Context, block blocks.Block) error {
+	if _, ok := s.index[block.Cid()]; ok {
+		return nil
+	}
+	s.index[block.Cid()] = block
+	s.blocks = append(s.blocks, block)
+	return nil
+}
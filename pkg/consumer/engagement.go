@@ -0,0 +1,164 @@
+package consumer
+
+// This file contains the engagement (like, repost and reply) counting of the consumer.
+// Only the engagement of posts stored in the post collection is counted, so the
+// storage stays bounded by the post collection.
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// postIDFromURI returns the Post.ID of an app.bsky.feed.post AT URI.
+func postIDFromURI(uri string) (string, bool) {
+	aturi, err := syntax.ParseATURI(uri)
+	if err != nil || aturi.Collection() != "app.bsky.feed.post" {
+		return "", false
+	}
+
+	did, err := aturi.Authority().AsDID()
+	if err != nil {
+		return "", false
+	}
+
+	return fmt.Sprintf("%s/%s", did, aturi.RecordKey()), true
+}
+
+// engagementRecordID returns the EngagementRecord.ID of a record.
+func engagementRecordID(data CallbackData) string {
+	return fmt.Sprintf("%s/%s/%s", data.DID, data.Collection, data.RecordKey)
+}
+
+// newEngagementRecord creates the engagement record of a like, repost or reply.
+// It returns nil if the record doesn't engage with a post.
+func newEngagementRecord(data CallbackData) *collections.EngagementRecord {
+	var subjectURI, createdAt string
+	switch {
+	case data.Like != nil && data.Like.Subject != nil:
+		subjectURI, createdAt = data.Like.Subject.Uri, data.Like.CreatedAt
+	case data.Repost != nil && data.Repost.Subject != nil:
+		subjectURI, createdAt = data.Repost.Subject.Uri, data.Repost.CreatedAt
+	case data.Post.Reply != nil && data.Post.Reply.Parent != nil:
+		subjectURI, createdAt = data.Post.Reply.Parent.Uri, data.Post.CreatedAt
+	default:
+		return nil
+	}
+
+	subjectID, ok := postIDFromURI(subjectURI)
+	if !ok {
+		return nil
+	}
+
+	// The record's own timestamp places replayed and delayed events in the right bucket,
+	// but it is set by the client, so it can't be trusted to be in the past.
+	now := time.Now().UTC()
+	bucket, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil || bucket.After(now) {
+		bucket = now
+	}
+
+	return &collections.EngagementRecord{
+		ID:         engagementRecordID(data),
+		Collection: data.Collection,
+		SubjectID:  subjectID,
+		Bucket:     collections.EngagementBucket(bucket),
+		CreatedAt:  now,
+	}
+}
+
+// updateEngagement counts the new engagement records of stored posts and uncounts the deleted ones.
+func updateEngagement(
+	ctx context.Context,
+	postCollection *collections.PostCollection,
+	engagementCollection *collections.EngagementCollection,
+	engagementRecordCollection *collections.EngagementRecordCollection,
+	records []*collections.EngagementRecord,
+	deletedRecordIDs []string,
+) error {
+	if len(records) == 0 && len(deletedRecordIDs) == 0 {
+		return nil
+	}
+
+	subjectIDs := make([]string, len(records))
+	for i, record := range records {
+		subjectIDs[i] = record.SubjectID
+	}
+	postCreatedAts, err := postCollection.GetCreatedAtByIDs(ctx, subjectIDs...)
+	if err != nil {
+		return err
+	}
+
+	storedRecords := make([]*collections.EngagementRecord, 0, len(records))
+	for _, record := range records {
+		if _, ok := postCreatedAts[record.SubjectID]; ok {
+			storedRecords = append(storedRecords, record)
+		}
+	}
+	newRecords, err := engagementRecordCollection.InsertNew(ctx, storedRecords...)
+	if err != nil {
+		return err
+	}
+
+	removedRecords, err := engagementRecordCollection.GetByIDs(ctx, deletedRecordIDs...)
+	if err != nil {
+		return err
+	}
+
+	// Deltas are merged per post and bucket to keep the number of writes low
+	type deltaKey struct {
+		postID string
+		bucket time.Time
+	}
+	deltas := make(map[deltaKey]*collections.EngagementDelta)
+	addDelta := func(record *collections.EngagementRecord, value int64) {
+		key := deltaKey{record.SubjectID, record.Bucket}
+		delta, ok := deltas[key]
+		if !ok {
+			delta = &collections.EngagementDelta{
+				PostID:        record.SubjectID,
+				PostCreatedAt: postCreatedAts[record.SubjectID],
+				Bucket:        record.Bucket,
+			}
+			deltas[key] = delta
+		}
+
+		switch record.Collection {
+		case "app.bsky.feed.like":
+			delta.Likes += value
+		case "app.bsky.feed.repost":
+			delta.Reposts += value
+		case "app.bsky.feed.post":
+			delta.Replies += value
+		}
+	}
+	for _, record := range newRecords {
+		addDelta(record, 1)
+	}
+	for _, record := range removedRecords {
+		addDelta(record, -1)
+	}
+
+	deltaList := make([]*collections.EngagementDelta, 0, len(deltas))
+	for _, delta := range deltas {
+		deltaList = append(deltaList, delta)
+	}
+	if err := engagementCollection.Increment(ctx, deltaList...); err != nil {
+		return err
+	}
+
+	if len(removedRecords) > 0 {
+		removedIDs := make([]string, len(removedRecords))
+		for i, record := range removedRecords {
+			removedIDs[i] = record.ID
+		}
+		if _, err := engagementRecordCollection.DeleteByIDs(ctx, removedIDs...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
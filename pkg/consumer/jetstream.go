@@ -0,0 +1,247 @@
+package consumer
+
+// This file contains code for consuming the Jetstream event stream.
+// Jetstream re-encodes the firehose as plain JSON, which is much cheaper to process
+// than reading the CAR blocks of every commit.
+// See: https://github.com/bluesky-social/jetstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/aykhans/bsky-feedgen/pkg/logger"
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/gorilla/websocket"
+	"github.com/klauspost/compress/zstd"
+)
+
+// JetstreamWantedCollections are the record collections requested from Jetstream.
+var JetstreamWantedCollections = []string{
+	"app.bsky.feed.post",
+	"app.bsky.feed.like",
+	"app.bsky.feed.repost",
+	"app.bsky.graph.block",
+}
+
+type jetstreamEvent struct {
+	DID      string                                  `json:"did"`
+	TimeUS   int64                                   `json:"time_us"`
+	Kind     string                                  `json:"kind"`
+	Commit   *jetstreamCommit                        `json:"commit,omitempty"`
+	Account  *comatproto.SyncSubscribeRepos_Account  `json:"account,omitempty"`
+	Identity *comatproto.SyncSubscribeRepos_Identity `json:"identity,omitempty"`
+}
+
+type jetstreamCommit struct {
+	Rev        string          `json:"rev"`
+	Operation  string          `json:"operation"`
+	Collection string          `json:"collection"`
+	RKey       string          `json:"rkey"`
+	Record     json.RawMessage `json:"record,omitempty"`
+	CID        string          `json:"cid"`
+}
+
+// JetstreamSource consumes the JSON event stream of a Jetstream instance.
+// Its cursors are unix microsecond timestamps (time_us) instead of relay sequence numbers.
+type JetstreamSource struct {
+	host           string
+	zstdDictionary []byte
+}
+
+// NewJetstreamSource creates a Jetstream source.
+// If zstdDictionary is not empty, the stream is requested with zstd compression
+// and decompressed using the given dictionary.
+func NewJetstreamSource(host string, zstdDictionary []byte) *JetstreamSource {
+	return &JetstreamSource{
+		host:           host,
+		zstdDictionary: zstdDictionary,
+	}
+}
+
+func (s *JetstreamSource) Name() string {
+	return s.host
+}
+
+func (s *JetstreamSource) Run(ctx context.Context, callbackFunc CallbackFunc, cursor *int64) error {
+	u, err := url.Parse(s.host)
+	if err != nil {
+		return fmt.Errorf("invalid jetstream host URI: %w", err)
+	}
+
+	u.Path = "subscribe"
+	q := url.Values{}
+	for _, collection := range JetstreamWantedCollections {
+		q.Add("wantedCollections", collection)
+	}
+	if cursor != nil {
+		q.Set("cursor", strconv.FormatInt(*cursor, 10))
+	}
+
+	var decoder *zstd.Decoder
+	if len(s.zstdDictionary) > 0 {
+		q.Set("compress", "true")
+		decoder, err = zstd.NewReader(nil, zstd.WithDecoderDicts(s.zstdDictionary))
+		if err != nil {
+			return fmt.Errorf("invalid jetstream zstd dictionary: %w", err)
+		}
+		defer decoder.Close()
+	}
+	u.RawQuery = q.Encode()
+
+	logger.Log.Info("subscribing to jetstream", "upstream", s.host, "compress", decoder != nil)
+	con, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), http.Header{
+		"User-Agent": []string{"Firehose-Consumer"},
+	})
+	if err != nil {
+		return fmt.Errorf("subscribing to jetstream failed (dialing): %w", err)
+	}
+	defer func() { _ = con.Close() }()
+
+	// Unblock ReadMessage when the context is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = con.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		_, message, err := con.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("%w: jetstream read error: %v", ErrStream, err)
+		}
+
+		if decoder != nil {
+			message, err = decoder.DecodeAll(message, nil)
+			if err != nil {
+				logger.Log.Error("failed to decompress jetstream message", "err", err)
+				continue
+			}
+		}
+
+		var evt jetstreamEvent
+		if err := json.Unmarshal(message, &evt); err != nil {
+			logger.Log.Error("failed to parse jetstream message", "err", err)
+			continue
+		}
+
+		handleJetstreamEvent(&evt, callbackFunc)
+	}
+}
+
+func handleJetstreamEvent(evt *jetstreamEvent, callbackFunc CallbackFunc) {
+	switch evt.Kind {
+	case "account":
+		if evt.Account != nil {
+			handleJetstreamAccountEvent(evt, callbackFunc)
+		}
+		return
+	case "identity":
+		if evt.Identity != nil {
+			handleJetstreamAccountEvent(evt, callbackFunc)
+		}
+		return
+	case "commit":
+		if evt.Commit == nil {
+			return
+		}
+	default:
+		return
+	}
+
+	localLogger := logger.Log.With(
+		"event", "commit",
+		"did", evt.DID,
+		"rev", evt.Commit.Rev,
+		"time_us", evt.TimeUS,
+		"eventKind", evt.Commit.Operation,
+		"collection", evt.Commit.Collection,
+	)
+
+	did, err := syntax.ParseDID(evt.DID)
+	if err != nil {
+		localLogger.Error("bad DID syntax in event", "err", err)
+		return
+	}
+
+	rkey, err := syntax.ParseRecordKey(evt.Commit.RKey)
+	if err != nil {
+		localLogger.Error("bad record key syntax in event", "err", err)
+		return
+	}
+
+	ek := repomgr.EventKind(evt.Commit.Operation)
+	switch ek {
+	case repomgr.EvtKindCreateRecord, repomgr.EvtKindUpdateRecord:
+		data := CallbackData{
+			Sequence:   evt.TimeUS,
+			DID:        did,
+			RecordKey:  rkey,
+			Action:     ek,
+			Collection: evt.Commit.Collection,
+		}
+
+		var record any
+		switch evt.Commit.Collection {
+		case "app.bsky.feed.post":
+			record = &data.Post
+		case "app.bsky.feed.like":
+			data.Like = &bsky.FeedLike{}
+			record = data.Like
+		case "app.bsky.feed.repost":
+			data.Repost = &bsky.FeedRepost{}
+			record = data.Repost
+		case "app.bsky.graph.block":
+			data.Block = &bsky.GraphBlock{}
+			record = data.Block
+		default:
+			return
+		}
+		if err := json.Unmarshal(evt.Commit.Record, record); err != nil {
+			localLogger.Error("failed to parse "+evt.Commit.Collection+" record", "err", err)
+			return
+		}
+		callbackFunc(data)
+	case repomgr.EvtKindDeleteRecord:
+		switch evt.Commit.Collection {
+		case "app.bsky.feed.post", "app.bsky.feed.like", "app.bsky.feed.repost", "app.bsky.graph.block":
+			callbackFunc(CallbackData{
+				Sequence:   evt.TimeUS,
+				DID:        did,
+				RecordKey:  rkey,
+				Action:     ek,
+				Collection: evt.Commit.Collection,
+			})
+		}
+	}
+}
+
+// handleJetstreamAccountEvent delivers #account and #identity events.
+// Like commits, they are sequenced by time_us instead of the relay sequence.
+func handleJetstreamAccountEvent(evt *jetstreamEvent, callbackFunc CallbackFunc) {
+	did, err := syntax.ParseDID(evt.DID)
+	if err != nil {
+		logger.Log.Error("bad DID syntax in event", "event", evt.Kind, "did", evt.DID, "time_us", evt.TimeUS, "err", err)
+		return
+	}
+
+	callbackFunc(CallbackData{
+		Sequence: evt.TimeUS,
+		DID:      did,
+		Account:  evt.Account,
+		Identity: evt.Identity,
+	})
+}
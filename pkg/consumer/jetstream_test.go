@@ -0,0 +1,225 @@
+package consumer
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/klauspost/compress/zstd"
+)
+
+const jetstreamTestDID = "did:plc:jetstreamjetstreamjetst"
+
+// jetstreamTestEvents are the messages of the test server in stream order.
+var jetstreamTestEvents = []struct {
+	timeUS  int64
+	message string
+}{
+	{100, `{"did":"` + jetstreamTestDID + `","time_us":100,"kind":"commit","commit":{"rev":"a","operation":"create","collection":"app.bsky.feed.post","rkey":"3kpost","record":{"$type":"app.bsky.feed.post","text":"Salam","langs":["az"],"createdAt":"2026-10-18T08:00:00Z"},"cid":"bafy"}}`},
+	{200, `{"did":"` + jetstreamTestDID + `","time_us":200,"kind":"commit","commit":{"rev":"b","operation":"create","collection":"app.bsky.feed.like","rkey":"3klike","record":{"$type":"app.bsky.feed.like","subject":{"uri":"at://did:plc:other/app.bsky.feed.post/1","cid":"bafy"},"createdAt":"2026-10-18T08:00:00Z"},"cid":"bafy"}}`},
+	{300, `{"did":"` + jetstreamTestDID + `","time_us":300,"kind":"commit","commit":{"rev":"c","operation":"delete","collection":"app.bsky.feed.post","rkey":"3kpost"}}`},
+	{400, `{"did":"` + jetstreamTestDID + `","time_us":400,"kind":"identity","identity":{"did":"` + jetstreamTestDID + `","handle":"jetstream.bsky.social","seq":1,"time":"2026-10-18T08:00:00Z"}}`},
+	{500, `{"did":"` + jetstreamTestDID + `","time_us":500,"kind":"account","account":{"did":"` + jetstreamTestDID + `","active":false,"status":"deactivated","seq":2,"time":"2026-10-18T08:00:00Z"}}`},
+	// Not a wanted collection, the source skips it
+	{600, `{"did":"` + jetstreamTestDID + `","time_us":600,"kind":"commit","commit":{"rev":"d","operation":"create","collection":"app.bsky.actor.profile","rkey":"self","record":{"$type":"app.bsky.actor.profile"},"cid":"bafy"}}`},
+}
+
+// newJetstreamTestServer serves the test events after the cursor of the request, compressed with the
+// zstd dictionary if the request asks for compression, and closes the stream. The queries of the
+// requests are sent to the returned channel.
+func newJetstreamTestServer(t *testing.T, dictionary []byte) (*httptest.Server, <-chan url.Values) {
+	t.Helper()
+
+	queries := make(chan url.Values, 10)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/subscribe" {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query()
+		queries <- query
+
+		con, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer func() { _ = con.Close() }()
+
+		var encoder *zstd.Encoder
+		if query.Get("compress") == "true" {
+			encoder, err = zstd.NewWriter(nil, zstd.WithEncoderDict(dictionary))
+			if err != nil {
+				t.Errorf("zstd encoder: %v", err)
+				return
+			}
+			defer func() { _ = encoder.Close() }()
+		}
+
+		var cursor int64
+		if value := query.Get("cursor"); value != "" {
+			if cursor, err = strconv.ParseInt(value, 10, 64); err != nil {
+				t.Errorf("invalid cursor %q", value)
+				return
+			}
+		}
+
+		for _, event := range jetstreamTestEvents {
+			if event.timeUS < cursor {
+				continue
+			}
+			message := []byte(event.message)
+			if encoder != nil {
+				message = encoder.EncodeAll(message, nil)
+			}
+			if err := con.WriteMessage(websocket.BinaryMessage, message); err != nil {
+				t.Errorf("write: %v", err)
+				return
+			}
+		}
+		_ = con.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, queries
+}
+
+func newJetstreamTestDictionary(t *testing.T) []byte {
+	t.Helper()
+
+	// The dictionary builder needs a few thousand sequences of samples
+	var contents [][]byte
+	var history strings.Builder
+	for i := range 100 {
+		for _, event := range jetstreamTestEvents {
+			sample := strings.ReplaceAll(event.message, strconv.FormatInt(event.timeUS, 10), strconv.Itoa(i*1000))
+			contents = append(contents, []byte(sample))
+			if i == 0 {
+				history.WriteString(sample)
+			}
+		}
+	}
+	dictionary, err := zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       1,
+		Contents: contents,
+		History:  []byte(history.String()),
+		Offsets:  [3]int{1, 4, 8},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The builder may choose initial repeat offsets past the end of the history, which decoders
+	// reject, so they are reset to the defaults. They are stored right before the history.
+	offsets := dictionary[len(dictionary)-len(history.String())-12:]
+	for i, offset := range []uint32{1, 4, 8} {
+		binary.LittleEndian.PutUint32(offsets[i*4:], offset)
+	}
+	return dictionary
+}
+
+func TestJetstreamSource(t *testing.T) {
+	dictionary := newJetstreamTestDictionary(t)
+	resumeCursor := int64(300)
+
+	tests := []struct {
+		name       string
+		dictionary []byte
+		cursor     *int64
+		wantQuery  url.Values
+		wantEvents []string
+	}{
+		{
+			name:       "current stream",
+			wantQuery:  url.Values{},
+			wantEvents: []string{"100 create post", "200 create like", "300 delete post", "400 identity", "500 account"},
+		},
+		{
+			name:       "resume from time_us cursor",
+			cursor:     &resumeCursor,
+			wantQuery:  url.Values{"cursor": {"300"}},
+			wantEvents: []string{"300 delete post", "400 identity", "500 account"},
+		},
+		{
+			name:       "zstd compressed",
+			dictionary: dictionary,
+			wantQuery:  url.Values{"compress": {"true"}},
+			wantEvents: []string{"100 create post", "200 create like", "300 delete post", "400 identity", "500 account"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, queries := newJetstreamTestServer(t, dictionary)
+			source := NewJetstreamSource("ws"+strings.TrimPrefix(server.URL, "http"), test.dictionary)
+
+			var (
+				mu     sync.Mutex
+				events []string
+			)
+			err := source.Run(context.Background(), func(data CallbackData) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				event := strconv.FormatInt(data.Sequence, 10)
+				switch {
+				case data.Identity != nil:
+					if data.Identity.Handle == nil || *data.Identity.Handle != "jetstream.bsky.social" {
+						t.Errorf("identity event without the handle: %+v", data.Identity)
+					}
+					event += " identity"
+				case data.Account != nil:
+					if data.Account.Active || data.Account.Status == nil || *data.Account.Status != "deactivated" {
+						t.Errorf("unexpected account status: %+v", data.Account)
+					}
+					event += " account"
+				default:
+					event += " " + string(data.Action) + " " + data.Collection[strings.LastIndex(data.Collection, ".")+1:]
+					if data.Collection == "app.bsky.feed.post" && data.Action == "create" && data.Post.Text != "Salam" {
+						t.Errorf("post text = %q, want %q", data.Post.Text, "Salam")
+					}
+					if data.Like != nil && data.Like.Subject == nil {
+						t.Errorf("like without subject")
+					}
+				}
+				if data.DID != jetstreamTestDID {
+					t.Errorf("DID = %s, want %s", data.DID, jetstreamTestDID)
+				}
+				events = append(events, event)
+			}, test.cursor)
+			if !errors.Is(err, ErrStream) {
+				t.Errorf("Run = %v, want ErrStream after the server closed the stream", err)
+			}
+
+			var query url.Values
+			select {
+			case query = <-queries:
+			default:
+				t.Fatal("the source didn't subscribe")
+			}
+			if got := query["wantedCollections"]; !slices.Equal(got, JetstreamWantedCollections) {
+				t.Errorf("wantedCollections = %v, want %v", got, JetstreamWantedCollections)
+			}
+			for _, key := range []string{"cursor", "compress"} {
+				if got, want := query.Get(key), test.wantQuery.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !slices.Equal(events, test.wantEvents) {
+				t.Errorf("events = %v, want %v", events, test.wantEvents)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/logger"
+	"github.com/aykhans/bsky-feedgen/pkg/utils"
+)
+
+// CursorLoader returns the stored cursor of the source with the given name, or nil if there is none.
+type CursorLoader func(ctx context.Context, sourceName string) (*int64, error)
+
+const (
+	// relayPoolCycleDelay is the wait time after every source of the pool failed in a row.
+	relayPoolCycleDelay = 5 * time.Second
+	// relayPoolPreferredRetryDelay is how long a fallback source runs before the pool tries the
+	// preferred (first) source again.
+	relayPoolPreferredRetryDelay = 10 * time.Minute
+	// MinSourceStallTimeout is the shortest stall timeout of a relay pool.
+	MinSourceStallTimeout = time.Second
+)
+
+// RelayPool runs an ordered list of sources, one at a time, preferring the sources in their order.
+// It fails over to the next source when the active one refuses connections, breaks without
+// delivering any event, or stalls (delivers no events for stallTimeout). When a source that
+// delivered events breaks, the pool starts over from the first source. A fallback source is
+// interrupted every relayPoolPreferredRetryDelay to try the first source again.
+//
+// Cursors are kept per source because sequence numbers are not portable between relays.
+// When the pool switches to a source for the first time, its cursor is read with loadCursor.
+// A source without a stored cursor is started from its current stream position.
+type RelayPool struct {
+	sources      []Source
+	stallTimeout time.Duration
+	loadCursor   CursorLoader
+	active       atomic.Int32
+	activeSince  atomic.Int64 // Unix nanoseconds
+	failovers    atomic.Int64
+}
+
+// NewRelayPool creates a relay pool. loadCursor is optional.
+func NewRelayPool(sources []Source, stallTimeout time.Duration, loadCursor CursorLoader) (*RelayPool, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("relay pool requires at least one source")
+	}
+	if stallTimeout < MinSourceStallTimeout {
+		return nil, fmt.Errorf("relay pool stall timeout must be at least %s", MinSourceStallTimeout)
+	}
+
+	return &RelayPool{
+		sources:      sources,
+		stallTimeout: stallTimeout,
+		loadCursor:   loadCursor,
+	}, nil
+}
+
+// Name returns the name of the active source.
+func (p *RelayPool) Name() string {
+	return p.sources[p.active.Load()].Name()
+}
+
+// Failovers returns how many times the pool switched or reconnected sources.
+func (p *RelayPool) Failovers() int64 {
+	return p.failovers.Load()
+}
+
+// ActiveSince returns when the active source was started.
+func (p *RelayPool) ActiveSince() time.Time {
+	return time.Unix(0, p.activeSince.Load())
+}
+
+// Run consumes the sources until ctx is cancelled. The cursor is used for the first source only.
+func (p *RelayPool) Run(ctx context.Context, callbackFunc CallbackFunc, cursor *int64) error {
+	cursors := make([]*int64, len(p.sources))
+	cursors[0] = cursor
+	cursorsLoaded := make([]bool, len(p.sources))
+	cursorsLoaded[0] = true
+
+	failedAttempts := 0
+	for index := 0; ctx.Err() == nil; {
+		source := p.sources[index]
+		p.active.Store(int32(index))
+		p.activeSince.Store(time.Now().UnixNano())
+
+		if !cursorsLoaded[index] && p.loadCursor != nil {
+			loadedCursor, err := p.loadCursor(ctx, source.Name())
+			if err != nil {
+				logger.Log.Error("failed to load source cursor", "source", source.Name(), "error", err)
+			} else {
+				cursors[index] = loadedCursor
+				cursorsLoaded[index] = true
+			}
+		}
+
+		logger.Log.Info("consumer source active", "source", source.Name(), "cursor", cursorLogValue(cursors[index]))
+
+		var maxDuration time.Duration
+		if index > 0 {
+			maxDuration = relayPoolPreferredRetryDelay
+		}
+		lastCursor, received, reason := p.runSource(ctx, source, callbackFunc, cursors[index], maxDuration)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// Unordered events don't move the cursor, so a source that broke before its first
+		// checkpoint is resumed from its previous cursor
+		if lastCursor != nil {
+			cursors[index] = lastCursor
+		}
+		if received {
+			failedAttempts = 0
+		} else {
+			failedAttempts++
+		}
+
+		// A source that delivered events was healthy, so the sources are tried in their order again
+		nextIndex := (index + 1) % len(p.sources)
+		if received {
+			nextIndex = 0
+		}
+		logger.Log.Warn(
+			"consumer source failed over",
+			"from", source.Name(),
+			"to", p.sources[nextIndex].Name(),
+			"reason", reason,
+			"failovers", p.failovers.Add(1),
+		)
+
+		if failedAttempts >= len(p.sources) {
+			failedAttempts = 0
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(relayPoolCycleDelay):
+			}
+		}
+		index = nextIndex
+	}
+
+	return nil
+}
+
+// runSource runs a single source until it fails, stalls or runs for maxDuration (0 for no limit).
+// It returns the highest safe cursor delivered, nil if the source delivered none, whether any event was
+// delivered, and the failure reason.
+func (p *RelayPool) runSource(
+	ctx context.Context,
+	source Source,
+	callbackFunc CallbackFunc,
+	cursor *int64,
+	maxDuration time.Duration,
+) (*int64, bool, string) {
+	sourceCtx, sourceCancel := context.WithCancel(ctx)
+	defer sourceCancel()
+
+	var (
+		lastSequence  atomic.Int64
+		checkpointed  atomic.Bool
+		received      atomic.Bool
+		stalled       atomic.Bool
+		expired       atomic.Bool
+		lastEventTime atomic.Int64
+	)
+	lastEventTime.Store(time.Now().UnixNano())
+
+	go func() {
+		ticker := time.NewTicker(p.stallTimeout / 5)
+		defer ticker.Stop()
+
+		var deadline <-chan time.Time
+		if maxDuration > 0 {
+			timer := time.NewTimer(maxDuration)
+			defer timer.Stop()
+			deadline = timer.C
+		}
+
+		for {
+			select {
+			case <-sourceCtx.Done():
+				return
+			case <-deadline:
+				expired.Store(true)
+				sourceCancel()
+				return
+			case <-ticker.C:
+				if time.Since(time.Unix(0, lastEventTime.Load())) > p.stallTimeout {
+					stalled.Store(true)
+					sourceCancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err := source.Run(
+		sourceCtx,
+		func(data CallbackData) {
+			lastEventTime.Store(time.Now().UnixNano())
+			data.Source = source.Name()
+			// Checkpoints of parallel workers may arrive out of order, so keep the highest one
+			for !data.Unordered {
+				current := lastSequence.Load()
+				if current >= data.Sequence || lastSequence.CompareAndSwap(current, data.Sequence) {
+					checkpointed.Store(true)
+					break
+				}
+			}
+			received.Store(true)
+			callbackFunc(data)
+		},
+		cursor,
+	)
+
+	reason := "stream closed"
+	switch {
+	case stalled.Load():
+		reason = "stalled"
+	case expired.Load():
+		reason = "retrying preferred source"
+	case err != nil:
+		reason = err.Error()
+	}
+
+	if !checkpointed.Load() {
+		return nil, received.Load(), reason
+	}
+	return utils.ToPtr(lastSequence.Load()), received.Load(), reason
+}
+
+func cursorLogValue(cursor *int64) any {
+	if cursor == nil {
+		return "current-stream"
+	}
+	return *cursor
+}
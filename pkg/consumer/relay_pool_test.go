@@ -0,0 +1,160 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSource delivers the events of its next run, then returns the error of the run.
+type fakeSource struct {
+	name string
+	runs *[]string
+	mu   *sync.Mutex
+	// Events delivered by every run
+	events int
+	// Deliver the events as unordered work events instead of checkpoints
+	unordered bool
+	// Cursors of the runs
+	cursors *[]*int64
+	err     error
+	// Block until the context is cancelled after delivering the events
+	block bool
+}
+
+func (s *fakeSource) Name() string {
+	return s.name
+}
+
+func (s *fakeSource) Run(ctx context.Context, callbackFunc CallbackFunc, cursor *int64) error {
+	s.mu.Lock()
+	*s.runs = append(*s.runs, s.name)
+	if s.cursors != nil {
+		*s.cursors = append(*s.cursors, cursor)
+	}
+	s.mu.Unlock()
+
+	for i := range s.events {
+		callbackFunc(CallbackData{Sequence: int64(i + 1), Unordered: s.unordered})
+	}
+	if s.block {
+		<-ctx.Done()
+		return nil
+	}
+	return s.err
+}
+
+func TestNewRelayPoolRejectsShortStallTimeout(t *testing.T) {
+	sources := []Source{&fakeSource{name: "a"}}
+	for _, stallTimeout := range []time.Duration{-time.Second, 0, time.Nanosecond, MinSourceStallTimeout - 1} {
+		if _, err := NewRelayPool(sources, stallTimeout, nil); err == nil {
+			t.Errorf("NewRelayPool(stallTimeout=%s) returned no error", stallTimeout)
+		}
+	}
+	if _, err := NewRelayPool(sources, MinSourceStallTimeout, nil); err != nil {
+		t.Errorf("NewRelayPool(stallTimeout=%s): %v", MinSourceStallTimeout, err)
+	}
+}
+
+func TestRelayPoolPrefersSourcesInOrder(t *testing.T) {
+	var (
+		runs []string
+		mu   sync.Mutex
+	)
+	broken := errors.New("broken")
+	sources := []Source{
+		// The preferred source refuses connections
+		&fakeSource{name: "primary", runs: &runs, mu: &mu, err: broken},
+		// The fallback source delivers events and breaks
+		&fakeSource{name: "fallback", runs: &runs, mu: &mu, events: 2, err: broken},
+		&fakeSource{name: "last", runs: &runs, mu: &mu, block: true},
+	}
+
+	pool, err := NewRelayPool(sources, time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for ctx.Err() == nil {
+			mu.Lock()
+			done := len(runs) >= 5
+			mu.Unlock()
+			if done {
+				cancel()
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	if err := pool.Run(ctx, func(CallbackData) {}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// After the fallback source delivered events and broke, the primary source is tried first again
+	want := []string{"primary", "fallback", "primary", "fallback", "primary"}
+	if !slices.Equal(runs[:5], want) {
+		t.Errorf("runs = %v, want %v", runs[:5], want)
+	}
+	if pool.Failovers() < 4 {
+		t.Errorf("failovers = %d, want at least 4", pool.Failovers())
+	}
+}
+
+func TestRelayPoolKeepsCursorWithoutCheckpoint(t *testing.T) {
+	var (
+		runs    []string
+		cursors []*int64
+		mu      sync.Mutex
+	)
+	// The source delivers work events and closes before the first checkpoint
+	source := &fakeSource{
+		name: "primary", runs: &runs, cursors: &cursors, mu: &mu,
+		events: 3, unordered: true, err: errors.New("broken"),
+	}
+
+	pool, err := NewRelayPool([]Source{source}, time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for ctx.Err() == nil {
+			mu.Lock()
+			done := len(runs) >= 3
+			mu.Unlock()
+			if done {
+				cancel()
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	cursor := int64(42)
+	if err := pool.Run(ctx, func(CallbackData) {}, &cursor); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, runCursor := range cursors[:3] {
+		if runCursor == nil || *runCursor != cursor {
+			t.Errorf("run %d cursor = %v, want %d", i, cursorLogValue(runCursor), cursor)
+		}
+	}
+	// The source delivered events, so it isn't treated as refusing connections
+	if pool.Failovers() < 2 {
+		t.Errorf("failovers = %d, want at least 2", pool.Failovers())
+	}
+}
@@ -0,0 +1,246 @@
+package consumer
+
+// This file contains the recording and replaying of firehose traffic.
+// Recordings are gzip compressed streams of frames, each frame is:
+//
+//	kind (1 byte) | received at, unix nanoseconds (8 bytes) | payload length (4 bytes) | payload
+//
+// All integers are big endian. The payload is the CBOR encoded com.atproto.sync.subscribeRepos
+// event of the frame kind (#commit, #account or #identity).
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/logger"
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+)
+
+const (
+	frameKindCommit   byte = 1
+	frameKindAccount  byte = 2
+	frameKindIdentity byte = 3
+)
+
+// Recorder writes firehose events to a compressed recording file.
+// It is safe for concurrent use.
+type Recorder struct {
+	mu         sync.Mutex
+	file       *os.File
+	gzipWriter *gzip.Writer
+}
+
+// NewRecorder creates (or truncates) the recording file at path.
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording file: %w", err)
+	}
+
+	return &Recorder{
+		file:       file,
+		gzipWriter: gzip.NewWriter(file),
+	}, nil
+}
+
+func (r *Recorder) RecordCommit(evt *comatproto.SyncSubscribeRepos_Commit) error {
+	var payload bytes.Buffer
+	if err := evt.MarshalCBOR(&payload); err != nil {
+		return fmt.Errorf("failed to encode commit: %w", err)
+	}
+
+	return r.writeFrame(frameKindCommit, time.Now(), payload.Bytes())
+}
+
+func (r *Recorder) RecordAccount(evt *comatproto.SyncSubscribeRepos_Account) error {
+	var payload bytes.Buffer
+	if err := evt.MarshalCBOR(&payload); err != nil {
+		return fmt.Errorf("failed to encode account event: %w", err)
+	}
+
+	return r.writeFrame(frameKindAccount, time.Now(), payload.Bytes())
+}
+
+func (r *Recorder) RecordIdentity(evt *comatproto.SyncSubscribeRepos_Identity) error {
+	var payload bytes.Buffer
+	if err := evt.MarshalCBOR(&payload); err != nil {
+		return fmt.Errorf("failed to encode identity event: %w", err)
+	}
+
+	return r.writeFrame(frameKindIdentity, time.Now(), payload.Bytes())
+}
+
+func (r *Recorder) writeFrame(kind byte, receivedAt time.Time, payload []byte) error {
+	header := make([]byte, 13)
+	header[0] = kind
+	binary.BigEndian.PutUint64(header[1:9], uint64(receivedAt.UnixNano()))
+	binary.BigEndian.PutUint32(header[9:13], uint32(len(payload)))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.gzipWriter.Write(header); err != nil {
+		return err
+	}
+	_, err := r.gzipWriter.Write(payload)
+	return err
+}
+
+// Close flushes the recording and closes the file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.gzipWriter.Close(); err != nil {
+		_ = r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+// recordingScheduler records the events as they are dispatched to the scheduler, in stream order.
+// The workers of a parallel scheduler handle the events out of order, so they can't record them.
+type recordingScheduler struct {
+	events.Scheduler
+	recorder *Recorder
+}
+
+func (s *recordingScheduler) AddWork(ctx context.Context, repo string, val *events.XRPCStreamEvent) error {
+	var err error
+	switch {
+	case val.RepoCommit != nil:
+		err = s.recorder.RecordCommit(val.RepoCommit)
+	case val.RepoAccount != nil:
+		err = s.recorder.RecordAccount(val.RepoAccount)
+	case val.RepoIdentity != nil:
+		err = s.recorder.RecordIdentity(val.RepoIdentity)
+	}
+	if err != nil {
+		logger.Log.Error("failed to record event", "seq", val.Sequence(), "err", err)
+	}
+
+	return s.Scheduler.AddWork(ctx, repo, val)
+}
+
+// ReplaySource feeds the events of a recording through HandleRepoCommit, HandleRepoAccount and HandleRepoIdentity.
+// It returns ErrSourceExhausted after the last event of the recording.
+type ReplaySource struct {
+	path     string
+	realTime bool
+}
+
+// NewReplaySource creates a replay source for the recording at path.
+// If realTime is true, the events are delivered with the same delays they were recorded with,
+// otherwise they are delivered as fast as possible.
+func NewReplaySource(path string, realTime bool) *ReplaySource {
+	return &ReplaySource{
+		path:     path,
+		realTime: realTime,
+	}
+}
+
+func (s *ReplaySource) Name() string {
+	return "replay:" + s.path
+}
+
+func (s *ReplaySource) Run(ctx context.Context, callbackFunc CallbackFunc, cursor *int64) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to open recording file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to read recording file: %w", err)
+	}
+	defer func() { _ = gzipReader.Close() }()
+	reader := bufio.NewReader(gzipReader)
+
+	var previousReceivedAt time.Time
+	for ctx.Err() == nil {
+		kind, receivedAt, payload, err := readFrame(reader)
+		if err != nil {
+			// A recording that wasn't closed properly ends with a truncated frame
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return ErrSourceExhausted
+			}
+			return fmt.Errorf("failed to read recording frame: %w", err)
+		}
+
+		if s.realTime && !previousReceivedAt.IsZero() {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(receivedAt.Sub(previousReceivedAt)):
+			}
+		}
+		previousReceivedAt = receivedAt
+
+		switch kind {
+		case frameKindCommit:
+			var evt comatproto.SyncSubscribeRepos_Commit
+			if err := evt.UnmarshalCBOR(bytes.NewReader(payload)); err != nil {
+				return fmt.Errorf("failed to decode recorded commit: %w", err)
+			}
+			if cursor != nil && evt.Seq <= *cursor {
+				continue
+			}
+			if err := HandleRepoCommit(ctx, &evt, callbackFunc); err != nil {
+				return err
+			}
+		case frameKindAccount:
+			var evt comatproto.SyncSubscribeRepos_Account
+			if err := evt.UnmarshalCBOR(bytes.NewReader(payload)); err != nil {
+				return fmt.Errorf("failed to decode recorded account event: %w", err)
+			}
+			if cursor != nil && evt.Seq <= *cursor {
+				continue
+			}
+			if err := HandleRepoAccount(&evt, callbackFunc); err != nil {
+				return err
+			}
+		case frameKindIdentity:
+			var evt comatproto.SyncSubscribeRepos_Identity
+			if err := evt.UnmarshalCBOR(bytes.NewReader(payload)); err != nil {
+				return fmt.Errorf("failed to decode recorded identity event: %w", err)
+			}
+			if cursor != nil && evt.Seq <= *cursor {
+				continue
+			}
+			if err := HandleRepoIdentity(&evt, callbackFunc); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func readFrame(reader io.Reader) (byte, time.Time, []byte, error) {
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, time.Time{}, nil, err
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(header[9:13]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, time.Time{}, nil, err
+	}
+
+	receivedAt := time.Unix(0, int64(binary.BigEndian.Uint64(header[1:9])))
+	return header[0], receivedAt, payload, nil
+}
@@ -0,0 +1,206 @@
+package consumer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/consumer/consumertest"
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/events/schedulers/parallel"
+	"github.com/bluesky-social/indigo/repomgr"
+)
+
+const replayTestDID = "did:plc:replayreplayreplayreplay"
+
+func newTestCommit(t *testing.T, seq int64, records ...consumertest.Record) *comatproto.SyncSubscribeRepos_Commit {
+	t.Helper()
+
+	commit, err := consumertest.NewCommit(seq, replayTestDID, records...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commit
+}
+
+func newTestPost(rkey string, text string) consumertest.Record {
+	return consumertest.Record{
+		Collection: "app.bsky.feed.post",
+		RecordKey:  rkey,
+		Value:      &bsky.FeedPost{Text: text, Langs: []string{"az"}, CreatedAt: time.Now().UTC().Format(time.RFC3339)},
+	}
+}
+
+// readRecordedSequences returns the sequences of the frames of the recording at path.
+func readRecordedSequences(t *testing.T, path string) []int64 {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(gzipReader)
+
+	var sequences []int64
+	for {
+		kind, _, payload, err := readFrame(reader)
+		if err != nil {
+			break
+		}
+		if kind != frameKindCommit {
+			t.Fatalf("unexpected frame kind %d", kind)
+		}
+		var evt comatproto.SyncSubscribeRepos_Commit
+		if err := evt.UnmarshalCBOR(bytes.NewReader(payload)); err != nil {
+			t.Fatal(err)
+		}
+		sequences = append(sequences, evt.Seq)
+	}
+	return sequences
+}
+
+func TestRecordingSchedulerRecordsInStreamOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stream.rec.gz")
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The workers finish the events of the first repos last
+	handler := func(ctx context.Context, evt *events.XRPCStreamEvent) error {
+		if evt.Sequence() <= 4 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return nil
+	}
+	scheduler := &recordingScheduler{
+		Scheduler: parallel.NewScheduler(8, 100, "test", handler),
+		recorder:  recorder,
+	}
+
+	var want []int64
+	for seq := int64(1); seq <= 20; seq++ {
+		commit := newTestCommit(t, seq, newTestPost("post", "Salam"))
+		commit.Repo = commit.Repo + string(rune('a'+seq))
+		if err := scheduler.AddWork(context.Background(), commit.Repo, &events.XRPCStreamEvent{RepoCommit: commit}); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, seq)
+	}
+	scheduler.Shutdown()
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readRecordedSequences(t, path); !slices.Equal(got, want) {
+		t.Errorf("recorded sequences = %v, want %v", got, want)
+	}
+}
+
+func TestReplaySourceDeliversRecordedEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stream.rec.gz")
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handle := "replay.bsky.social"
+	status := "deactivated"
+	commits := []*comatproto.SyncSubscribeRepos_Commit{
+		newTestCommit(t, 1, newTestPost("first", "Salam, necəsiniz?")),
+		newTestCommit(t, 2,
+			newTestPost("second", "Bakıda hava gözəldir"),
+			consumertest.Record{
+				Collection: "app.bsky.feed.like",
+				RecordKey:  "like",
+				Value: &bsky.FeedLike{
+					Subject:   &comatproto.RepoStrongRef{Uri: "at://" + replayTestDID + "/app.bsky.feed.post/first", Cid: "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm"},
+					CreatedAt: time.Now().UTC().Format(time.RFC3339),
+				},
+			},
+		),
+		newTestCommit(t, 3, consumertest.Record{Collection: "app.bsky.feed.post", RecordKey: "first"}),
+	}
+	for _, commit := range commits[:2] {
+		if err := recorder.RecordCommit(commit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recorder.RecordIdentity(&comatproto.SyncSubscribeRepos_Identity{Seq: 3, Did: replayTestDID, Handle: &handle}); err != nil {
+		t.Fatal(err)
+	}
+	commits[2].Seq = 4
+	if err := recorder.RecordCommit(commits[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.RecordAccount(&comatproto.SyncSubscribeRepos_Account{Seq: 5, Did: replayTestDID, Status: &status}); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	type delivered struct {
+		seq        int64
+		collection string
+		rkey       string
+		action     repomgr.EventKind
+		text       string
+	}
+	replay := func(cursor *int64) []delivered {
+		var got []delivered
+		err := NewReplaySource(path, false).Run(context.Background(), func(data CallbackData) {
+			if data.Unordered {
+				t.Errorf("replayed event %d is unordered", data.Sequence)
+			}
+			event := delivered{seq: data.Sequence, collection: data.Collection, rkey: data.RecordKey.String(), action: data.Action}
+			switch {
+			case data.Identity != nil:
+				event.collection = "#identity"
+			case data.Account != nil:
+				event.collection = "#account"
+			case data.Collection == "app.bsky.feed.post":
+				event.text = data.Post.Text
+			}
+			got = append(got, event)
+		}, cursor)
+		if !errors.Is(err, ErrSourceExhausted) {
+			t.Errorf("Run = %v, want ErrSourceExhausted", err)
+		}
+		return got
+	}
+
+	all := []delivered{
+		{seq: 1, collection: "app.bsky.feed.post", rkey: "first", action: repomgr.EvtKindCreateRecord, text: "Salam, necəsiniz?"},
+		{seq: 2, collection: "app.bsky.feed.post", rkey: "second", action: repomgr.EvtKindCreateRecord, text: "Bakıda hava gözəldir"},
+		{seq: 2, collection: "app.bsky.feed.like", rkey: "like", action: repomgr.EvtKindCreateRecord},
+		{seq: 3, collection: "#identity"},
+		{seq: 4, collection: "app.bsky.feed.post", rkey: "first", action: repomgr.EvtKindDeleteRecord},
+		{seq: 5, collection: "#account"},
+	}
+
+	// Replays of the same recording are identical
+	for range 2 {
+		if got := replay(nil); !slices.Equal(got, all) {
+			t.Errorf("replay = %+v, want %+v", got, all)
+		}
+	}
+
+	cursor := int64(2)
+	if got := replay(&cursor); !slices.Equal(got, all[3:]) {
+		t.Errorf("replay after cursor %d = %+v, want %+v", cursor, got, all[3:])
+	}
+}
@@ -0,0 +1,92 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bluesky-social/indigo/events"
+)
+
+// sequenceTracker follows the events dispatched to a parallel scheduler. The workers of the
+// scheduler finish events out of order, so the highest handled sequence is not a safe cursor:
+// events with lower sequences may still be in flight. The tracker keeps the highest sequence
+// below which every dispatched event has been handled instead.
+type sequenceTracker struct {
+	mu       sync.Mutex
+	pending  []int64 // Dispatched, not yet contiguous sequences in stream order
+	finished map[int64]struct{}
+	handled  int64
+}
+
+func newSequenceTracker() *sequenceTracker {
+	return &sequenceTracker{
+		finished: map[int64]struct{}{},
+		handled:  -1,
+	}
+}
+
+// start registers a dispatched event. Events have to be started in stream order.
+func (t *sequenceTracker) start(seq int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pending = append(t.pending, seq)
+}
+
+// finish marks a started event as handled. It returns the highest sequence below which every
+// started event has been handled, and whether finishing the event advanced it.
+func (t *sequenceTracker) finish(seq int64) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.finished[seq] = struct{}{}
+
+	advanced := false
+	for len(t.pending) > 0 {
+		if _, ok := t.finished[t.pending[0]]; !ok {
+			break
+		}
+		delete(t.finished, t.pending[0])
+		t.handled = t.pending[0]
+		t.pending = t.pending[1:]
+		advanced = true
+	}
+
+	return t.handled, advanced
+}
+
+// trackingScheduler starts the events in the tracker as they are dispatched, in stream order.
+type trackingScheduler struct {
+	events.Scheduler
+	tracker *sequenceTracker
+}
+
+func (s *trackingScheduler) AddWork(ctx context.Context, repo string, val *events.XRPCStreamEvent) error {
+	// Info and error frames have no sequence
+	if seq := val.Sequence(); seq >= 0 {
+		s.tracker.start(seq)
+	}
+	return s.Scheduler.AddWork(ctx, repo, val)
+}
+
+// trackedHandler wraps the event handler of a scheduler to finish the events in the tracker.
+// Whenever the handled prefix of the stream grows, a Checkpoint event is delivered to callbackFunc.
+func trackedHandler(
+	tracker *sequenceTracker,
+	handler func(context.Context, *events.XRPCStreamEvent) error,
+	callbackFunc CallbackFunc,
+) func(context.Context, *events.XRPCStreamEvent) error {
+	return func(ctx context.Context, evt *events.XRPCStreamEvent) error {
+		seq := evt.Sequence()
+		if seq < 0 {
+			return handler(ctx, evt)
+		}
+
+		err := handler(ctx, evt)
+		// The records of the event were delivered by the handler, before the checkpoint covering them
+		if handled, advanced := tracker.finish(seq); advanced {
+			callbackFunc(CallbackData{Sequence: handled, Checkpoint: true})
+		}
+		return err
+	}
+}
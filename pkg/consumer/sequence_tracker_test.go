@@ -0,0 +1,126 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/events/schedulers/parallel"
+)
+
+func TestSequenceTrackerReportsContiguousPrefix(t *testing.T) {
+	tracker := newSequenceTracker()
+	for _, seq := range []int64{10, 11, 12, 15} {
+		tracker.start(seq)
+	}
+
+	steps := []struct {
+		finish       int64
+		wantHandled  int64
+		wantAdvanced bool
+	}{
+		// 10 is still in flight
+		{finish: 12, wantHandled: -1, wantAdvanced: false},
+		{finish: 11, wantHandled: -1, wantAdvanced: false},
+		{finish: 10, wantHandled: 12, wantAdvanced: true},
+		{finish: 15, wantHandled: 15, wantAdvanced: true},
+	}
+	for _, step := range steps {
+		handled, advanced := tracker.finish(step.finish)
+		if handled != step.wantHandled || advanced != step.wantAdvanced {
+			t.Errorf("finish(%d) = %d, %v, want %d, %v",
+				step.finish, handled, advanced, step.wantHandled, step.wantAdvanced)
+		}
+	}
+}
+
+func TestTrackedSchedulerCheckpointsOnlyHandledEvents(t *testing.T) {
+	const eventCount = 200
+
+	// The first event is held back until every other event was handled
+	release := make(chan struct{})
+	var (
+		mu          sync.Mutex
+		handled     = map[int64]bool{}
+		checkpoints []int64
+	)
+	handler := func(ctx context.Context, evt *events.XRPCStreamEvent) error {
+		seq := evt.Sequence()
+		if seq == 1 {
+			<-release
+		}
+		mu.Lock()
+		handled[seq] = true
+		mu.Unlock()
+		return nil
+	}
+
+	tracker := newSequenceTracker()
+	callbackFunc := func(data CallbackData) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !data.Checkpoint {
+			t.Errorf("unexpected event %+v", data)
+			return
+		}
+		for seq := int64(1); seq <= data.Sequence; seq++ {
+			if !handled[seq] {
+				t.Errorf("checkpoint %d covers the unhandled event %d", data.Sequence, seq)
+				break
+			}
+		}
+		checkpoints = append(checkpoints, data.Sequence)
+	}
+
+	scheduler := &trackingScheduler{
+		Scheduler: parallel.NewScheduler(8, 1000, "test", trackedHandler(tracker, handler, callbackFunc)),
+		tracker:   tracker,
+	}
+
+	ctx := context.Background()
+	for seq := int64(1); seq <= eventCount; seq++ {
+		// Events of the same repo are handled in order, so the held back event gets a repo of its own
+		repo := fmt.Sprintf("did:plc:repo%d", seq%16)
+		if seq == 1 {
+			repo = "did:plc:held"
+		}
+		evt := &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{Repo: repo, Seq: seq}}
+		if err := scheduler.AddWork(ctx, repo, evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitHandled := func(count int) {
+		for {
+			mu.Lock()
+			done := len(handled) >= count
+			mu.Unlock()
+			if done {
+				return
+			}
+			runtime.Gosched()
+		}
+	}
+
+	waitHandled(eventCount - 1)
+	mu.Lock()
+	if len(checkpoints) != 0 {
+		t.Errorf("checkpoints %v reported while the first event is in flight", checkpoints)
+	}
+	mu.Unlock()
+
+	close(release)
+	waitHandled(eventCount)
+	scheduler.Shutdown()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(checkpoints) == 0 || checkpoints[len(checkpoints)-1] != eventCount {
+		t.Errorf("last checkpoint of %v, want %d", checkpoints, eventCount)
+	}
+}
@@ -0,0 +1,46 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrStream is returned by a Source when the event stream breaks after a successful
+// connection. The consumer reconnects on these errors and gives up on any other.
+var ErrStream = errors.New("stream error")
+
+// ErrSourceExhausted is returned by a finite Source (e.g. a replay) that has delivered all of its events.
+var ErrSourceExhausted = errors.New("source exhausted")
+
+// Source is an event stream that feeds record events into a CallbackFunc.
+type Source interface {
+	// Name identifies the source (usually its host) in logs.
+	Name() string
+
+	// Run consumes the stream until it breaks or ctx is cancelled.
+	// A nil cursor starts from the current position of the stream.
+	Run(ctx context.Context, callbackFunc CallbackFunc, cursor *int64) error
+}
+
+// FirehoseSource consumes the CBOR com.atproto.sync.subscribeRepos stream of a relay.
+type FirehoseSource struct {
+	relayHost string
+	recorder  *Recorder
+}
+
+// NewFirehoseSource creates a firehose source.
+// If recorder is not nil, every received commit is written to it.
+func NewFirehoseSource(relayHost string, recorder *Recorder) *FirehoseSource {
+	return &FirehoseSource{
+		relayHost: relayHost,
+		recorder:  recorder,
+	}
+}
+
+func (s *FirehoseSource) Name() string {
+	return s.relayHost
+}
+
+func (s *FirehoseSource) Run(ctx context.Context, callbackFunc CallbackFunc, cursor *int64) error {
+	return RunFirehoseConsumer(ctx, s.relayHost, callbackFunc, cursor, s.recorder)
+}
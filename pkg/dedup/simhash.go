@@ -0,0 +1,65 @@
+// Package dedup detects clusters of near-identical posts of different authors, like copypasta spam waves.
+//
+// Posts are compared by the SimHash fingerprint of their normalized text. Texts that differ in a few
+// words have fingerprints that differ in a few bits, so near-identical posts are found by comparing the
+// Hamming distance of the fingerprints.
+package dedup
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+
+	"github.com/aykhans/bsky-feedgen/pkg/textnorm"
+)
+
+// MinWords is the minimum number of words of a text to be fingerprinted. Short texts like greetings
+// are legitimately posted by many authors.
+const MinWords = 5
+
+// Fingerprint returns the 64-bit SimHash of the words and word pairs of the text, normalized with
+// textnorm.Normalize. It returns false if the text has less than MinWords words.
+func Fingerprint(text string) (uint64, bool) {
+	words := strings.FieldsFunc(textnorm.Normalize(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) < MinWords {
+		return 0, false
+	}
+
+	var weights [64]int
+	addFeature := func(feature string) {
+		hash := fnv.New64a()
+		_, _ = hash.Write([]byte(feature))
+		sum := hash.Sum64()
+		for i := range weights {
+			if sum&(1<<i) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+
+	for i, word := range words {
+		addFeature(word)
+		if i > 0 {
+			addFeature(words[i-1] + " " + word)
+		}
+	}
+
+	var fingerprint uint64
+	for i, weight := range weights {
+		if weight > 0 {
+			fingerprint |= 1 << i
+		}
+	}
+
+	return fingerprint, true
+}
+
+// Distance returns the number of different bits of two fingerprints.
+func Distance(a uint64, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,105 @@
+package dedup
+
+import "testing"
+
+const copypasta = "Diqqət! Sabahdan etibarən şəhərin mərkəzi küçələrində su kəsiləcək. Bələdiyyə bildirir ki, " +
+	"təmir işləri üç gün davam edəcək və sakinlər əvvəlcədən su ehtiyatı toplamalıdırlar. " +
+	"Bu xəbəri dostlarınızla paylaşın ki, hamı xəbərdar olsun"
+
+func TestFingerprint(t *testing.T) {
+	base, ok := Fingerprint(copypasta)
+	if !ok {
+		t.Fatal("the copypasta has no fingerprint")
+	}
+
+	tests := []struct {
+		name        string
+		text        string
+		minDistance int
+		maxDistance int
+	}{
+		{
+			name: "uppercase",
+			text: "DİQQƏT! SABAHDAN ETİBARƏN ŞƏHƏRİN MƏRKƏZİ KÜÇƏLƏRİNDƏ SU KƏSİLƏCƏK. BƏLƏDİYYƏ BİLDİRİR Kİ, " +
+				"TƏMİR İŞLƏRİ ÜÇ GÜN DAVAM EDƏCƏK VƏ SAKİNLƏR ƏVVƏLCƏDƏN SU EHTİYATI TOPLAMALIDIRLAR. " +
+				"BU XƏBƏRİ DOSTLARINIZLA PAYLAŞIN Kİ, HAMI XƏBƏRDAR OLSUN",
+		},
+		{
+			name: "without diacritics and punctuation",
+			text: "Diqqet Sabahdan etibaren seherin merkezi kucelerinde su kesilecek Belediyye bildirir ki " +
+				"temir isleri uc gun davam edecek ve sakinler evvelceden su ehtiyati toplamalidirlar " +
+				"Bu xeberi dostlarinizla paylasin ki hami xeberdar olsun",
+		},
+		{
+			name: "homoglyphs",
+			text: "Diqqət! Sаbаhdаn etibarən şəhərin mərkəzi küçələrində su kəsiləcək. Bələdiyyə bildirir ki, " +
+				"təmir işləri üç gün davam edəcək və sakinlər əvvəlcədən su ehtiyatı toplamalıdırlar. " +
+				"Bu xəbəri dostlarınızla paylaşın ki, hamı xəbərdar olsun",
+		},
+		{
+			name: "one word changed",
+			text: "Diqqət! Sabahdan etibarən şəhərin mərkəzi küçələrində su kəsiləcək. Bələdiyyə bildirir ki, " +
+				"təmir işləri dörd gün davam edəcək və sakinlər əvvəlcədən su ehtiyatı toplamalıdırlar. " +
+				"Bu xəbəri dostlarınızla paylaşın ki, hamı xəbərdar olsun",
+			minDistance: 1,
+			maxDistance: 7,
+		},
+		{
+			name:        "one word appended",
+			text:        copypasta + " yayın",
+			minDistance: 1,
+			maxDistance: 7,
+		},
+		{
+			name:        "different text",
+			text:        "Sabah Gəncədə futbol matçı keçiriləcək, stadionda yer qalmayıb, hamı vaxtında gəlsin",
+			minDistance: 16,
+			maxDistance: 64,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fingerprint, ok := Fingerprint(test.text)
+			if !ok {
+				t.Fatal("the text has no fingerprint")
+			}
+			if distance := Distance(base, fingerprint); distance < test.minDistance || distance > test.maxDistance {
+				t.Errorf("distance = %d, want %d-%d", distance, test.minDistance, test.maxDistance)
+			}
+		})
+	}
+}
+
+func TestFingerprintShortTexts(t *testing.T) {
+	for _, text := range []string{"", "Salam!", "Salam, necəsən? Yaxşıyam", "🎉 🎉 🎉 🎉 🎉 🎉", "... !!! ??? --- ,,,"} {
+		if _, ok := Fingerprint(text); ok {
+			t.Errorf("Fingerprint(%q) returned a fingerprint for a text with less than %d words", text, MinWords)
+		}
+	}
+	if _, ok := Fingerprint("bir iki üç dörd beş"); !ok {
+		t.Errorf("Fingerprint returned no fingerprint for a text with %d words", MinWords)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want int
+	}{
+		{a: 0, b: 0, want: 0},
+		{a: 0xff00, b: 0xff00, want: 0},
+		{a: 0b1010, b: 0b0110, want: 2},
+		{a: 0, b: 1 << 63, want: 1},
+		{a: 0, b: ^uint64(0), want: 64},
+	}
+
+	for _, test := range tests {
+		if got := Distance(test.a, test.b); got != test.want {
+			t.Errorf("Distance(%#x, %#x) = %d, want %d", test.a, test.b, got, test.want)
+		}
+		if got := Distance(test.b, test.a); got != test.want {
+			t.Errorf("Distance(%#x, %#x) = %d, want %d", test.b, test.a, got, test.want)
+		}
+	}
+}
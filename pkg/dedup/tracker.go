@@ -0,0 +1,282 @@
+package dedup
+
+import (
+	"slices"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+)
+
+// bands is the number of 8-bit bands the fingerprints are indexed by. Fingerprints with at most
+// bands-1 different bits share at least one band, so only the posts sharing a band are compared.
+const bands = 8
+
+// MaxClusterPosts is the maximum number of post IDs and authors stored of a cluster.
+const MaxClusterPosts = 1000
+
+// Cluster is a group of near-identical posts.
+type Cluster struct {
+	// ID of the first post of the cluster
+	ID          string
+	Fingerprint uint64
+	// Text of the first post of the cluster
+	SampleText  string
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+	PostCount   int
+	// Flagged clusters have posts of at least FeedDuplicatesConfig.MinAuthors authors
+	Flagged bool
+	// Number of posts of the cluster that aren't in the feed
+	DroppedCount int
+	// First MaxClusterPosts post IDs and authors of the cluster
+	PostIDs []string
+	DIDs    []string
+
+	dids map[string]bool
+	// Posts of the cluster that are in the feed
+	keptIDs []string
+}
+
+// AuthorCount returns the number of different authors of the cluster, at most MaxClusterPosts.
+func (c *Cluster) AuthorCount() int {
+	return len(c.dids)
+}
+
+type trackedPost struct {
+	id          string
+	fingerprint uint64
+	time        time.Time
+	cluster     *Cluster
+	kept        bool
+}
+
+// Decision is the result of tracking a post.
+type Decision struct {
+	// The post stays in the feed
+	Keep bool
+	// Posts of the cluster that were in the feed before the cluster was flagged and have to be removed
+	Retracted []string
+	// Cluster of the post, nil if the post has no near-identical posts yet or its text is too short
+	Cluster *Cluster
+}
+
+// Tracker tracks the fingerprints of the posts selected by a generator within the duplicate window
+// and decides which posts of the flagged clusters stay in the feed. It is not safe for concurrent use.
+type Tracker struct {
+	config *config.FeedDuplicatesConfig
+	posts  map[string]*trackedPost
+	// Posts in the order they were tracked, for eviction
+	order  []*trackedPost
+	index  [bands]map[uint8][]*trackedPost
+	latest time.Time
+	// Flagged clusters changed since the last Changed call
+	changed map[string]*Cluster
+}
+
+func NewTracker(config *config.FeedDuplicatesConfig) *Tracker {
+	tracker := &Tracker{
+		config:  config,
+		posts:   make(map[string]*trackedPost),
+		changed: make(map[string]*Cluster),
+	}
+	for i := range tracker.index {
+		tracker.index[i] = make(map[uint8][]*trackedPost)
+	}
+
+	return tracker
+}
+
+// Track adds the post to the cluster of its near-identical posts and decides whether it stays in the feed.
+// Tracking an already tracked post returns its earlier decision, so scanning a post again doesn't count it twice.
+func (t *Tracker) Track(post *collections.Post) Decision {
+	if tracked, ok := t.posts[post.ID]; ok {
+		return Decision{Keep: tracked.kept, Cluster: tracked.cluster}
+	}
+
+	fingerprint, ok := Fingerprint(post.Text)
+	if !ok {
+		return Decision{Keep: true}
+	}
+
+	// Posts can claim any creation time, so future times are clamped to now
+	postTime := post.CreatedAt
+	if now := time.Now(); postTime.After(now) {
+		postTime = now
+	}
+	if postTime.After(t.latest) {
+		t.latest = postTime
+		t.evict()
+	}
+
+	cluster := t.find(fingerprint, postTime)
+	if cluster == nil {
+		cluster = &Cluster{
+			ID:          post.ID,
+			Fingerprint: fingerprint,
+			SampleText:  post.Text,
+			FirstSeenAt: postTime,
+			dids:        make(map[string]bool),
+		}
+	}
+
+	tracked := &trackedPost{id: post.ID, fingerprint: fingerprint, time: postTime, cluster: cluster}
+	t.posts[post.ID] = tracked
+	t.order = append(t.order, tracked)
+	for i, key := range bandKeys(fingerprint) {
+		t.index[i][key] = append(t.index[i][key], tracked)
+	}
+
+	cluster.PostCount++
+	if postTime.After(cluster.LastSeenAt) {
+		cluster.LastSeenAt = postTime
+	}
+	if len(cluster.PostIDs) < MaxClusterPosts {
+		cluster.PostIDs = append(cluster.PostIDs, post.ID)
+	}
+	if !cluster.dids[post.DID] && len(cluster.dids) < MaxClusterPosts {
+		cluster.dids[post.DID] = true
+		cluster.DIDs = append(cluster.DIDs, post.DID)
+	}
+
+	decision := Decision{}
+	limit := t.keepLimit()
+	if !cluster.Flagged && len(cluster.dids) >= t.config.MinAuthors {
+		cluster.Flagged = true
+		if limit >= 0 && len(cluster.keptIDs) > limit {
+			decision.Retracted = slices.Clone(cluster.keptIDs[limit:])
+			for _, id := range decision.Retracted {
+				if retracted, ok := t.posts[id]; ok {
+					retracted.kept = false
+				}
+			}
+			cluster.keptIDs = cluster.keptIDs[:limit]
+			cluster.DroppedCount += len(decision.Retracted)
+		}
+	}
+
+	tracked.kept = !cluster.Flagged || limit < 0 || len(cluster.keptIDs) < limit
+	if tracked.kept {
+		cluster.keptIDs = append(cluster.keptIDs, post.ID)
+	} else {
+		cluster.DroppedCount++
+	}
+	if cluster.Flagged {
+		t.changed[cluster.ID] = cluster
+	}
+
+	decision.Keep = tracked.kept
+	if cluster.PostCount > 1 {
+		decision.Cluster = cluster
+	}
+
+	return decision
+}
+
+// Remove untracks the posts deleted by their authors. A deleted post that was kept in the feed frees
+// its place in its cluster, so the next post of a capped cluster is kept.
+func (t *Tracker) Remove(ids ...string) {
+	for _, id := range ids {
+		tracked, ok := t.posts[id]
+		if !ok {
+			continue
+		}
+
+		t.untrack(tracked)
+		t.order = slices.DeleteFunc(t.order, func(p *trackedPost) bool { return p == tracked })
+		if tracked.kept {
+			tracked.cluster.keptIDs = slices.DeleteFunc(tracked.cluster.keptIDs, func(keptID string) bool { return keptID == id })
+		}
+	}
+}
+
+// Changed returns the flagged clusters that changed since the last call.
+func (t *Tracker) Changed() []*Cluster {
+	if len(t.changed) == 0 {
+		return nil
+	}
+
+	clusters := make([]*Cluster, 0, len(t.changed))
+	for _, cluster := range t.changed {
+		clusters = append(clusters, cluster)
+	}
+	clear(t.changed)
+
+	return clusters
+}
+
+// Action returns the duplicate action of the tracked feed.
+func (t *Tracker) Action() types.DuplicateAction {
+	return t.config.Action
+}
+
+// keepLimit returns the number of posts kept of a flagged cluster, -1 if all of them are kept.
+func (t *Tracker) keepLimit() int {
+	switch {
+	case t.config.Action.IsDrop():
+		return 0
+	case t.config.Action.IsCap():
+		return t.config.MaxPosts
+	default:
+		return -1
+	}
+}
+
+// find returns the cluster of the closest tracked post within the window and the max distance of the fingerprint.
+func (t *Tracker) find(fingerprint uint64, postTime time.Time) *Cluster {
+	var closest *trackedPost
+	closestDistance := t.config.MaxDistance + 1
+	for i, key := range bandKeys(fingerprint) {
+		for _, candidate := range t.index[i][key] {
+			if difference := postTime.Sub(candidate.time); difference > t.config.Window || -difference > t.config.Window {
+				continue
+			}
+			if distance := Distance(fingerprint, candidate.fingerprint); distance < closestDistance {
+				closest, closestDistance = candidate, distance
+			}
+		}
+	}
+
+	if closest == nil {
+		return nil
+	}
+	return closest.cluster
+}
+
+// evict removes the posts tracked before the window of the latest post. Posts are evicted in the
+// order they were tracked, which is close to the order of their creation times.
+func (t *Tracker) evict() {
+	cutoff := t.latest.Add(-t.config.Window)
+
+	evicted := 0
+	for evicted < len(t.order) && t.order[evicted].time.Before(cutoff) {
+		t.untrack(t.order[evicted])
+		evicted++
+	}
+
+	if evicted > 0 {
+		t.order = slices.Delete(t.order, 0, evicted)
+	}
+}
+
+// untrack removes the post from the tracked posts and the band index, but not from the tracking order.
+func (t *Tracker) untrack(tracked *trackedPost) {
+	delete(t.posts, tracked.id)
+	for i, key := range bandKeys(tracked.fingerprint) {
+		bucket := slices.DeleteFunc(t.index[i][key], func(p *trackedPost) bool { return p == tracked })
+		if len(bucket) == 0 {
+			delete(t.index[i], key)
+		} else {
+			t.index[i][key] = bucket
+		}
+	}
+}
+
+func bandKeys(fingerprint uint64) [bands]uint8 {
+	var keys [bands]uint8
+	for i := range keys {
+		keys[i] = uint8(fingerprint >> (8 * i))
+	}
+	return keys
+}
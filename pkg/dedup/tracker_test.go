@@ -0,0 +1,205 @@
+package dedup
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+)
+
+func newTestTracker(action types.DuplicateAction, maxPosts int) *Tracker {
+	return NewTracker(&config.FeedDuplicatesConfig{
+		Action:      action,
+		Window:      time.Hour,
+		MinAuthors:  3,
+		MaxPosts:    maxPosts,
+		MaxDistance: 7,
+	})
+}
+
+// testPosts creates posts of the text created a minute apart, ending an hour ago.
+func testPosts(text string, dids ...string) []*collections.Post {
+	createdAt := time.Now().Add(-time.Hour - time.Duration(len(dids))*time.Minute)
+	posts := make([]*collections.Post, len(dids))
+	for i, did := range dids {
+		createdAt = createdAt.Add(time.Minute)
+		posts[i] = &collections.Post{ID: fmt.Sprintf("%s/%d", did, i), DID: did, Text: text, CreatedAt: createdAt}
+	}
+	return posts
+}
+
+func TestTrackerSameAuthorDoesNotFormCluster(t *testing.T) {
+	tracker := newTestTracker(types.DuplicateActionDrop, 0)
+
+	for i, post := range testPosts(copypasta, "did:plc:a", "did:plc:a", "did:plc:a", "did:plc:a") {
+		decision := tracker.Track(post)
+		if !decision.Keep || len(decision.Retracted) > 0 {
+			t.Errorf("post %d: decision %+v, want kept", i, decision)
+		}
+		if i > 0 && (decision.Cluster == nil || decision.Cluster.Flagged || decision.Cluster.PostCount != i+1) {
+			t.Errorf("post %d: cluster %+v, want an unflagged cluster of %d posts", i, decision.Cluster, i+1)
+		}
+	}
+	if changed := tracker.Changed(); len(changed) != 0 {
+		t.Errorf("changed clusters = %d, want 0", len(changed))
+	}
+}
+
+func TestTrackerActions(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   types.DuplicateAction
+		maxPosts int
+		// Whether each post is kept when it is tracked
+		wantKeep []bool
+		// Posts retracted when the third author flags the cluster
+		wantRetracted []string
+		wantDropped   int
+	}{
+		{
+			name:     "flag",
+			action:   types.DuplicateActionFlag,
+			wantKeep: []bool{true, true, true, true},
+		},
+		{
+			name:          "drop",
+			action:        types.DuplicateActionDrop,
+			wantKeep:      []bool{true, true, false, false},
+			wantRetracted: []string{"did:plc:a/0", "did:plc:b/1"},
+			wantDropped:   4,
+		},
+		{
+			name:          "cap",
+			action:        types.DuplicateActionCap,
+			maxPosts:      1,
+			wantKeep:      []bool{true, true, false, false},
+			wantRetracted: []string{"did:plc:b/1"},
+			wantDropped:   3,
+		},
+		{
+			name:        "cap above the flagging posts",
+			action:      types.DuplicateActionCap,
+			maxPosts:    3,
+			wantKeep:    []bool{true, true, true, false},
+			wantDropped: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := newTestTracker(test.action, test.maxPosts)
+
+			var cluster *Cluster
+			for i, post := range testPosts(copypasta, "did:plc:a", "did:plc:b", "did:plc:c", "did:plc:d") {
+				decision := tracker.Track(post)
+				if decision.Keep != test.wantKeep[i] {
+					t.Errorf("post %d kept = %v, want %v", i, decision.Keep, test.wantKeep[i])
+				}
+				if i == 2 && !slices.Equal(decision.Retracted, test.wantRetracted) {
+					t.Errorf("retracted = %v, want %v", decision.Retracted, test.wantRetracted)
+				}
+				if i != 2 && len(decision.Retracted) > 0 {
+					t.Errorf("post %d retracted %v", i, decision.Retracted)
+				}
+				cluster = decision.Cluster
+			}
+
+			if cluster == nil || !cluster.Flagged || cluster.AuthorCount() != 4 || cluster.PostCount != 4 {
+				t.Fatalf("cluster %+v, want a flagged cluster of 4 authors", cluster)
+			}
+			if cluster.ID != "did:plc:a/0" || cluster.SampleText != copypasta {
+				t.Errorf("cluster ID, sample = %q, %q, want the first post", cluster.ID, cluster.SampleText)
+			}
+			if cluster.DroppedCount != test.wantDropped {
+				t.Errorf("dropped = %d, want %d", cluster.DroppedCount, test.wantDropped)
+			}
+			if changed := tracker.Changed(); len(changed) != 1 || changed[0] != cluster {
+				t.Errorf("changed = %v, want the cluster", changed)
+			}
+			if changed := tracker.Changed(); len(changed) != 0 {
+				t.Errorf("changed after the last call = %v, want none", changed)
+			}
+		})
+	}
+}
+
+func TestTrackerRetrackReturnsEarlierDecision(t *testing.T) {
+	tracker := newTestTracker(types.DuplicateActionDrop, 0)
+	posts := testPosts(copypasta, "did:plc:a", "did:plc:b", "did:plc:c")
+	for _, post := range posts {
+		tracker.Track(post)
+	}
+
+	// The first post was retracted by the third one
+	for i, wantKeep := range []bool{false, false, false} {
+		decision := tracker.Track(posts[i])
+		if decision.Keep != wantKeep || len(decision.Retracted) > 0 {
+			t.Errorf("retracking post %d: %+v, want kept %v without retractions", i, decision, wantKeep)
+		}
+		if decision.Cluster == nil || decision.Cluster.PostCount != 3 {
+			t.Errorf("retracking post %d changed the cluster: %+v", i, decision.Cluster)
+		}
+	}
+}
+
+func TestTrackerEvictsPostsOutsideWindow(t *testing.T) {
+	tracker := newTestTracker(types.DuplicateActionDrop, 0)
+	start := time.Now().Add(-5 * time.Hour)
+	newPost := func(id string, did string, createdAt time.Time) *collections.Post {
+		return &collections.Post{ID: id, DID: did, Text: copypasta, CreatedAt: createdAt}
+	}
+
+	tracker.Track(newPost("old-a", "did:plc:a", start))
+	tracker.Track(newPost("old-b", "did:plc:b", start.Add(time.Minute)))
+
+	// The old posts are more than the window before the new ones
+	decision := tracker.Track(newPost("new-c", "did:plc:c", start.Add(2*time.Hour)))
+	if !decision.Keep || decision.Cluster != nil {
+		t.Errorf("decision %+v, want a kept post without cluster", decision)
+	}
+	if len(tracker.posts) != 1 || len(tracker.order) != 1 {
+		t.Errorf("tracked posts = %d, order = %d, want only the new post", len(tracker.posts), len(tracker.order))
+	}
+	for i := range tracker.index {
+		for key, bucket := range tracker.index[i] {
+			if len(bucket) != 1 || bucket[0].id != "new-c" {
+				t.Errorf("band %d key %d has %d posts after eviction", i, key, len(bucket))
+			}
+		}
+	}
+
+	// An evicted post is tracked again as a new post
+	decision = tracker.Track(newPost("old-a", "did:plc:a", start))
+	if decision.Cluster != nil {
+		t.Errorf("evicted post joined the cluster %+v", decision.Cluster)
+	}
+}
+
+func TestTrackerRemoveDeletedPosts(t *testing.T) {
+	tracker := newTestTracker(types.DuplicateActionCap, 1)
+	posts := testPosts(copypasta, "did:plc:a", "did:plc:b", "did:plc:c", "did:plc:d", "did:plc:e")
+
+	for _, post := range posts[:3] {
+		tracker.Track(post)
+	}
+
+	// The only kept post of the capped cluster is deleted by its author
+	tracker.Remove(posts[0].ID, "unknown")
+	if _, ok := tracker.posts[posts[0].ID]; ok {
+		t.Error("the deleted post is still tracked")
+	}
+	if slices.ContainsFunc(tracker.order, func(p *trackedPost) bool { return p.id == posts[0].ID }) {
+		t.Error("the deleted post is still in the tracking order")
+	}
+
+	if decision := tracker.Track(posts[3]); !decision.Keep {
+		t.Errorf("the next post after the deletion was dropped: %+v", decision)
+	}
+	if decision := tracker.Track(posts[4]); decision.Keep {
+		t.Errorf("a post over the cap was kept: %+v", decision)
+	}
+}
@@ -0,0 +1,37 @@
+package didresolver
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"github.com/bluesky-social/indigo/atproto/identity"
+)
+
+// NewDirectory creates the DID directory of the config: a bounded cache of the PLC directory and
+// did:web resolution, behind the local DID documents of config.DirectoryFile if it is set.
+func NewDirectory(config *config.DIDResolverConfig) (identity.Directory, error) {
+	var network identity.Directory
+	if !config.Offline {
+		base := &identity.BaseDirectory{
+			PLCURL:     config.PLCURL,
+			HTTPClient: http.Client{Timeout: 10 * time.Second},
+			// Only the signing keys of the DIDs are needed, not their handles
+			SkipHandleVerification: true,
+		}
+		cache := identity.NewCacheDirectory(
+			base,
+			config.CacheSize,
+			config.CacheHitTTL,
+			config.CacheErrTTL,
+			config.CacheErrTTL, // invalidHandleTTL
+		)
+		network = &cache
+	}
+
+	if config.DirectoryFile == "" {
+		return network, nil
+	}
+
+	return LoadLocalDirectory(config.DirectoryFile, network)
+}
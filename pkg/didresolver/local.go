@@ -0,0 +1,137 @@
+package didresolver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// LocalDirectory resolves the identities of the DID documents added to it, e.g. for tests or staging
+// environments without access to the PLC directory. Other DIDs and handles are resolved with the
+// fallback directory, or not found if there is none.
+type LocalDirectory struct {
+	mu         sync.RWMutex
+	identities map[syntax.DID]*identity.Identity
+	handles    map[syntax.Handle]syntax.DID
+	fallback   identity.Directory
+}
+
+var _ identity.Directory = (*LocalDirectory)(nil)
+
+// NewLocalDirectory creates an empty directory. fallback can be nil.
+func NewLocalDirectory(fallback identity.Directory) *LocalDirectory {
+	return &LocalDirectory{
+		identities: make(map[syntax.DID]*identity.Identity),
+		handles:    make(map[syntax.Handle]syntax.DID),
+		fallback:   fallback,
+	}
+}
+
+// LoadLocalDirectory creates a directory of the DID documents of the JSON file. The file has either a
+// single DID document, like the ones of `feedgen-manager dev-token keygen`, or an array of them.
+func LoadLocalDirectory(path string, fallback identity.Directory) (*LocalDirectory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []*identity.DIDDocument
+	if data = bytes.TrimSpace(data); bytes.HasPrefix(data, []byte("[")) {
+		err = json.Unmarshal(data, &docs)
+	} else {
+		doc := &identity.DIDDocument{}
+		err = json.Unmarshal(data, doc)
+		docs = append(docs, doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DID documents of %s: %w", path, err)
+	}
+
+	directory := NewLocalDirectory(fallback)
+	for _, doc := range docs {
+		if err := directory.Insert(doc); err != nil {
+			return nil, fmt.Errorf("invalid DID document in %s: %w", path, err)
+		}
+	}
+
+	return directory, nil
+}
+
+// Insert adds the identity of the DID document, replacing an earlier document of the DID.
+// The handle declared by the document is trusted without verification.
+func (d *LocalDirectory) Insert(doc *identity.DIDDocument) error {
+	if _, err := syntax.ParseDID(doc.DID.String()); err != nil {
+		return err
+	}
+
+	ident := identity.ParseIdentity(doc)
+	if handle, err := ident.DeclaredHandle(); err == nil {
+		ident.Handle = handle.Normalize()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if previous, ok := d.identities[ident.DID]; ok && !previous.Handle.IsInvalidHandle() {
+		delete(d.handles, previous.Handle)
+	}
+	d.identities[ident.DID] = &ident
+	if !ident.Handle.IsInvalidHandle() {
+		d.handles[ident.Handle] = ident.DID
+	}
+
+	return nil
+}
+
+func (d *LocalDirectory) LookupDID(ctx context.Context, did syntax.DID) (*identity.Identity, error) {
+	d.mu.RLock()
+	ident, ok := d.identities[did]
+	d.mu.RUnlock()
+	if ok {
+		identCopy := *ident
+		return &identCopy, nil
+	}
+
+	if d.fallback == nil {
+		return nil, fmt.Errorf("%w: %s", identity.ErrDIDNotFound, did)
+	}
+	return d.fallback.LookupDID(ctx, did)
+}
+
+func (d *LocalDirectory) LookupHandle(ctx context.Context, handle syntax.Handle) (*identity.Identity, error) {
+	d.mu.RLock()
+	did, ok := d.handles[handle.Normalize()]
+	d.mu.RUnlock()
+	if ok {
+		return d.LookupDID(ctx, did)
+	}
+
+	if d.fallback == nil {
+		return nil, fmt.Errorf("%w: %s", identity.ErrHandleNotFound, handle)
+	}
+	return d.fallback.LookupHandle(ctx, handle)
+}
+
+func (d *LocalDirectory) Lookup(ctx context.Context, atid syntax.AtIdentifier) (*identity.Identity, error) {
+	if handle, err := atid.AsHandle(); err == nil {
+		return d.LookupHandle(ctx, handle)
+	}
+	if did, err := atid.AsDID(); err == nil {
+		return d.LookupDID(ctx, did)
+	}
+	return nil, fmt.Errorf("at-identifier neither a handle nor a DID: %s", atid)
+}
+
+// Purge purges the identity from the fallback directory. The local identities are never purged.
+func (d *LocalDirectory) Purge(ctx context.Context, atid syntax.AtIdentifier) error {
+	if d.fallback == nil {
+		return nil
+	}
+	return d.fallback.Purge(ctx, atid)
+}
@@ -0,0 +1,241 @@
+package didresolver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	atcrypto "github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+const (
+	aliceDID = syntax.DID("did:plc:alicealicealicealicealic")
+	bobDID   = syntax.DID("did:web:bob.example.com")
+)
+
+// newTestDocument returns the DID document of a new signing key.
+func newTestDocument(t *testing.T, did syntax.DID, handle string) (*identity.DIDDocument, atcrypto.PublicKey) {
+	t.Helper()
+
+	key, err := atcrypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := &identity.DIDDocument{
+		DID: did,
+		VerificationMethod: []identity.DocVerificationMethod{
+			{
+				ID:                 did.String() + "#atproto",
+				Type:               "Multikey",
+				Controller:         did.String(),
+				PublicKeyMultibase: publicKey.Multibase(),
+			},
+		},
+	}
+	if handle != "" {
+		doc.AlsoKnownAs = []string{"at://" + handle}
+	}
+	return doc, publicKey
+}
+
+func writeTestFile(t *testing.T, value any) string {
+	t.Helper()
+
+	var data []byte
+	if raw, ok := value.(string); ok {
+		data = []byte(raw)
+	} else {
+		var err error
+		if data, err = json.MarshalIndent(value, "", "  "); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "did.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// assertSigningKey checks that the identity has the public key as its atproto signing key.
+func assertSigningKey(t *testing.T, ident *identity.Identity, want atcrypto.PublicKey) {
+	t.Helper()
+
+	publicKey, err := ident.PublicKey()
+	if err != nil {
+		t.Fatalf("signing key of %s: %v", ident.DID, err)
+	}
+	if publicKey.Multibase() != want.Multibase() {
+		t.Errorf("signing key of %s = %s, want %s", ident.DID, publicKey.Multibase(), want.Multibase())
+	}
+}
+
+func TestLoadLocalDirectorySingleDocument(t *testing.T) {
+	doc, publicKey := newTestDocument(t, aliceDID, "alice.test")
+	directory, err := LoadLocalDirectory(writeTestFile(t, doc), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ident, err := directory.LookupDID(context.Background(), aliceDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ident.Handle != "alice.test" {
+		t.Errorf("handle = %s, want alice.test", ident.Handle)
+	}
+	assertSigningKey(t, ident, publicKey)
+}
+
+func TestLoadLocalDirectoryArray(t *testing.T) {
+	aliceDoc, alicePublicKey := newTestDocument(t, aliceDID, "Alice.Test")
+	bobDoc, bobPublicKey := newTestDocument(t, bobDID, "")
+	directory, err := LoadLocalDirectory(writeTestFile(t, []*identity.DIDDocument{aliceDoc, bobDoc}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Handles are normalized
+	for _, handle := range []string{"alice.test", "ALICE.test"} {
+		ident, err := directory.LookupHandle(ctx, syntax.Handle(handle))
+		if err != nil {
+			t.Fatalf("LookupHandle(%s): %v", handle, err)
+		}
+		if ident.DID != aliceDID {
+			t.Errorf("LookupHandle(%s) = %s, want %s", handle, ident.DID, aliceDID)
+		}
+		assertSigningKey(t, ident, alicePublicKey)
+	}
+
+	ident, err := directory.Lookup(ctx, syntax.AtIdentifier{Inner: bobDID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ident.Handle.IsInvalidHandle() {
+		t.Errorf("handle of a document without handle = %s, want handle.invalid", ident.Handle)
+	}
+	assertSigningKey(t, ident, bobPublicKey)
+}
+
+func TestLocalDirectoryUnknownIdentities(t *testing.T) {
+	aliceDoc, _ := newTestDocument(t, aliceDID, "alice.test")
+	bobDoc, bobPublicKey := newTestDocument(t, bobDID, "bob.example.com")
+	ctx := context.Background()
+
+	t.Run("without fallback", func(t *testing.T) {
+		directory := NewLocalDirectory(nil)
+		if err := directory.Insert(aliceDoc); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := directory.LookupDID(ctx, bobDID); !errors.Is(err, identity.ErrDIDNotFound) {
+			t.Errorf("LookupDID of an unknown DID error = %v, want ErrDIDNotFound", err)
+		}
+		if _, err := directory.LookupHandle(ctx, "bob.example.com"); !errors.Is(err, identity.ErrHandleNotFound) {
+			t.Errorf("LookupHandle of an unknown handle error = %v, want ErrHandleNotFound", err)
+		}
+		if err := directory.Purge(ctx, syntax.AtIdentifier{Inner: aliceDID}); err != nil {
+			t.Errorf("Purge: %v", err)
+		}
+	})
+
+	t.Run("with fallback", func(t *testing.T) {
+		fallback := identity.NewMockDirectory()
+		fallback.Insert(identity.ParseIdentity(bobDoc))
+		directory := NewLocalDirectory(&fallback)
+		if err := directory.Insert(aliceDoc); err != nil {
+			t.Fatal(err)
+		}
+
+		ident, err := directory.LookupDID(ctx, bobDID)
+		if err != nil {
+			t.Fatalf("LookupDID of a fallback DID: %v", err)
+		}
+		assertSigningKey(t, ident, bobPublicKey)
+		if _, err := directory.LookupDID(ctx, "did:plc:unknownunknownunknownunk"); !errors.Is(err, identity.ErrDIDNotFound) {
+			t.Errorf("LookupDID of a DID unknown to both error = %v, want ErrDIDNotFound", err)
+		}
+		if _, err := directory.LookupDID(ctx, aliceDID); err != nil {
+			t.Errorf("LookupDID of a local DID: %v", err)
+		}
+	})
+}
+
+func TestLocalDirectoryInsertReplacesDocument(t *testing.T) {
+	directory := NewLocalDirectory(nil)
+	oldDoc, _ := newTestDocument(t, aliceDID, "alice.test")
+	newDoc, newPublicKey := newTestDocument(t, aliceDID, "alice.example.com")
+	for _, doc := range []*identity.DIDDocument{oldDoc, newDoc} {
+		if err := directory.Insert(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+
+	if _, err := directory.LookupHandle(ctx, "alice.test"); !errors.Is(err, identity.ErrHandleNotFound) {
+		t.Errorf("LookupHandle of the replaced handle error = %v, want ErrHandleNotFound", err)
+	}
+	ident, err := directory.LookupHandle(ctx, "alice.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSigningKey(t, ident, newPublicKey)
+}
+
+func TestLoadLocalDirectoryErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{name: "invalid JSON", file: `{"id": "did:plc:alicealicealicealicealic",`},
+		{name: "invalid array", file: `[{"id": "did:plc:alicealicealicealicealic"}, 1]`},
+		{name: "invalid DID", file: `{"id": "alice"}`},
+		{name: "document without DID", file: `{"alsoKnownAs": ["at://alice.test"]}`},
+		{name: "empty file", file: ``},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := LoadLocalDirectory(writeTestFile(t, test.file), nil); err == nil {
+				t.Error("LoadLocalDirectory returned no error")
+			}
+		})
+	}
+
+	if _, err := LoadLocalDirectory(filepath.Join(t.TempDir(), "missing.json"), nil); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadLocalDirectory of a missing file error = %v, want ErrNotExist", err)
+	}
+}
+
+func TestNewDirectoryOffline(t *testing.T) {
+	doc, publicKey := newTestDocument(t, aliceDID, "alice.test")
+	directory, err := NewDirectory(&config.DIDResolverConfig{DirectoryFile: writeTestFile(t, doc), Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	ident, err := directory.LookupDID(ctx, aliceDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSigningKey(t, ident, publicKey)
+
+	// Offline directories don't resolve other DIDs from the network
+	if _, err := directory.LookupDID(ctx, bobDID); !errors.Is(err, identity.ErrDIDNotFound) {
+		t.Errorf("LookupDID of an unknown DID error = %v, want ErrDIDNotFound", err)
+	}
+}
@@ -0,0 +1,66 @@
+package feed
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+)
+
+// keysetCursorSeparator separates the creation time and the ID of the last post of a page in a keyset cursor.
+// Post IDs contain single colons of the DID but no double colons.
+const keysetCursorSeparator = "::"
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// pageCursor is the position of a page in a feed.
+//
+// Latest ranked feeds use keyset cursors with the position of the last post of the previous page,
+// "<created_at in Unix milliseconds>::<post ID>", so posts added to the feed after a page was served
+// don't repeat posts on the next page. Other rankings use numeric offset cursors. The numeric cursors
+// that latest ranked feeds issued before keyset cursors are still accepted as offsets, and the
+// following pages get keyset cursors. Clients only keep a cursor while a user scrolls, so they are
+// accepted until the 0.3.0 release of the API. Latest ranked feeds keep accepting the 0 offset, which
+// follows a first page filled by pinned posts.
+type pageCursor struct {
+	after  *collections.FeedKey // Nil for offset cursors
+	offset int64
+}
+
+func parseCursor(cursor string) (*pageCursor, error) {
+	if cursor == "" {
+		return &pageCursor{}, nil
+	}
+
+	if createdAtValue, id, ok := strings.Cut(cursor, keysetCursorSeparator); ok {
+		createdAtMillis, err := strconv.ParseInt(createdAtValue, 10, 64)
+		if err != nil || id == "" {
+			return nil, errInvalidCursor
+		}
+		return &pageCursor{after: &collections.FeedKey{CreatedAt: time.UnixMilli(createdAtMillis), ID: id}}, nil
+	}
+
+	offset, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || offset < 0 {
+		return nil, errInvalidCursor
+	}
+	return &pageCursor{offset: offset}, nil
+}
+
+// advance moves the cursor after the post.
+func (c *pageCursor) advance(post *pagePost) {
+	if post.key != nil {
+		c.after, c.offset = post.key, 0
+	} else {
+		c.offset++
+	}
+}
+
+func (c *pageCursor) String() string {
+	if c.after != nil {
+		return strconv.FormatInt(c.after.CreatedAt.UnixMilli(), 10) + keysetCursorSeparator + c.after.ID
+	}
+	return strconv.FormatInt(c.offset, 10)
+}
@@ -0,0 +1,86 @@
+package feed
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+)
+
+func TestParseCursor(t *testing.T) {
+	createdAt := time.UnixMilli(1760000000123)
+
+	tests := []struct {
+		name   string
+		cursor string
+		want   *pageCursor // nil for invalid cursors
+	}{
+		{name: "first page", cursor: "", want: &pageCursor{}},
+		{
+			name:   "keyset",
+			cursor: "1760000000123::did:plc:author/3k2a",
+			want:   &pageCursor{after: &collections.FeedKey{CreatedAt: createdAt, ID: "did:plc:author/3k2a"}},
+		},
+		{
+			// The creation time ends at the first separator, the rest is the ID
+			name:   "keyset with separator in the ID",
+			cursor: "1760000000123::did:plc:author::3k2a",
+			want:   &pageCursor{after: &collections.FeedKey{CreatedAt: createdAt, ID: "did:plc:author::3k2a"}},
+		},
+		{name: "legacy offset", cursor: "30", want: &pageCursor{offset: 30}},
+		{name: "zero offset", cursor: "0", want: &pageCursor{}},
+		{name: "garbage", cursor: "next-page"},
+		{name: "negative offset", cursor: "-30"},
+		{name: "overflowing offset", cursor: "9223372036854775808"},
+		{name: "fractional offset", cursor: "1.5"},
+		{name: "offset with spaces", cursor: " 30"},
+		{name: "keyset without creation time", cursor: "::did:plc:author/3k2a"},
+		{name: "keyset with invalid creation time", cursor: "yesterday::did:plc:author/3k2a"},
+		{name: "keyset with overflowing creation time", cursor: "9223372036854775808::did:plc:author/3k2a"},
+		{name: "keyset without ID", cursor: "1760000000123::"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseCursor(test.cursor)
+			if test.want == nil {
+				if !errors.Is(err, errInvalidCursor) {
+					t.Fatalf("parseCursor(%q) = %+v, %v, want errInvalidCursor", test.cursor, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCursor(%q): %v", test.cursor, err)
+			}
+
+			if got.offset != test.want.offset || (got.after == nil) != (test.want.after == nil) {
+				t.Fatalf("parseCursor(%q) = %+v, want %+v", test.cursor, got, test.want)
+			}
+			if got.after != nil && (!got.after.CreatedAt.Equal(test.want.after.CreatedAt) || got.after.ID != test.want.after.ID) {
+				t.Errorf("parseCursor(%q) position = %+v, want %+v", test.cursor, *got.after, *test.want.after)
+			}
+			if test.cursor != "" && got.String() != test.cursor {
+				t.Errorf("parseCursor(%q).String() = %q", test.cursor, got.String())
+			}
+		})
+	}
+}
+
+func TestPageCursorAdvance(t *testing.T) {
+	key := &collections.FeedKey{CreatedAt: time.UnixMilli(1760000000123), ID: "did:plc:author/3k2a"}
+
+	// A legacy offset switches to a keyset cursor after the first post with a position
+	cursor := &pageCursor{offset: 30}
+	cursor.advance(&pagePost{did: "did:plc:author", recordKey: "3k2a", key: key})
+	if got, want := cursor.String(), "1760000000123::did:plc:author/3k2a"; got != want {
+		t.Errorf("cursor after a latest ranked post = %q, want %q", got, want)
+	}
+
+	// Ranked posts have no position and advance the offset
+	cursor = &pageCursor{offset: 30}
+	cursor.advance(&pagePost{did: "did:plc:author", recordKey: "3k2a"})
+	if got, want := cursor.String(), "31"; got != want {
+		t.Errorf("cursor after a ranked post = %q, want %q", got, want)
+	}
+}
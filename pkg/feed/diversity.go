@@ -0,0 +1,34 @@
+package feed
+
+import "slices"
+
+// limitConsecutive reorders the posts so at most maxConsecutive posts of the same author follow each other.
+// An excess post is moved after the next post of another author. Posts are only reordered within the page,
+// so every post is still served once across the pages of the feed and the cursors stay valid. When the page
+// has no more posts of other authors, the remaining posts are kept at its end.
+func limitConsecutive(posts []*pagePost, maxConsecutive int) []*pagePost {
+	remaining := slices.Clone(posts)
+	ordered := make([]*pagePost, 0, len(posts))
+
+	lastDID, consecutive := "", 0
+	for len(remaining) > 0 {
+		next := 0
+		for i, post := range remaining {
+			if post.did != lastDID || consecutive < maxConsecutive {
+				next = i
+				break
+			}
+		}
+
+		post := remaining[next]
+		remaining = slices.Delete(remaining, next, next+1)
+		if post.did == lastDID {
+			consecutive++
+		} else {
+			lastDID, consecutive = post.did, 1
+		}
+		ordered = append(ordered, post)
+	}
+
+	return ordered
+}
@@ -0,0 +1,257 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/aykhans/bsky-feedgen/pkg/logger"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+	"github.com/aykhans/bsky-feedgen/pkg/utils"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/whyrusleeping/go-did"
+)
+
+// latestFeedReader reads the pages of a latest ranked feed, implemented by collections.FeedCollection.
+type latestFeedReader interface {
+	GetByCreatedAt(ctx context.Context, skip int64, limit int64) ([]*collections.FeedItem, error)
+	GetBeforeKey(ctx context.Context, before *collections.FeedKey, limit int64) ([]*collections.FeedItem, error)
+}
+
+// rankedFeedReader reads the pages of materialized rankings, implemented by collections.FeedRankedCollection.
+type rankedFeedReader interface {
+	GetByRank(ctx context.Context, feed string, skip int64, limit int64) ([]*collections.FeedRanked, error)
+}
+
+// moderationReader reads the pinned posts, implemented by collections.FeedModerationCollection.
+type moderationReader interface {
+	GetByFeed(
+		ctx context.Context,
+		feed string,
+		action collections.FeedModerationAction,
+	) ([]*collections.FeedModeration, error)
+}
+
+// GeneratedFeed is a feed whose posts are selected by a generator of the feedgen service.
+type GeneratedFeed struct {
+	name                     string
+	did                      *did.DID
+	ranking                  types.FeedRanking
+	feedCollection           latestFeedReader
+	feedRankedCollection     rankedFeedReader
+	feedModerationCollection moderationReader
+	authorMaxConsecutive     int
+	viewerFilter             *ViewerFilter
+}
+
+// pagePost is a post of a feed page.
+type pagePost struct {
+	did       string
+	recordKey string
+	key       *collections.FeedKey // Position of the post in latest ranked feeds, nil in other rankings
+}
+
+func (p *pagePost) uri() string {
+	return "at://" + p.did + "/app.bsky.feed.post/" + p.recordKey
+}
+
+// NewGeneratedFeed creates the feed. Latest ranked feeds are served from the generator's feed collection
+// in reverse chronological order, any other ranking from its materialized ranking in feedRankedCollection.
+// Posts pinned by an admin in feedModerationCollection are shown at the top of the first page, in place of
+// the last posts of the page.
+// The posts of a page are reordered so at most authorMaxConsecutive posts of an author follow each other,
+// 0 keeps the order. The posts hidden from the requesting viewer are removed by viewerFilter, nil shows
+// all posts to every viewer.
+func NewGeneratedFeed(
+	name string,
+	publisherDID *did.DID,
+	ranking types.FeedRanking,
+	feedCollection *collections.FeedCollection,
+	feedRankedCollection *collections.FeedRankedCollection,
+	feedModerationCollection *collections.FeedModerationCollection,
+	authorMaxConsecutive int,
+	viewerFilter *ViewerFilter,
+) *GeneratedFeed {
+	return &GeneratedFeed{
+		name:                     name,
+		did:                      publisherDID,
+		ranking:                  ranking,
+		feedCollection:           feedCollection,
+		feedRankedCollection:     feedRankedCollection,
+		feedModerationCollection: feedModerationCollection,
+		authorMaxConsecutive:     authorMaxConsecutive,
+		viewerFilter:             viewerFilter,
+	}
+}
+
+func (f GeneratedFeed) GetName(_ context.Context) string {
+	return f.name
+}
+
+func (f *GeneratedFeed) Describe(_ context.Context) bsky.FeedDescribeFeedGenerator_Feed {
+	return bsky.FeedDescribeFeedGenerator_Feed{
+		Uri: "at://" + f.did.String() + "/app.bsky.feed.generator/" + f.name,
+	}
+}
+
+func (f *GeneratedFeed) GetPage(
+	ctx context.Context,
+	userDID string,
+	limit int64,
+	cursor string,
+) ([]*bsky.FeedDefs_SkeletonFeedPost, *string, error) {
+	pageCursor, err := parseCursor(cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pageCursor.after != nil && !f.ranking.IsLatest() {
+		return nil, nil, fmt.Errorf("%w: %s ranked feeds only accept numeric cursors", errInvalidCursor, f.ranking)
+	}
+
+	// Pinned posts count toward the limit of the first page
+	var pinnedPosts []*pagePost
+	if cursor == "" {
+		pinnedPosts, err = f.getPinnedPosts(ctx, userDID, limit)
+		if err != nil {
+			logger.Log.Error("failed to get pinned feed items", "feed", f.name, "error", err)
+			return nil, nil, types.ErrInternal
+		}
+	}
+
+	pagePosts, newCursor, err := f.getVisiblePagePosts(ctx, userDID, pageCursor, limit-int64(len(pinnedPosts)))
+	if err != nil {
+		logger.Log.Error("failed to get feed items", "feed", f.name, "ranking", f.ranking, "error", err)
+		return nil, nil, types.ErrInternal
+	}
+	if f.authorMaxConsecutive > 0 {
+		pagePosts = limitConsecutive(pagePosts, f.authorMaxConsecutive)
+	}
+
+	posts := make([]*bsky.FeedDefs_SkeletonFeedPost, 0, len(pinnedPosts)+len(pagePosts))
+	pinnedPostURIs := make([]string, len(pinnedPosts))
+	for i, pinnedPost := range pinnedPosts {
+		pinnedPostURIs[i] = pinnedPost.uri()
+		posts = append(posts, &bsky.FeedDefs_SkeletonFeedPost{Post: pinnedPostURIs[i]})
+	}
+	for _, pagePost := range pagePosts {
+		// Pinned posts are only shown at the top of the first page
+		if postURI := pagePost.uri(); !slices.Contains(pinnedPostURIs, postURI) {
+			posts = append(posts, &bsky.FeedDefs_SkeletonFeedPost{Post: postURI})
+		}
+	}
+
+	return posts, newCursor, nil
+}
+
+// getVisiblePagePosts returns up to limit posts after the cursor that the viewer can see, in their feed order,
+// and the cursor of the next page, nil at the end of the feed. At most maxPageReads batches are read, so a page
+// can have less than limit posts when most posts are hidden from the viewer. The next cursor is the position of
+// the last read post, not of the last returned one, so hidden posts don't shift the next pages.
+func (f *GeneratedFeed) getVisiblePagePosts(
+	ctx context.Context,
+	viewerDID string,
+	cursor *pageCursor,
+	limit int64,
+) ([]*pagePost, *string, error) {
+	position := *cursor
+	visiblePosts := make([]*pagePost, 0, limit)
+	for range maxPageReads {
+		// One more post than needed tells whether the feed continues after the page
+		batch, err := f.getPagePosts(ctx, &position, limit+1)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		hiddenDIDs, err := f.viewerFilter.hiddenDIDs(ctx, viewerDID, batch)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, post := range batch {
+			if int64(len(visiblePosts)) == limit {
+				return visiblePosts, utils.ToPtr(position.String()), nil
+			}
+			position.advance(post)
+			if !hiddenDIDs[post.did] {
+				visiblePosts = append(visiblePosts, post)
+			}
+		}
+		if int64(len(batch)) <= limit {
+			return visiblePosts, nil, nil
+		}
+		if int64(len(visiblePosts)) == limit {
+			break
+		}
+	}
+
+	return visiblePosts, utils.ToPtr(position.String()), nil
+}
+
+// getPinnedPosts returns the posts pinned to the feed that the viewer can see, newest pin first.
+func (f *GeneratedFeed) getPinnedPosts(ctx context.Context, viewerDID string, limit int64) ([]*pagePost, error) {
+	pinnedItems, err := f.feedModerationCollection.GetByFeed(ctx, f.name, collections.FeedModerationActionPinned)
+	if err != nil {
+		return nil, err
+	}
+
+	pinnedPosts := visiblePinnedPosts(pinnedItems, limit)
+	hiddenDIDs, err := f.viewerFilter.hiddenDIDs(ctx, viewerDID, pinnedPosts)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(pinnedPosts, func(post *pagePost) bool { return hiddenDIDs[post.did] }), nil
+}
+
+// visiblePinnedPosts returns up to limit posts of the pins, skipping the pins of inactive authors.
+// The pins of deleted posts and accounts are removed by the consumer.
+func visiblePinnedPosts(pinnedItems []*collections.FeedModeration, limit int64) []*pagePost {
+	pinnedPosts := make([]*pagePost, 0, min(int64(len(pinnedItems)), limit))
+	for _, pinnedItem := range pinnedItems {
+		if int64(len(pinnedPosts)) == limit {
+			break
+		}
+		if !pinnedItem.Hidden {
+			pinnedPosts = append(pinnedPosts, &pagePost{did: pinnedItem.DID, recordKey: pinnedItem.RecordKey})
+		}
+	}
+	return pinnedPosts
+}
+
+// getPagePosts returns the posts of the page at the cursor in their feed order.
+func (f *GeneratedFeed) getPagePosts(ctx context.Context, cursor *pageCursor, limit int64) ([]*pagePost, error) {
+	if f.ranking.IsLatest() {
+		var feedItems []*collections.FeedItem
+		var err error
+		if cursor.offset > 0 {
+			feedItems, err = f.feedCollection.GetByCreatedAt(ctx, cursor.offset, limit)
+		} else {
+			feedItems, err = f.feedCollection.GetBeforeKey(ctx, cursor.after, limit)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		pagePosts := make([]*pagePost, len(feedItems))
+		for i, feedItem := range feedItems {
+			pagePosts[i] = &pagePost{
+				did:       feedItem.DID,
+				recordKey: feedItem.RecordKey,
+				key:       &collections.FeedKey{CreatedAt: feedItem.CreatedAt, ID: feedItem.ID},
+			}
+		}
+		return pagePosts, nil
+	}
+
+	feedRankedItems, err := f.feedRankedCollection.GetByRank(ctx, f.name, cursor.offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	pagePosts := make([]*pagePost, len(feedRankedItems))
+	for i, feedItem := range feedRankedItems {
+		pagePosts[i] = &pagePost{did: feedItem.DID, recordKey: feedItem.RecordKey}
+	}
+	return pagePosts, nil
+}
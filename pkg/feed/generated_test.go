@@ -0,0 +1,249 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+)
+
+func TestVisiblePinnedPosts(t *testing.T) {
+	pin := func(recordKey string, hidden bool) *collections.FeedModeration {
+		return &collections.FeedModeration{
+			DID:       "did:plc:author",
+			RecordKey: recordKey,
+			Action:    collections.FeedModerationActionPinned,
+			Hidden:    hidden,
+		}
+	}
+
+	tests := []struct {
+		name  string
+		pins  []*collections.FeedModeration
+		limit int64
+		want  []string
+	}{
+		{name: "no pins", limit: 10, want: []string{}},
+		{name: "all visible", pins: []*collections.FeedModeration{pin("a", false), pin("b", false)}, limit: 10, want: []string{"a", "b"}},
+		{name: "inactive author", pins: []*collections.FeedModeration{pin("a", true), pin("b", false)}, limit: 10, want: []string{"b"}},
+		{name: "limit", pins: []*collections.FeedModeration{pin("a", false), pin("b", false), pin("c", false)}, limit: 2, want: []string{"a", "b"}},
+		// Hidden pins don't take the place of visible ones
+		{name: "limit after hidden", pins: []*collections.FeedModeration{pin("a", true), pin("b", false), pin("c", false)}, limit: 2, want: []string{"b", "c"}},
+		{name: "zero limit", pins: []*collections.FeedModeration{pin("a", false)}, limit: 0, want: []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			posts := visiblePinnedPosts(test.pins, test.limit)
+			got := make([]string, len(posts))
+			for i, post := range posts {
+				got[i] = post.recordKey
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("visiblePinnedPosts = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// fakeLatestFeed is a latest ranked feed collection in memory.
+type fakeLatestFeed struct {
+	items []*collections.FeedItem
+}
+
+func (f *fakeLatestFeed) insert(items ...*collections.FeedItem) {
+	f.items = append(f.items, items...)
+	// Reverse chronological order, then by descending ID like the collection
+	slices.SortFunc(f.items, func(a, b *collections.FeedItem) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(b.ID, a.ID)
+	})
+}
+
+func (f *fakeLatestFeed) GetByCreatedAt(_ context.Context, skip int64, limit int64) ([]*collections.FeedItem, error) {
+	items := f.items[min(skip, int64(len(f.items))):]
+	return items[:min(limit, int64(len(items)))], nil
+}
+
+func (f *fakeLatestFeed) GetBeforeKey(_ context.Context, before *collections.FeedKey, limit int64) ([]*collections.FeedItem, error) {
+	start := 0
+	if before != nil {
+		start = slices.IndexFunc(f.items, func(item *collections.FeedItem) bool {
+			return item.CreatedAt.Before(before.CreatedAt) || (item.CreatedAt.Equal(before.CreatedAt) && item.ID < before.ID)
+		})
+		if start < 0 {
+			return nil, nil
+		}
+	}
+	items := f.items[start:]
+	return items[:min(limit, int64(len(items)))], nil
+}
+
+// fakePins are the pinned posts of a feed, newest pin first.
+type fakePins []*collections.FeedModeration
+
+func (f fakePins) GetByFeed(context.Context, string, collections.FeedModerationAction) ([]*collections.FeedModeration, error) {
+	return f, nil
+}
+
+func newTestFeedItem(recordKey string, createdAt time.Time) *collections.FeedItem {
+	return &collections.FeedItem{
+		ID:        "did:plc:author/" + recordKey,
+		DID:       "did:plc:author",
+		RecordKey: recordKey,
+		CreatedAt: createdAt,
+	}
+}
+
+func newTestLatestFeed(feedCollection latestFeedReader, pins fakePins) *GeneratedFeed {
+	return &GeneratedFeed{
+		name:                     "test",
+		ranking:                  types.FeedRankingLatest,
+		feedCollection:           feedCollection,
+		feedModerationCollection: pins,
+	}
+}
+
+// readPage returns the record keys of the posts of a page and its next cursor.
+func readPage(t *testing.T, feed *GeneratedFeed, limit int64, cursor string) ([]string, string) {
+	t.Helper()
+
+	posts, nextCursor, err := feed.GetPage(context.Background(), "", limit, cursor)
+	if err != nil {
+		t.Fatalf("GetPage(%q): %v", cursor, err)
+	}
+	recordKeys := make([]string, len(posts))
+	for i, post := range posts {
+		recordKeys[i] = post.Post[strings.LastIndex(post.Post, "/")+1:]
+	}
+	if nextCursor == nil {
+		return recordKeys, ""
+	}
+	return recordKeys, *nextCursor
+}
+
+func TestGetPageDoesNotRepeatPostsAfterInserts(t *testing.T) {
+	start := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	feedCollection := &fakeLatestFeed{}
+	for i := range 10 {
+		feedCollection.insert(newTestFeedItem(fmt.Sprintf("old%d", i), start.Add(time.Duration(i)*time.Minute)))
+	}
+	// Posts created at the same millisecond are ordered by ID, and the first page ends between them
+	feedCollection.insert(newTestFeedItem("same-a", start.Add(6*time.Minute)), newTestFeedItem("same-b", start.Add(6*time.Minute)))
+	feed := newTestLatestFeed(feedCollection, nil)
+
+	var seen []string
+	cursor := ""
+	for page := 0; ; page++ {
+		recordKeys, nextCursor := readPage(t, feed, 4, cursor)
+		for _, recordKey := range recordKeys {
+			if slices.Contains(seen, recordKey) {
+				t.Errorf("page %d repeats %s", page, recordKey)
+			}
+		}
+		seen = append(seen, recordKeys...)
+		if nextCursor == "" {
+			break
+		}
+		if _, err := parseCursor(nextCursor); err != nil || !strings.Contains(nextCursor, keysetCursorSeparator) {
+			t.Fatalf("page %d cursor %q, want a keyset cursor", page, nextCursor)
+		}
+		cursor = nextCursor
+
+		// New posts are added to the top of the feed while the user scrolls
+		feedCollection.insert(newTestFeedItem(fmt.Sprintf("new%d", page), time.Now().Add(time.Duration(page)*time.Millisecond)))
+	}
+
+	want := []string{"old9", "old8", "old7", "same-b", "same-a", "old6", "old5", "old4", "old3", "old2", "old1", "old0"}
+	if !slices.Equal(seen, want) {
+		t.Errorf("pages = %v, want %v", seen, want)
+	}
+}
+
+func TestGetPageLegacyOffsetCursor(t *testing.T) {
+	start := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	feedCollection := &fakeLatestFeed{}
+	for i := range 6 {
+		feedCollection.insert(newTestFeedItem(fmt.Sprintf("post%d", i), start.Add(time.Duration(i)*time.Minute)))
+	}
+	feed := newTestLatestFeed(feedCollection, nil)
+
+	recordKeys, nextCursor := readPage(t, feed, 2, "2")
+	if want := []string{"post3", "post2"}; !slices.Equal(recordKeys, want) {
+		t.Errorf("page = %v, want %v", recordKeys, want)
+	}
+	// The next page continues with a keyset cursor
+	if want := strconv.FormatInt(start.Add(2*time.Minute).UnixMilli(), 10) + "::did:plc:author/post2"; nextCursor != want {
+		t.Errorf("next cursor = %q, want %q", nextCursor, want)
+	}
+	recordKeys, nextCursor = readPage(t, feed, 2, nextCursor)
+	if want := []string{"post1", "post0"}; !slices.Equal(recordKeys, want) || nextCursor != "" {
+		t.Errorf("page = %v, cursor %q, want %v at the end of the feed", recordKeys, nextCursor, want)
+	}
+}
+
+func TestGetPageRejectsKeysetCursorOfRankedFeed(t *testing.T) {
+	feed := &GeneratedFeed{name: "test", ranking: types.FeedRankingHot}
+	if _, _, err := feed.GetPage(context.Background(), "", 10, "1760000000123::did:plc:author/3k2a"); !errors.Is(err, errInvalidCursor) {
+		t.Errorf("GetPage error = %v, want errInvalidCursor", err)
+	}
+}
+
+func TestGetPageCountsPinnedPosts(t *testing.T) {
+	start := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	feedCollection := &fakeLatestFeed{}
+	for i := range 5 {
+		feedCollection.insert(newTestFeedItem(fmt.Sprintf("post%d", i), start.Add(time.Duration(i)*time.Minute)))
+	}
+	pin := func(recordKey string) *collections.FeedModeration {
+		return &collections.FeedModeration{DID: "did:plc:author", RecordKey: recordKey, Action: collections.FeedModerationActionPinned}
+	}
+
+	tests := []struct {
+		name      string
+		pins      fakePins
+		wantPages [][]string
+	}{
+		{
+			name:      "without pins",
+			wantPages: [][]string{{"post4", "post3", "post2"}, {"post1", "post0"}},
+		},
+		{
+			name:      "pinned post of the feed",
+			pins:      fakePins{pin("post1")},
+			wantPages: [][]string{{"post1", "post4", "post3"}, {"post2", "post1", "post0"}},
+		},
+		{
+			name:      "pins fill the first page",
+			pins:      fakePins{pin("pinned-a"), pin("pinned-b"), pin("pinned-c"), pin("pinned-d")},
+			wantPages: [][]string{{"pinned-a", "pinned-b", "pinned-c"}, {"post4", "post3", "post2"}, {"post1", "post0"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			feed := newTestLatestFeed(feedCollection, test.pins)
+
+			cursor := ""
+			for i, wantPage := range test.wantPages {
+				recordKeys, nextCursor := readPage(t, feed, 3, cursor)
+				if !slices.Equal(recordKeys, wantPage) {
+					t.Errorf("page %d = %v, want %v", i, recordKeys, wantPage)
+				}
+				if (nextCursor == "") != (i == len(test.wantPages)-1) {
+					t.Fatalf("page %d next cursor = %q", i, nextCursor)
+				}
+				cursor = nextCursor
+			}
+		})
+	}
+}
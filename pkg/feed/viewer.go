@@ -0,0 +1,59 @@
+package feed
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+)
+
+// maxPageReads is the maximum number of batches read for a page when posts are hidden from the viewer.
+const maxPageReads = 3
+
+// ViewerFilter hides posts from the viewer requesting a feed page: the viewer's own posts, posts of
+// accounts the viewer blocks or that block the viewer, and posts of accounts on the viewer's mute lists.
+// Blocks are the app.bsky.graph.block records stored by the consumer. Mute lists are private in Bluesky,
+// so they are submitted by the viewers with the viewer API.
+type ViewerFilter struct {
+	blockCollection      *collections.BlockCollection
+	viewerMuteCollection *collections.ViewerMuteCollection
+}
+
+func NewViewerFilter(
+	blockCollection *collections.BlockCollection,
+	viewerMuteCollection *collections.ViewerMuteCollection,
+) *ViewerFilter {
+	return &ViewerFilter{
+		blockCollection:      blockCollection,
+		viewerMuteCollection: viewerMuteCollection,
+	}
+}
+
+// hiddenDIDs returns the authors of the posts that are hidden from the viewer.
+// Nothing is hidden from unauthenticated requests or when the filter is nil.
+func (v *ViewerFilter) hiddenDIDs(ctx context.Context, viewerDID string, posts []*pagePost) (map[string]bool, error) {
+	if v == nil || viewerDID == "" || len(posts) == 0 {
+		return nil, nil
+	}
+
+	var dids []string
+	for _, post := range posts {
+		if post.did != viewerDID && !slices.Contains(dids, post.did) {
+			dids = append(dids, post.did)
+		}
+	}
+
+	hiddenDIDs, err := v.blockCollection.GetBlockedOrBlocking(ctx, viewerDID, dids...)
+	if err != nil {
+		return nil, err
+	}
+	mutedDIDs, err := v.viewerMuteCollection.GetMuted(ctx, viewerDID, dids...)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(hiddenDIDs, mutedDIDs)
+	hiddenDIDs[viewerDID] = true
+
+	return hiddenDIDs, nil
+}
@@ -0,0 +1,7 @@
+// Package all registers every generator of the project.
+// Import it for its side effects where generators are looked up by name.
+package all
+
+import (
+	_ "github.com/aykhans/bsky-feedgen/pkg/generator/az"
+)
@@ -0,0 +1,97 @@
+package generator
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+)
+
+// Authors provides the author lists of a feed stored in the feed_author collection.
+// The lists are cached in memory and refreshed with Reload, so they can be edited at runtime.
+type Authors struct {
+	feedName   string
+	collection *collections.FeedAuthorCollection
+	users      atomic.Pointer[Users]
+}
+
+func NewAuthors(feedName string, collection *collections.FeedAuthorCollection) *Authors {
+	authors := &Authors{feedName: feedName, collection: collection}
+	authors.users.Store(&Users{})
+
+	return authors
+}
+
+// Users returns the author lists loaded by the last Reload.
+func (a *Authors) Users() Users {
+	return *a.users.Load()
+}
+
+// Load reads the current author lists of the feed from the store, without changing the cached lists.
+func (a *Authors) Load(ctx context.Context) (Users, error) {
+	feedAuthors, err := a.collection.GetByFeed(ctx, a.feedName)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(Users, len(feedAuthors))
+	for _, feedAuthor := range feedAuthors {
+		users[feedAuthor.DID] = feedAuthor.Allowed
+	}
+
+	return users, nil
+}
+
+// Reload refreshes the cached author lists and returns the authors that are newly denied since the last reload.
+func (a *Authors) Reload(ctx context.Context) ([]string, error) {
+	users, err := a.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	previousUsers := *a.users.Swap(&users)
+
+	var denied []string
+	for did, allowed := range users {
+		if !allowed && !previousUsers.isDenied(did) {
+			denied = append(denied, did)
+		}
+	}
+
+	return denied, nil
+}
+
+// Seed stores the given author lists if the feed has no stored authors yet, and returns the number of stored authors.
+func (a *Authors) Seed(ctx context.Context, users Users, addedBy string) (int64, error) {
+	if len(users) == 0 {
+		return 0, nil
+	}
+
+	count, err := a.collection.CountByFeed(ctx, a.feedName)
+	if err != nil || count > 0 {
+		return 0, err
+	}
+
+	now := time.Now()
+	feedAuthors := make([]*collections.FeedAuthor, 0, len(users))
+	for did, allowed := range users {
+		feedAuthors = append(feedAuthors, &collections.FeedAuthor{
+			ID:        collections.FeedAuthorID(a.feedName, did),
+			Feed:      a.feedName,
+			DID:       did,
+			Allowed:   allowed,
+			Reason:    "Seeded from the feed definition",
+			AddedBy:   addedBy,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+	}
+
+	return a.collection.InsertNew(ctx, feedAuthors...)
+}
+
+func (u Users) isDenied(did string) bool {
+	allowed, ok := u[did]
+	return ok && !allowed
+}
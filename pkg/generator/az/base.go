@@ -1,135 +1,78 @@
 package az
 
 import (
-	"context"
-	"fmt"
-	"regexp"
-	"slices"
+	_ "embed"
 
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"github.com/aykhans/bsky-feedgen/pkg/generator"
+	"github.com/aykhans/bsky-feedgen/pkg/rules"
 	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
-	"github.com/aykhans/bsky-feedgen/pkg/types"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type Generator struct {
-	postCollection   *collections.PostCollection
-	feedAzCollection *collections.FeedAzCollection
-	textRegex        *regexp.Regexp
+const (
+	Name     = "az"
+	FeedName = "AzPulse"
+)
+
+// defaultRules is the AzPulse feed definition used when no definition file is configured.
+//
+//go:embed rules.json
+var defaultRules []byte
+
+func init() {
+	generator.Register(
+		Name,
+		func(feedConfig *config.FeedConfig, feedAuthorCollection *collections.FeedAuthorCollection) (generator.Generator, error) {
+			feedRules, err := LoadRules(feedConfig.RulesPath)
+			if err != nil {
+				return nil, err
+			}
+
+			return NewGenerator(feedRules, generator.NewAuthors(FeedName, feedAuthorCollection)), nil
+		},
+	)
 }
 
-func NewGenerator(
-	postCollection *collections.PostCollection,
-	feedAzCollection *collections.FeedAzCollection,
-) *Generator {
-	return &Generator{
-		postCollection:   postCollection,
-		feedAzCollection: feedAzCollection,
-		textRegex:        regexp.MustCompile("(?i)(azerbaijan|azərbaycan|aзербайджан|azerbaycan)"),
+// LoadRules loads the feed definition at path, or the built-in AzPulse definition if path is empty.
+func LoadRules(path string) (*rules.Feed, error) {
+	if path == "" {
+		return rules.Parse(defaultRules)
 	}
+
+	return rules.Load(path)
 }
 
-func (generator *Generator) Start(ctx context.Context, cursorOption types.GeneratorCursor, batchSize int) error {
-	var mongoCursor *mongo.Cursor
-	switch cursorOption {
-	case types.GeneratorCursorLastGenerated:
-		sequenceCursor, err := generator.feedAzCollection.GetMaxSequence(ctx)
-		if err != nil {
-			return err
-		}
-
-		if sequenceCursor == nil {
-			mongoCursor, err = generator.postCollection.Collection.Find(
-				ctx,
-				bson.D{},
-				options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}}),
-			)
-		} else {
-			mongoCursor, err = generator.postCollection.Collection.Find(
-				ctx,
-				bson.M{"sequence": bson.M{"$gt": *sequenceCursor}},
-			)
-		}
-		if err != nil {
-			return err
-		}
-	case types.GeneratorCursorFirstPost:
-		var err error
-		mongoCursor, err = generator.postCollection.Collection.Find(
-			ctx,
-			bson.D{},
-			options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}}),
-		)
-		if err != nil {
-			return err
-		}
-	}
+type Generator struct {
+	rules   *rules.Feed
+	authors *generator.Authors
+}
 
-	defer func() { _ = mongoCursor.Close(ctx) }()
-
-	feedAzBatch := []*collections.FeedAz{}
-	for mongoCursor.Next(ctx) {
-		var doc *collections.Post
-		if err := mongoCursor.Decode(&doc); err != nil {
-			return fmt.Errorf("mongodb cursor decode error: %v", err)
-		}
-
-		if generator.IsValid(doc) == false {
-			continue
-		}
-
-		feedAzBatch = append(
-			feedAzBatch,
-			&collections.FeedAz{
-				ID:        doc.ID,
-				Sequence:  doc.Sequence,
-				DID:       doc.DID,
-				RecordKey: doc.RecordKey,
-				CreatedAt: doc.CreatedAt,
-			},
-		)
-
-		if len(feedAzBatch)%batchSize == 0 {
-			err := generator.feedAzCollection.Insert(ctx, true, feedAzBatch...)
-			if err != nil {
-				return fmt.Errorf("insert FeedAz error: %v", err)
-			}
-			feedAzBatch = []*collections.FeedAz{}
-		}
-	}
+func NewGenerator(feedRules *rules.Feed, authors *generator.Authors) *Generator {
+	return &Generator{rules: feedRules, authors: authors}
+}
 
-	if len(feedAzBatch) > 0 {
-		err := generator.feedAzCollection.Insert(ctx, true, feedAzBatch...)
-		if err != nil {
-			return fmt.Errorf("insert FeedAz error: %v", err)
-		}
-	}
+func (generator *Generator) Name() string {
+	return Name
+}
 
-	return nil
+func (generator *Generator) FeedName() string {
+	return FeedName
 }
 
-func (generator *Generator) IsValid(post *collections.Post) bool {
-	// Skip posts that are deep replies (not direct replies to original posts)
-	if post.Reply != nil && post.Reply.RootURI != post.Reply.ParentURI {
-		return false
-	}
+func (generator *Generator) Authors() *generator.Authors {
+	return generator.authors
+}
 
-	// Check if the user who created this post is in our pre-defined list
-	// This allows for explicit inclusion/exclusion of specific users
-	if isValidUser := Users.IsValid(post.DID); isValidUser != nil {
-		return *isValidUser
-	}
+// DefaultUsers returns the author lists of the feed definition.
+func (generator *Generator) DefaultUsers() generator.Users {
+	return generator.rules.Users
+}
 
-	// A post is considered valid if it meets either of the following criteria:
-	// 1. It's primarily in Azerbaijani (language code "az") with less than 3 detected languages
-	//    (to filter out multi-language spam)
-	// 2. It contains Azerbaijan-related keywords in the text AND has at least one valid language
-	//    from our approved language list
-	if (slices.Contains(post.Langs, "az") && len(post.Langs) < 3) ||
-		(generator.textRegex.MatchString(post.Text) && Langs.IsExistsAny(post.Langs)) {
-		return true
-	}
+// IsValid matches the post against the feed definition, using the stored author lists.
+func (generator *Generator) IsValid(post *collections.Post) bool {
+	return generator.rules.MatchUsers(post, generator.authors.Users())
+}
 
-	return false
+func (generator *Generator) Explain(post *collections.Post) *generator.Explanation {
+	return generator.rules.ExplainUsers(post, generator.authors.Users())
 }
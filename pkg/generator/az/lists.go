@@ -1,63 +0,0 @@
-package az
-
-import "github.com/aykhans/bsky-feedgen/pkg/generator"
-
-var Users = generator.Users{
-	// Invalid
-	"did:plc:5zww7zorx2ajw7hqrhuix3ba": false,
-	"did:plc:c4vhz47h566t2ntgd7gtawen": false,
-	"did:plc:lc7j7xdq67gn7vc6vzmydfqk": false,
-	"did:plc:msian4dqa2rqalf3biilnf3m": false,
-	"did:plc:gtosalycg7snvodjhsze35jm": false,
-	"did:plc:i53e6y3liw2oaw4s6e6odw5m": false,
-	"did:plc:pvdqvmpkeermkhy7fezam473": false,
-	"did:plc:5vwjnzaibnwscbbcvkzhy57v": false,
-	"did:plc:6mfp3coadoobuvlg6w2avw6x": false,
-	"did:plc:lm2uhaoqoe6yo76oeihndfyi": false,
-	"did:plc:vizwdor43adw3277u2kkrssd": false,
-	"did:plc:oqatvbgbhvqbjl2w2o63ehgi": false,
-	"did:plc:gy7yilnydusx5hy2z3dltynp": false,
-	"did:plc:xk7cs24wk6njv42azm2yd7dv": false,
-	"did:plc:ijmt7f4p3dcfqtg3j3zshimn": false,
-	"did:plc:2q5dx6whenn7pnsrfn3jpd6h": false,
-	"did:plc:s2waw3gkmn7h2nn6od44apng": false,
-	"did:plc:4hm6gb7dzobynqrpypif3dck": false,
-	"did:plc:odvarii7w7soygxet3xvzop7": false,
-	"did:plc:5cbkdchsxjvz5fog2oo7m4le": false,
-	"did:plc:ooeuisen5rtr4rojmz7gkbrh": false,
-	"did:plc:6bvhdvgeqkj7nol2zodtqmww": false,
-	"did:plc:k6sxlkd5ssq2uaylzisap2tw": false,
-	"did:plc:uxljnh22mmfzmr4i3oien6mx": false,
-	"did:plc:w5gg2zgwcyfevphehdcmavev": false,
-	"did:plc:ckawbibgmrwg3lbskfppwtlw": false,
-	"did:plc:43fdk46qa5gsokzygzildsaq": false,
-	"did:plc:3szm5t3tknphjtj73twqfonw": false,
-	"did:plc:4ukvsogndgp67sv6f6ohse3y": false,
-	"did:plc:cdplzvv63u5jxb4fxm4vpfgm": false,
-	"did:plc:namifrcorf6hzy45phd4shvt": false,
-	"did:plc:ltvtwjps77bqgm2knhlbswyk": false,
-	"did:plc:acglo4ret2f2wc5duqtispsa": false,
-	"did:plc:zibx3delbo24mdsccz6s7qa4": false,
-	"did:plc:dbpnhjiyq5e7pe3a4mt3jyhx": false,
-	"did:plc:ilvqavldtvn4ytagkvjafq6k": false,
-
-	// Valid
-	"did:plc:jbt4qi6psd7rutwzedtecsq7": true,
-	"did:plc:yzgdpxsklrmfgqmjghdvw3ti": true,
-	"did:plc:g7ebgiai577ln3avsi2pt3sn": true,
-	"did:plc:phtq2rhgbwipyx5ie3apw44j": true,
-	"did:plc:jfdvklrs5n5qv7f25v6swc5h": true,
-	"did:plc:u5ez5w6qslh6advti4wyddba": true,
-	"did:plc:x7alwnnjygt2aqcwblhazko7": true,
-	"did:plc:mgciyhgfn65z7iazxuar6o6a": true,
-	"did:plc:ay2f5go4lxq2hspiaqohegac": true,
-	"did:plc:ftoopigdpuzqt2kpeyqxsofx": true,
-	"did:plc:cs2cbzojm6hmx5lfxiuft3mq": true,
-}
-
-var Langs = generator.Langs{
-	"az": true,
-	"en": true,
-	"tr": true,
-	"ru": true,
-}
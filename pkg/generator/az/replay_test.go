@@ -0,0 +1,104 @@
+package az
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/consumer"
+	"github.com/aykhans/bsky-feedgen/pkg/consumer/consumertest"
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/repomgr"
+)
+
+// replayPosts are recorded as one commit each, in this order.
+var replayPosts = []struct {
+	rkey  string
+	langs []string
+	text  string
+	// Parent of a reply, the root is the first post
+	parent   string
+	selected bool
+}{
+	{rkey: "az", langs: []string{"az"}, text: "Salam, necəsiniz?", selected: true},
+	{rkey: "az-en", langs: []string{"az", "en"}, text: "Bakıda bu gün hava çox gözəldir", selected: true},
+	{rkey: "az-en-tr", langs: []string{"az", "en", "tr"}, text: "Salam", selected: false},
+	{rkey: "en-keyword", langs: []string{"en"}, text: "Travelling to Azerbaijan next week", selected: true},
+	{rkey: "tr-keyword", langs: []string{"tr"}, text: "Azerbaycan çok güzel", selected: true},
+	{rkey: "de-keyword", langs: []string{"de"}, text: "Urlaub in Azerbaijan", selected: false},
+	{rkey: "en", langs: []string{"en"}, text: "Hello world", selected: false},
+	{rkey: "direct-reply", langs: []string{"az"}, text: "Razıyam", parent: "az", selected: true},
+	{rkey: "deep-reply", langs: []string{"az"}, text: "Razıyam", parent: "direct-reply", selected: false},
+}
+
+func TestDefaultRulesSelectReplayedPosts(t *testing.T) {
+	const did = "did:plc:replayreplayreplayreplay"
+	postURI := func(rkey string) string {
+		return "at://" + did + "/app.bsky.feed.post/" + rkey
+	}
+	strongRef := func(rkey string) *comatproto.RepoStrongRef {
+		return &comatproto.RepoStrongRef{Uri: postURI(rkey), Cid: "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm"}
+	}
+
+	path := filepath.Join(t.TempDir(), "azpulse.rec.gz")
+	recorder, err := consumer.NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for i, post := range replayPosts {
+		record := &bsky.FeedPost{
+			Text:      post.text,
+			Langs:     post.langs,
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		}
+		if post.parent != "" {
+			record.Reply = &bsky.FeedPost_ReplyRef{Root: strongRef(replayPosts[0].rkey), Parent: strongRef(post.parent)}
+		}
+
+		commit, err := consumertest.NewCommit(int64(i+1), did, consumertest.Record{
+			Collection: "app.bsky.feed.post",
+			RecordKey:  post.rkey,
+			Value:      record,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := recorder.RecordCommit(commit); err != nil {
+			t.Fatal(err)
+		}
+		if post.selected {
+			want = append(want, did+"/"+post.rkey)
+		}
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	feedRules, err := LoadRules("")
+	if err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+
+	var got []string
+	err = consumer.NewReplaySource(path, false).Run(context.Background(), func(data consumer.CallbackData) {
+		if data.Collection != "app.bsky.feed.post" || data.Action != repomgr.EvtKindCreateRecord {
+			t.Errorf("unexpected event %+v", data)
+			return
+		}
+		if post := consumer.NewPost(data); feedRules.Match(post) {
+			got = append(got, post.ID)
+		}
+	}, nil)
+	if !errors.Is(err, consumer.ErrSourceExhausted) {
+		t.Fatalf("Run = %v, want ErrSourceExhausted", err)
+	}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("selected posts = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,226 @@
+package az
+
+import (
+	"maps"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/aykhans/bsky-feedgen/pkg/generator"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+)
+
+// The legacy AzPulse selection, hard-coded before the feed was defined in rules.json. The built-in
+// definition must select the same posts for the cases of legacyCases. It also selects the spellings
+// the legacy regex missed, see widenedCases.
+
+var legacyUsers = generator.Users{
+	// Invalid
+	"did:plc:5zww7zorx2ajw7hqrhuix3ba": false,
+	"did:plc:c4vhz47h566t2ntgd7gtawen": false,
+	"did:plc:lc7j7xdq67gn7vc6vzmydfqk": false,
+	"did:plc:msian4dqa2rqalf3biilnf3m": false,
+	"did:plc:gtosalycg7snvodjhsze35jm": false,
+	"did:plc:i53e6y3liw2oaw4s6e6odw5m": false,
+	"did:plc:pvdqvmpkeermkhy7fezam473": false,
+	"did:plc:5vwjnzaibnwscbbcvkzhy57v": false,
+	"did:plc:6mfp3coadoobuvlg6w2avw6x": false,
+	"did:plc:lm2uhaoqoe6yo76oeihndfyi": false,
+	"did:plc:vizwdor43adw3277u2kkrssd": false,
+	"did:plc:oqatvbgbhvqbjl2w2o63ehgi": false,
+	"did:plc:gy7yilnydusx5hy2z3dltynp": false,
+	"did:plc:xk7cs24wk6njv42azm2yd7dv": false,
+	"did:plc:ijmt7f4p3dcfqtg3j3zshimn": false,
+	"did:plc:2q5dx6whenn7pnsrfn3jpd6h": false,
+	"did:plc:s2waw3gkmn7h2nn6od44apng": false,
+	"did:plc:4hm6gb7dzobynqrpypif3dck": false,
+	"did:plc:odvarii7w7soygxet3xvzop7": false,
+	"did:plc:5cbkdchsxjvz5fog2oo7m4le": false,
+	"did:plc:ooeuisen5rtr4rojmz7gkbrh": false,
+	"did:plc:6bvhdvgeqkj7nol2zodtqmww": false,
+	"did:plc:k6sxlkd5ssq2uaylzisap2tw": false,
+	"did:plc:uxljnh22mmfzmr4i3oien6mx": false,
+	"did:plc:w5gg2zgwcyfevphehdcmavev": false,
+	"did:plc:ckawbibgmrwg3lbskfppwtlw": false,
+	"did:plc:43fdk46qa5gsokzygzildsaq": false,
+	"did:plc:3szm5t3tknphjtj73twqfonw": false,
+	"did:plc:4ukvsogndgp67sv6f6ohse3y": false,
+	"did:plc:cdplzvv63u5jxb4fxm4vpfgm": false,
+	"did:plc:namifrcorf6hzy45phd4shvt": false,
+	"did:plc:ltvtwjps77bqgm2knhlbswyk": false,
+	"did:plc:acglo4ret2f2wc5duqtispsa": false,
+	"did:plc:zibx3delbo24mdsccz6s7qa4": false,
+	"did:plc:dbpnhjiyq5e7pe3a4mt3jyhx": false,
+	"did:plc:ilvqavldtvn4ytagkvjafq6k": false,
+
+	// Valid
+	"did:plc:jbt4qi6psd7rutwzedtecsq7": true,
+	"did:plc:yzgdpxsklrmfgqmjghdvw3ti": true,
+	"did:plc:g7ebgiai577ln3avsi2pt3sn": true,
+	"did:plc:phtq2rhgbwipyx5ie3apw44j": true,
+	"did:plc:jfdvklrs5n5qv7f25v6swc5h": true,
+	"did:plc:u5ez5w6qslh6advti4wyddba": true,
+	"did:plc:x7alwnnjygt2aqcwblhazko7": true,
+	"did:plc:mgciyhgfn65z7iazxuar6o6a": true,
+	"did:plc:ay2f5go4lxq2hspiaqohegac": true,
+	"did:plc:ftoopigdpuzqt2kpeyqxsofx": true,
+	"did:plc:cs2cbzojm6hmx5lfxiuft3mq": true,
+}
+
+var legacyLangs = generator.Langs{
+	"az": true,
+	"en": true,
+	"tr": true,
+	"ru": true,
+}
+
+var legacyTextRegex = regexp.MustCompile("(?i)(azerbaijan|azərbaycan|aзербайджан|azerbaycan)")
+
+func legacyIsValid(post *collections.Post) bool {
+	if post.Reply != nil && post.Reply.RootURI != post.Reply.ParentURI {
+		return false
+	}
+
+	if isValidUser := legacyUsers.IsValid(post.DID); isValidUser != nil {
+		return *isValidUser
+	}
+
+	return (slices.Contains(post.Langs, "az") && len(post.Langs) < 3) ||
+		(legacyTextRegex.MatchString(post.Text) && legacyLangs.IsExistsAny(post.Langs))
+}
+
+const (
+	testAuthorDID  = "did:plc:testauthortestauthortest"
+	allowedDID     = "did:plc:jbt4qi6psd7rutwzedtecsq7"
+	deniedDID      = "did:plc:5zww7zorx2ajw7hqrhuix3ba"
+	rootPostURI    = "at://did:plc:testauthortestauthortest/app.bsky.feed.post/root"
+	replyParentURI = "at://did:plc:testauthortestauthortest/app.bsky.feed.post/parent"
+)
+
+var (
+	topLevel    = &collections.Reply{}
+	directReply = &collections.Reply{RootURI: rootPostURI, ParentURI: rootPostURI}
+	deepReply   = &collections.Reply{RootURI: rootPostURI, ParentURI: replyParentURI}
+)
+
+var legacyCases = []struct {
+	name  string
+	did   string
+	langs []string
+	text  string
+	reply *collections.Reply
+}{
+	{name: "azerbaijani post", langs: []string{"az"}, text: "Salam, necəsiniz?"},
+	{name: "azerbaijani post with two languages", langs: []string{"az", "en"}, text: "Salam"},
+	{name: "azerbaijani post with three languages", langs: []string{"az", "en", "tr"}, text: "Salam"},
+	{name: "post without languages", text: "Salam"},
+	{name: "english keyword", langs: []string{"en"}, text: "Travelling to Azerbaijan next week"},
+	{name: "english inflected keyword", langs: []string{"en"}, text: "Azerbaijani cuisine is great"},
+	{name: "uppercase keyword", langs: []string{"en"}, text: "AZERBAIJAN"},
+	{name: "azerbaijani keyword in english post", langs: []string{"en"}, text: "Azərbaycanda bahar"},
+	{name: "turkish keyword", langs: []string{"tr"}, text: "Azerbaycan çok güzel"},
+	{name: "russian keyword of the legacy regex", langs: []string{"ru"}, text: "Новости: aзербайджан"},
+	{name: "keyword with three languages", langs: []string{"en", "tr", "ru"}, text: "Azerbaijan"},
+	{name: "keyword inside a word", langs: []string{"en"}, text: "ProAzerbaijan"},
+	{name: "keyword inside a hashtag", langs: []string{"en"}, text: "#VisitAzerbaijan2025"},
+	{name: "keyword inside a word with three languages", langs: []string{"en", "tr", "ru"}, text: "#VisitAzərbaycan"},
+	{name: "keyword in other language", langs: []string{"de"}, text: "Urlaub in Azerbaijan"},
+	{name: "keyword without languages", text: "Azerbaijan"},
+	{name: "english post without keyword", langs: []string{"en"}, text: "Hello world"},
+	{name: "direct reply", langs: []string{"az"}, text: "Razıyam", reply: directReply},
+	{name: "deep reply", langs: []string{"az"}, text: "Razıyam", reply: deepReply},
+	{name: "deep reply with keyword", langs: []string{"en"}, text: "Azerbaijan", reply: deepReply},
+	{name: "allowed author", did: allowedDID, langs: []string{"de"}, text: "Guten Tag"},
+	{name: "allowed author without languages", did: allowedDID, text: "Hi"},
+	{name: "allowed author deep reply", did: allowedDID, langs: []string{"az"}, text: "Salam", reply: deepReply},
+	{name: "denied author", did: deniedDID, langs: []string{"az"}, text: "Salam"},
+	{name: "denied author with keyword", did: deniedDID, langs: []string{"en"}, text: "Azerbaijan"},
+}
+
+func TestDefaultRulesMatchLegacySelection(t *testing.T) {
+	feedRules, err := LoadRules("")
+	if err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+
+	for _, test := range legacyCases {
+		t.Run(test.name, func(t *testing.T) {
+			post := &collections.Post{
+				ID:    "post",
+				DID:   test.did,
+				Langs: test.langs,
+				Text:  test.text,
+				Reply: test.reply,
+			}
+			if post.DID == "" {
+				post.DID = testAuthorDID
+			}
+			if post.Reply == nil {
+				post.Reply = topLevel
+			}
+
+			want := legacyIsValid(post)
+			// The built-in definition doesn't depend on the detected language of the post
+			for _, detectedLang := range []string{"", "az", "tr", "uk"} {
+				post.DetectedLang = detectedLang
+				post.DetectedLangConfidence = 0
+				if detectedLang != "" {
+					post.DetectedLangConfidence = 0.99
+				}
+				if got := feedRules.Match(post); got != want {
+					t.Errorf("Match with detected language %q = %v, legacy IsValid = %v", detectedLang, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultRulesAuthorsMatchLegacyLists(t *testing.T) {
+	feedRules, err := LoadRules("")
+	if err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+
+	if !maps.Equal(feedRules.Users, legacyUsers) {
+		t.Errorf("authors of the definition differ from the legacy lists")
+	}
+}
+
+// widenedCases are posts the legacy regex missed because it only matched a few exact spellings.
+// The built-in definition matches the normalized text, so it selects them.
+var widenedCases = []struct {
+	name  string
+	langs []string
+	text  string
+}{
+	{name: "cyrillic keyword", langs: []string{"ru"}, text: "Новости Азербайджана"},
+	{name: "transliterated russian keyword", langs: []string{"en"}, text: "Azerbaydzhan"},
+	{name: "keyword with homoglyphs", langs: []string{"en"}, text: "Аzеrbаijаn"},
+	{name: "azerbaijani cyrillic keyword", langs: []string{"az", "ru", "en"}, text: "Азәрбајҹан Республикасы"},
+	{name: "mathematical letters", langs: []string{"en"}, text: "𝐀𝐳𝐞𝐫𝐛𝐚𝐢𝐣𝐚𝐧"},
+}
+
+func TestDefaultRulesWidenLegacySelection(t *testing.T) {
+	feedRules, err := LoadRules("")
+	if err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+
+	for _, test := range widenedCases {
+		t.Run(test.name, func(t *testing.T) {
+			post := &collections.Post{
+				ID:    "post",
+				DID:   testAuthorDID,
+				Langs: test.langs,
+				Text:  test.text,
+				Reply: topLevel,
+			}
+			if legacyIsValid(post) {
+				t.Errorf("legacy IsValid = true, want a post the legacy regex missed")
+			}
+			if !feedRules.Match(post) {
+				t.Errorf("Match = false, want true")
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Explanation is the trace of a generator's decision about a post.
+type Explanation struct {
+	Selected bool
+	// Evaluated rules in evaluation order. Rules after a deciding rule are not evaluated.
+	Steps []*ExplanationStep
+}
+
+// ExplanationStep is a rule evaluated for a post.
+type ExplanationStep struct {
+	// Path of the rule in the feed definition, e.g. match.any[0].langs_any
+	Rule   string
+	Passed bool
+	Detail string
+}
+
+// PostExplanation is the explanation of a stored post with its current state in the feed.
+type PostExplanation struct {
+	*Explanation
+	Post   *collections.Post
+	InFeed bool
+	// Moderation of the post in the feed, nil if it isn't moderated
+	Moderation *collections.FeedModeration
+}
+
+// ExplainPost loads the post and explains the decision of the generator about it, using the current
+// stored author lists. It returns types.ErrNotfound if the post isn't in the post collection.
+func ExplainPost(
+	ctx context.Context,
+	generator Generator,
+	postCollection *collections.PostCollection,
+	feedCollection *collections.FeedCollection,
+	feedModerationCollection *collections.FeedModerationCollection,
+	postID string,
+) (*PostExplanation, error) {
+	var post *collections.Post
+	err := postCollection.Collection.FindOne(ctx, bson.M{"_id": postID}).Decode(&post)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, types.ErrNotfound
+		}
+		return nil, err
+	}
+
+	if _, err := generator.Authors().Reload(ctx); err != nil {
+		return nil, fmt.Errorf("feed authors load error: %v", err)
+	}
+
+	inFeed, err := feedCollection.Exists(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	moderation, err := feedModerationCollection.Get(ctx, generator.FeedName(), postID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostExplanation{
+		Explanation: generator.Explain(post),
+		Post:        post,
+		InFeed:      inFeed,
+		Moderation:  moderation,
+	}, nil
+}
@@ -0,0 +1,248 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Reclassification is the difference between the feed of a generator and the posts its current rules select.
+type Reclassification struct {
+	// Posts evaluated with the generator
+	Scanned int64
+	// Posts that are in the feed and still selected
+	Kept int64
+	// Posts that are selected but not in the feed
+	Added []*collections.FeedItem
+	// IDs of the posts that are in the feed but no longer selected
+	Removed []string
+	// Selected posts that are not added because an admin removed them from the feed
+	SkippedRemoved int64
+	// Selected posts that are not added because they are near-duplicates of other posts
+	SkippedDuplicates int64
+	// Posts of the feed that can't be evaluated because they are no longer in the post collection
+	Unchecked int64
+
+	// Up to sampleSize of the added and removed posts
+	AddedSamples   []*collections.Post
+	RemovedSamples []*collections.Post
+}
+
+// Reclassify evaluates the posts created in [since, until) with the named generator and compares the result
+// with its feed collection. A zero since or until leaves that side of the range open. Like in a scheduled
+// run, the selected posts are tracked by the duplicate tracker of the generator. Nothing is changed;
+// see ApplyReclassification.
+func (r *Runner) Reclassify(
+	ctx context.Context,
+	generatorName string,
+	since time.Time,
+	until time.Time,
+	sampleSize int,
+) (*Reclassification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, err := r.entry(generatorName)
+	if err != nil {
+		return nil, err
+	}
+
+	feedIDs, err := entry.feedCollection.GetIDsByCreatedAt(ctx, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("get feed posts error: %v", err)
+	}
+
+	cursor, err := r.postCollection.Collection.Find(
+		ctx,
+		collections.CreatedAtRangeFilter(since, until),
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	reclassifier := newReclassifier(entry, feedIDs, sampleSize)
+	for cursor.Next(ctx) {
+		var doc *collections.Post
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("mongodb cursor decode error: %v", err)
+		}
+		reclassifier.evaluate(doc)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	addedPosts := reclassifier.addedPosts()
+	reclassification := reclassifier.result
+
+	// The posts removed by an admin are looked up batchSize posts at a time, so the queries stay small
+	removedIDs := make(map[string]bool)
+	for batch := range slices.Chunk(addedPosts, entry.batchSize) {
+		ids := make([]string, len(batch))
+		for i, post := range batch {
+			ids[i] = post.ID
+		}
+		batchRemovedIDs, err := r.feedModerationCollection.GetRemovedIDs(ctx, entry.generator.FeedName(), ids...)
+		if err != nil {
+			return nil, fmt.Errorf("get removed feed posts error: %v", err)
+		}
+		maps.Copy(removedIDs, batchRemovedIDs)
+	}
+
+	for _, post := range addedPosts {
+		if removedIDs[post.ID] {
+			reclassification.SkippedRemoved++
+			continue
+		}
+
+		reclassification.Added = append(reclassification.Added, collections.NewFeedItem(post))
+		if len(reclassification.AddedSamples) < sampleSize {
+			reclassification.AddedSamples = append(reclassification.AddedSamples, post)
+		}
+	}
+
+	return reclassification, nil
+}
+
+// ApplyReclassification inserts the added posts of the reclassification into the feed of the named generator
+// and deletes the removed posts from the feed and ranked feed collections, batchSize posts at a time.
+// The posts are inserted like the posts of a scheduled run, so deleted posts are skipped, the posts of every
+// author are capped and the changed duplicate clusters are stored. It returns the number of inserted and
+// deleted posts.
+func (r *Runner) ApplyReclassification(
+	ctx context.Context,
+	generatorName string,
+	reclassification *Reclassification,
+	feedRankedCollection *collections.FeedRankedCollection,
+) (int64, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, err := r.entry(generatorName)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	entry.batch = entry.batch[:0]
+	entry.inserted = 0
+	for batch := range slices.Chunk(reclassification.Added, entry.batchSize) {
+		entry.batch = append(entry.batch, batch...)
+		if err := r.insertBatch(ctx, entry); err != nil {
+			return entry.inserted, 0, err
+		}
+	}
+	// The duplicate clusters are stored even if no post was added
+	if err := r.flushDuplicates(ctx, entry); err != nil {
+		return entry.inserted, 0, err
+	}
+
+	var deleteCount int64
+	for batch := range slices.Chunk(reclassification.Removed, entry.batchSize) {
+		count, err := entry.feedCollection.DeleteByIDs(ctx, batch...)
+		if err != nil {
+			return entry.inserted, deleteCount, fmt.Errorf("delete %s feed error: %v", generatorName, err)
+		}
+		deleteCount += count
+
+		if _, err := feedRankedCollection.DeleteByFeedIDs(ctx, entry.generator.FeedName(), batch...); err != nil {
+			return entry.inserted, deleteCount, fmt.Errorf("delete %s ranked feed error: %v", generatorName, err)
+		}
+	}
+
+	return entry.inserted, deleteCount, nil
+}
+
+// reclassifier compares the posts selected by a runner entry with the posts of its feed.
+type reclassifier struct {
+	entry      *runnerEntry
+	result     *Reclassification
+	sampleSize int
+
+	// IDs of the feed posts that are not evaluated yet
+	feedIDs map[string]bool
+	// Selected posts that are in the feed
+	kept map[string]*collections.Post
+	// Selected posts that are not in the feed, in scan order
+	added []*collections.Post
+	// IDs of the added posts retracted by the duplicate tracker
+	retracted map[string]bool
+}
+
+func newReclassifier(entry *runnerEntry, feedIDs map[string]bool, sampleSize int) *reclassifier {
+	return &reclassifier{
+		entry:      entry,
+		result:     &Reclassification{},
+		sampleSize: sampleSize,
+		feedIDs:    feedIDs,
+		kept:       make(map[string]*collections.Post),
+		retracted:  make(map[string]bool),
+	}
+}
+
+// evaluate selects the post like evaluate of the Runner does.
+func (c *reclassifier) evaluate(doc *collections.Post) {
+	c.result.Scanned++
+
+	inFeed := c.feedIDs[doc.ID]
+	delete(c.feedIDs, doc.ID)
+
+	selected := c.entry.generator.IsValid(doc)
+	if selected && c.entry.duplicates != nil {
+		decision := c.entry.duplicates.Track(doc)
+		for _, id := range decision.Retracted {
+			c.retract(id)
+		}
+		if !decision.Keep {
+			selected = false
+			if !inFeed {
+				c.result.SkippedDuplicates++
+			}
+		}
+	}
+
+	switch {
+	case selected && inFeed:
+		c.kept[doc.ID] = doc
+		c.result.Kept++
+	case selected:
+		c.added = append(c.added, doc)
+	case inFeed:
+		c.remove(doc)
+	}
+}
+
+// retract unselects a post of a duplicate cluster that was flagged after the post had been selected.
+func (c *reclassifier) retract(id string) {
+	if doc, ok := c.kept[id]; ok {
+		delete(c.kept, id)
+		c.result.Kept--
+		c.remove(doc)
+		return
+	}
+
+	c.retracted[id] = true
+	c.result.SkippedDuplicates++
+}
+
+func (c *reclassifier) remove(doc *collections.Post) {
+	c.result.Removed = append(c.result.Removed, doc.ID)
+	if len(c.result.RemovedSamples) < c.sampleSize {
+		c.result.RemovedSamples = append(c.result.RemovedSamples, doc)
+	}
+}
+
+// addedPosts returns the selected posts that are not in the feed and sets the unchecked posts of the result.
+func (c *reclassifier) addedPosts() []*collections.Post {
+	c.result.Unchecked = int64(len(c.feedIDs))
+
+	return slices.DeleteFunc(c.added, func(post *collections.Post) bool {
+		return c.retracted[post.ID]
+	})
+}
@@ -0,0 +1,63 @@
+package generator
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"github.com/aykhans/bsky-feedgen/pkg/dedup"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+)
+
+func TestReclassifierTracksDuplicates(t *testing.T) {
+	const copypasta = "this exact text is posted by many different accounts at once"
+	createdAt := time.Now().Add(-time.Hour)
+	newPost := func(id string, did string, text string, reply *collections.Reply) *collections.Post {
+		createdAt = createdAt.Add(time.Second)
+		return &collections.Post{ID: id, DID: did, Text: text, CreatedAt: createdAt, Reply: reply}
+	}
+
+	entry := &runnerEntry{
+		generator: acceptAllGenerator{},
+		batchSize: 10,
+		duplicates: dedup.NewTracker(&config.FeedDuplicatesConfig{
+			Action:      types.DuplicateActionDrop,
+			Window:      time.Hour,
+			MinAuthors:  2,
+			MaxDistance: 3,
+		}),
+	}
+	feedIDs := map[string]bool{"first": true, "unique": true, "deleted": true}
+	reclassifier := newReclassifier(entry, feedIDs, 10)
+
+	posts := []*collections.Post{
+		// In the feed until the second author posts the same text
+		newPost("first", "did:plc:a", copypasta, nil),
+		newPost("unique", "did:plc:a", "a post that nobody else wrote about the weather today", nil),
+		newPost("second", "did:plc:b", copypasta, nil),
+		newPost("reply", "did:plc:c", "a reply that is new to the feed and has enough words", &collections.Reply{
+			RootURI:   "at://did:plc:a/app.bsky.feed.post/unique",
+			ParentURI: "at://did:plc:a/app.bsky.feed.post/unique",
+		}),
+	}
+	for _, post := range posts {
+		reclassifier.evaluate(post)
+	}
+	addedPosts := reclassifier.addedPosts()
+	result := reclassifier.result
+
+	if result.Scanned != 4 || result.Kept != 1 || result.Unchecked != 1 {
+		t.Errorf("scanned, kept, unchecked = %d, %d, %d, want 4, 1, 1", result.Scanned, result.Kept, result.Unchecked)
+	}
+	if !slices.Equal(result.Removed, []string{"first"}) {
+		t.Errorf("removed = %v, want the retracted feed post", result.Removed)
+	}
+	if result.SkippedDuplicates != 1 {
+		t.Errorf("skipped duplicates = %d, want 1", result.SkippedDuplicates)
+	}
+	if len(addedPosts) != 1 || addedPosts[0].ID != "reply" {
+		t.Errorf("added = %v, want the reply", addedPosts)
+	}
+}
@@ -0,0 +1,81 @@
+package generator
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+)
+
+// Generator selects the posts of a feed.
+type Generator interface {
+	// Name is the registry name of the generator. It also names the generator's
+	// feed collection (feed_<name>) and its environment variables (FEED_<NAME>_*).
+	Name() string
+	// FeedName is the record key of the feed, e.g. AzPulse.
+	FeedName() string
+	// Authors returns the stored authors that are explicitly included in or excluded from the feed.
+	Authors() *Authors
+	// DefaultUsers returns the author lists the feed is seeded with when it has no stored authors.
+	DefaultUsers() Users
+	IsValid(post *collections.Post) bool
+	// Explain evaluates the post like IsValid and returns the trace of the decision.
+	Explain(post *collections.Post) *Explanation
+}
+
+// Factory creates a generator from its feed configuration.
+// The author lists of the feed are stored in feedAuthorCollection, see NewAuthors.
+type Factory func(feedConfig *config.FeedConfig, feedAuthorCollection *collections.FeedAuthorCollection) (Generator, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a generator available by name. It is meant to be called from the init function
+// of the generator's package, and panics if the name is already registered.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("generator: Register factory is nil for " + name)
+	}
+	if _, ok := registry[name]; ok {
+		panic("generator: Register called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// New creates the registered generator named by feedConfig.GeneratorName.
+func New(feedConfig *config.FeedConfig, feedAuthorCollection *collections.FeedAuthorCollection) (Generator, error) {
+	registryMu.RLock()
+	factory, ok := registry[feedConfig.GeneratorName]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf(
+			"unknown generator %s, registered generators: %s",
+			feedConfig.GeneratorName, strings.Join(Names(), ", "),
+		)
+	}
+
+	return factory(feedConfig, feedAuthorCollection)
+}
+
+// Names returns the sorted names of the registered generators.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
@@ -0,0 +1,443 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"github.com/aykhans/bsky-feedgen/pkg/dedup"
+	"github.com/aykhans/bsky-feedgen/pkg/logger"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Runner runs a set of generators on their own schedules. Generators that are due at the
+// same time share a single scan of the post collection.
+type Runner struct {
+	postCollection             *collections.PostCollection
+	postTombstoneCollection    *collections.PostTombstoneCollection
+	feedModerationCollection   *collections.FeedModerationCollection
+	generatorStatCollection    *collections.GeneratorStatCollection
+	duplicateClusterCollection *collections.DuplicateClusterCollection
+	entries                    []*runnerEntry
+
+	// Serializes the scheduled runs and the runs requested with RunNow
+	mu sync.Mutex
+}
+
+type runnerEntry struct {
+	generator      Generator
+	feedCollection *collections.FeedCollection
+	batchSize      int
+	delay          time.Duration
+	nextRun        time.Time
+	duplicates     *dedup.Tracker // nil if near-duplicate detection is off
+	diversity      *config.FeedDiversityConfig
+
+	// Feed posts of newly flagged duplicate clusters that are still to be deleted
+	retracted []string
+
+	// State of the current run
+	cursor   *int64 // Only posts after this sequence are evaluated, nil for all posts
+	batch    []*collections.FeedItem
+	scanned  int64
+	inserted int64
+}
+
+func NewRunner(
+	postCollection *collections.PostCollection,
+	postTombstoneCollection *collections.PostTombstoneCollection,
+	feedModerationCollection *collections.FeedModerationCollection,
+	generatorStatCollection *collections.GeneratorStatCollection,
+	duplicateClusterCollection *collections.DuplicateClusterCollection,
+) *Runner {
+	return &Runner{
+		postCollection:             postCollection,
+		postTombstoneCollection:    postTombstoneCollection,
+		feedModerationCollection:   feedModerationCollection,
+		generatorStatCollection:    generatorStatCollection,
+		duplicateClusterCollection: duplicateClusterCollection,
+	}
+}
+
+// Add schedules the generator to run every delay, inserting the selected posts into
+// feedCollection batchSize at a time. The selected posts are tracked by duplicates,
+// if it isn't nil, which keeps near-identical posts of different authors out of the feed,
+// and the posts of every author are capped by diversity.
+func (r *Runner) Add(
+	generator Generator,
+	feedCollection *collections.FeedCollection,
+	batchSize int,
+	delay time.Duration,
+	duplicates *dedup.Tracker,
+	diversity *config.FeedDiversityConfig,
+) {
+	r.entries = append(r.entries, &runnerEntry{
+		generator:      generator,
+		feedCollection: feedCollection,
+		batchSize:      batchSize,
+		delay:          delay,
+		duplicates:     duplicates,
+		diversity:      diversity,
+	})
+}
+
+// Run runs the due generators until ctx is done. Like the other crons, the delay of a
+// generator starts when its run is completed.
+func (r *Runner) Run(ctx context.Context, cursorOption types.GeneratorCursor) {
+	if len(r.entries) == 0 {
+		return
+	}
+
+	for {
+		nextRun := r.entries[0].nextRun
+		for _, entry := range r.entries[1:] {
+			if entry.nextRun.Before(nextRun) {
+				nextRun = entry.nextRun
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(nextRun)):
+		}
+
+		now := time.Now()
+		var dueEntries []*runnerEntry
+		names := []string{}
+		for _, entry := range r.entries {
+			if !entry.nextRun.After(now) {
+				dueEntries = append(dueEntries, entry)
+				names = append(names, entry.generator.Name())
+			}
+		}
+
+		startTime := time.Now()
+		err := r.run(ctx, dueEntries, cursorOption, "cron")
+		if err != nil {
+			logger.Log.Error("Feed generator cron error", "generators", names, "error", err)
+		}
+		elapsedTime := time.Since(startTime)
+		logger.Log.Info("Feed generator cron completed", "generators", names, "time", elapsedTime)
+
+		for _, entry := range dueEntries {
+			entry.nextRun = time.Now().Add(entry.delay)
+		}
+	}
+}
+
+// RunNow runs the named generator immediately, outside of its schedule.
+func (r *Runner) RunNow(ctx context.Context, generatorName string, cursorOption types.GeneratorCursor) error {
+	entry, err := r.entry(generatorName)
+	if err != nil {
+		return err
+	}
+
+	return r.run(ctx, []*runnerEntry{entry}, cursorOption, "task")
+}
+
+// entry returns the entry of the named generator.
+func (r *Runner) entry(generatorName string) (*runnerEntry, error) {
+	for _, entry := range r.entries {
+		if entry.generator.Name() == generatorName {
+			return entry, nil
+		}
+	}
+
+	return nil, fmt.Errorf("generator %s is not running", generatorName)
+}
+
+// run runs the entries and stores the stats of every entry.
+func (r *Runner) run(ctx context.Context, entries []*runnerEntry, cursorOption types.GeneratorCursor, trigger string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	startTime := time.Now()
+	err := r.runOnce(ctx, entries, cursorOption)
+	elapsedTime := time.Since(startTime)
+
+	stats := make([]*collections.GeneratorStat, len(entries))
+	for i, entry := range entries {
+		stats[i] = &collections.GeneratorStat{
+			Generator: entry.generator.Name(),
+			Type:      collections.FeedgenTaskTypeGenerate,
+			Trigger:   trigger,
+			StartedAt: startTime,
+			Duration:  elapsedTime,
+			Scanned:   entry.scanned,
+			Count:     entry.inserted,
+		}
+		if err != nil {
+			stats[i].Error = err.Error()
+		}
+	}
+	if statErr := r.generatorStatCollection.Insert(ctx, stats...); statErr != nil {
+		logger.Log.Error("failed to store generator stats", "error", statErr)
+	}
+
+	return err
+}
+
+// runOnce evaluates the posts after the earliest cursor of the entries with every entry,
+// so N generators cost a single scan of the post collection.
+func (r *Runner) runOnce(ctx context.Context, entries []*runnerEntry, cursorOption types.GeneratorCursor) error {
+	var scanCursor *int64
+	for i, entry := range entries {
+		entry.cursor = nil
+		entry.batch = entry.batch[:0]
+		entry.scanned = 0
+		entry.inserted = 0
+
+		if cursorOption == types.GeneratorCursorLastGenerated {
+			cursor, err := entry.feedCollection.GetMaxSequence(ctx)
+			if err != nil {
+				return err
+			}
+			entry.cursor = cursor
+		}
+
+		if i == 0 || scanCursor != nil && (entry.cursor == nil || *entry.cursor < *scanCursor) {
+			scanCursor = entry.cursor
+		}
+	}
+
+	filter := bson.M{"hidden": bson.M{"$ne": true}}
+	if scanCursor != nil {
+		filter["sequence"] = bson.M{"$gt": *scanCursor}
+	}
+	mongoCursor, err := r.postCollection.Collection.Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}}),
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = mongoCursor.Close(ctx) }()
+
+	if err := r.scan(ctx, mongoCursor, entries); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := r.insertBatch(ctx, entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Runner) scan(ctx context.Context, mongoCursor *mongo.Cursor, entries []*runnerEntry) error {
+	for mongoCursor.Next(ctx) {
+		var doc *collections.Post
+		if err := mongoCursor.Decode(&doc); err != nil {
+			return fmt.Errorf("mongodb cursor decode error: %v", err)
+		}
+
+		if err := r.evaluate(ctx, entries, doc); err != nil {
+			return err
+		}
+	}
+
+	return mongoCursor.Err()
+}
+
+// evaluate adds the post to the batch of every entry whose generator selects it, inserting the full batches.
+func (r *Runner) evaluate(ctx context.Context, entries []*runnerEntry, doc *collections.Post) error {
+	for _, entry := range entries {
+		if entry.cursor != nil && doc.Sequence <= *entry.cursor {
+			continue
+		}
+		entry.scanned++
+		if !entry.generator.IsValid(doc) {
+			continue
+		}
+		if entry.duplicates != nil {
+			decision := entry.duplicates.Track(doc)
+			if len(decision.Retracted) > 0 {
+				entry.batch = slices.DeleteFunc(entry.batch, func(feedItem *collections.FeedItem) bool {
+					return slices.Contains(decision.Retracted, feedItem.ID)
+				})
+				entry.retracted = append(entry.retracted, decision.Retracted...)
+			}
+			if !decision.Keep {
+				continue
+			}
+		}
+
+		entry.batch = append(entry.batch, collections.NewFeedItem(doc))
+
+		if len(entry.batch) >= entry.batchSize {
+			if err := r.insertBatch(ctx, entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// insertBatch inserts the batch of the entry into its feed collection. It skips the posts deleted by
+// their authors after they had been read, the posts removed from the feed by an admin and the posts of
+// authors over their post limit. Before that, the retracted posts of duplicate clusters are deleted
+// from the feed and the changed clusters are stored. The deleted posts are removed from the duplicate
+// tracker, so they don't take the place of the kept posts of their clusters.
+func (r *Runner) insertBatch(ctx context.Context, entry *runnerEntry) error {
+	if err := r.flushDuplicates(ctx, entry); err != nil {
+		return err
+	}
+	if len(entry.batch) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(entry.batch))
+	for i, feedItem := range entry.batch {
+		ids[i] = feedItem.ID
+	}
+
+	deletedIDs, err := r.postTombstoneCollection.GetExistingIDs(ctx, ids...)
+	if err != nil {
+		return fmt.Errorf("get post tombstones error: %v", err)
+	}
+
+	removedIDs, err := r.feedModerationCollection.GetRemovedIDs(ctx, entry.generator.FeedName(), ids...)
+	if err != nil {
+		return fmt.Errorf("get removed feed posts error: %v", err)
+	}
+
+	if entry.duplicates != nil && len(deletedIDs) > 0 {
+		entry.duplicates.Remove(slices.Collect(maps.Keys(deletedIDs))...)
+	}
+
+	feedBatch := entry.batch
+	if len(deletedIDs) > 0 || len(removedIDs) > 0 {
+		feedBatch = slices.DeleteFunc(feedBatch, func(feedItem *collections.FeedItem) bool {
+			return deletedIDs[feedItem.ID] || removedIDs[feedItem.ID]
+		})
+	}
+
+	if entry.diversity.AuthorMaxPosts > 0 {
+		feedBatch, err = capAuthors(ctx, entry, feedBatch)
+		if err != nil {
+			return fmt.Errorf("get %s author posts error: %v", entry.generator.Name(), err)
+		}
+	}
+
+	if err := entry.feedCollection.Insert(ctx, true, feedBatch...); err != nil {
+		return fmt.Errorf("insert %s feed error: %v", entry.generator.Name(), err)
+	}
+	entry.inserted += int64(len(feedBatch))
+	entry.batch = entry.batch[:0]
+
+	return nil
+}
+
+// flushDuplicates deletes the retracted posts of the entry from its feed collection and stores its
+// changed duplicate clusters.
+func (r *Runner) flushDuplicates(ctx context.Context, entry *runnerEntry) error {
+	if entry.duplicates == nil {
+		return nil
+	}
+
+	if len(entry.retracted) > 0 {
+		deleteCount, err := entry.feedCollection.DeleteByIDs(ctx, entry.retracted...)
+		if err != nil {
+			return fmt.Errorf("delete %s duplicate posts error: %v", entry.generator.Name(), err)
+		}
+		logger.Log.Info("Removed posts of a duplicate cluster", "generator", entry.generator.Name(), "count", deleteCount)
+		entry.retracted = entry.retracted[:0]
+	}
+
+	changed := entry.duplicates.Changed()
+	if len(changed) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	feedName := entry.generator.FeedName()
+	clusters := make([]*collections.DuplicateCluster, len(changed))
+	for i, cluster := range changed {
+		clusters[i] = &collections.DuplicateCluster{
+			ID:           collections.DuplicateClusterID(feedName, cluster.ID),
+			Feed:         feedName,
+			Generator:    entry.generator.Name(),
+			Action:       entry.duplicates.Action().String(),
+			Fingerprint:  strconv.FormatUint(cluster.Fingerprint, 16),
+			SampleText:   cluster.SampleText,
+			PostCount:    cluster.PostCount,
+			AuthorCount:  cluster.AuthorCount(),
+			DroppedCount: cluster.DroppedCount,
+			PostIDs:      slices.Clone(cluster.PostIDs),
+			DIDs:         slices.Clone(cluster.DIDs),
+			FirstSeenAt:  cluster.FirstSeenAt,
+			LastSeenAt:   cluster.LastSeenAt,
+			UpdatedAt:    now,
+		}
+	}
+	if err := r.duplicateClusterCollection.Upsert(ctx, clusters...); err != nil {
+		return fmt.Errorf("store %s duplicate clusters error: %v", entry.generator.Name(), err)
+	}
+
+	return nil
+}
+
+// capAuthors removes the posts of the batch whose authors already have AuthorMaxPosts posts in the feed
+// created within AuthorWindow before them. Posts that are already in the feed are kept.
+func capAuthors(ctx context.Context, entry *runnerEntry, feedBatch []*collections.FeedItem) ([]*collections.FeedItem, error) {
+	if len(feedBatch) == 0 {
+		return feedBatch, nil
+	}
+
+	window := entry.diversity.AuthorWindow
+	since := feedBatch[0].CreatedAt
+	var dids []string
+	for _, feedItem := range feedBatch {
+		if feedItem.CreatedAt.Before(since) {
+			since = feedItem.CreatedAt
+		}
+		if !slices.Contains(dids, feedItem.DID) {
+			dids = append(dids, feedItem.DID)
+		}
+	}
+
+	existingItems, err := entry.feedCollection.GetByDIDsCreatedAfter(ctx, since.Add(-window), dids...)
+	if err != nil {
+		return nil, err
+	}
+
+	inFeed := make(map[string]bool, len(existingItems))
+	authorPostTimes := make(map[string][]time.Time)
+	for _, feedItem := range existingItems {
+		inFeed[feedItem.ID] = true
+		authorPostTimes[feedItem.DID] = append(authorPostTimes[feedItem.DID], feedItem.CreatedAt)
+	}
+
+	return slices.DeleteFunc(feedBatch, func(feedItem *collections.FeedItem) bool {
+		if inFeed[feedItem.ID] {
+			return false
+		}
+
+		count := 0
+		for _, postTime := range authorPostTimes[feedItem.DID] {
+			if !postTime.After(feedItem.CreatedAt) && feedItem.CreatedAt.Sub(postTime) < window {
+				count++
+			}
+		}
+		if count >= entry.diversity.AuthorMaxPosts {
+			return true
+		}
+
+		authorPostTimes[feedItem.DID] = append(authorPostTimes[feedItem.DID], feedItem.CreatedAt)
+		return false
+	}), nil
+}
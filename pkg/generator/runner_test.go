@@ -0,0 +1,62 @@
+package generator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+)
+
+// acceptAllGenerator selects every post.
+type acceptAllGenerator struct {
+	Generator
+}
+
+func (acceptAllGenerator) IsValid(*collections.Post) bool {
+	return true
+}
+
+func TestEvaluateMarksOnlyRepliesAsReplies(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply *collections.Reply
+		want  bool
+	}{
+		// The consumer stores an empty reply for every top-level post
+		{name: "top-level post", reply: &collections.Reply{}, want: false},
+		{name: "post without reply", reply: nil, want: false},
+		{
+			name: "reply",
+			reply: &collections.Reply{
+				RootURI:   "at://did:plc:root/app.bsky.feed.post/1",
+				ParentURI: "at://did:plc:root/app.bsky.feed.post/1",
+			},
+			want: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry := &runnerEntry{generator: acceptAllGenerator{}, batchSize: 10}
+			post := &collections.Post{
+				ID:        "did:plc:author/3k",
+				Sequence:  1,
+				DID:       "did:plc:author",
+				RecordKey: "3k",
+				CreatedAt: time.Now(),
+				Reply:     test.reply,
+			}
+
+			if err := (&Runner{}).evaluate(context.Background(), []*runnerEntry{entry}, post); err != nil {
+				t.Fatalf("evaluate: %v", err)
+			}
+			if len(entry.batch) != 1 {
+				t.Fatalf("batch has %d items, want 1", len(entry.batch))
+			}
+			if got := entry.batch[0].Reply; got != test.want {
+				t.Errorf("Reply = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/logger"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// streamCheckpointID is the ID of the resume token of the runner's change stream.
+const streamCheckpointID = "feedgen"
+
+const (
+	// streamStatDelay is the interval of storing the stats of the streamed posts.
+	streamStatDelay = time.Minute
+	// streamRetryDelay is the delay before the change stream is reopened after an error.
+	streamRetryDelay = 10 * time.Second
+)
+
+// MongoDB error codes of change streams
+const (
+	errCodeChangeStreamHistoryLost  = 286
+	errCodeChangeStreamNotSupported = 40573
+)
+
+// Stream evaluates the posts with every generator as they are stored in the post collection, using a
+// MongoDB change stream, until ctx is done. The selected posts are inserted into the feeds after at most
+// flushDelay, then the resume token of the stream is stored, so a restart continues from the last inserted post.
+//
+// The post collection is scanned from the cursor first, like Run does, unless the stream is resumed from a
+// stored token. Change streams require a replica set; when they aren't available, Stream falls back to Run.
+func (r *Runner) Stream(
+	ctx context.Context,
+	cursorOption types.GeneratorCursor,
+	checkpointCollection *collections.ChangeStreamCheckpointCollection,
+	flushDelay time.Duration,
+) {
+	if len(r.entries) == 0 {
+		return
+	}
+
+	// The stored token is ignored when the generation starts from the first post
+	resume := cursorOption.IsLastGenerated()
+	for {
+		resumable, err := r.stream(ctx, cursorOption, checkpointCollection, flushDelay, resume)
+		if ctx.Err() != nil {
+			return
+		}
+
+		var serverErr mongo.ServerError
+		switch {
+		case errors.As(err, &serverErr) && serverErr.HasErrorCode(errCodeChangeStreamNotSupported):
+			logger.Log.Warn("Change streams are not supported by MongoDB, falling back to cron generation", "error", err)
+			r.Run(ctx, cursorOption)
+			return
+		case errors.As(err, &serverErr) && serverErr.HasErrorCode(errCodeChangeStreamHistoryLost):
+			// The stored token is older than the oplog, the missed posts are scanned from the feeds' cursors
+			logger.Log.Warn("Feed generator stream resume token expired", "error", err)
+			resume = false
+		default:
+			logger.Log.Error("Feed generator stream error", "error", err)
+			resume = resume || resumable
+			time.Sleep(streamRetryDelay)
+		}
+		if resumable {
+			cursorOption = types.GeneratorCursorLastGenerated
+		}
+	}
+}
+
+// stream runs the change stream until an error occurs. It reports whether the stream can be resumed
+// from the stored token, which is false if the error occurred before the initial scan was completed.
+func (r *Runner) stream(
+	ctx context.Context,
+	cursorOption types.GeneratorCursor,
+	checkpointCollection *collections.ChangeStreamCheckpointCollection,
+	flushDelay time.Duration,
+	resume bool,
+) (bool, error) {
+	var resumeToken bson.Raw
+	if resume {
+		var err error
+		resumeToken, err = checkpointCollection.GetResumeToken(ctx, streamCheckpointID)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Posts are upserted by the consumer, so new posts are inserts and rewritten posts are replaces
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"operationType": bson.M{"$in": bson.A{"insert", "replace"}}}}},
+	}
+	streamOptions := options.ChangeStream()
+	if resumeToken != nil {
+		streamOptions.SetStartAfter(resumeToken)
+	}
+	changeStream, err := r.postCollection.Collection.Watch(ctx, pipeline, streamOptions)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = changeStream.Close(ctx) }()
+
+	if resumeToken == nil {
+		// The stream is opened before the scan, so no post is missed between them. Posts stored during
+		// the scan are evaluated twice, which only rewrites their feed documents.
+		if err := r.run(ctx, r.entries, cursorOption, "stream"); err != nil {
+			return false, err
+		}
+		if err := checkpointCollection.Save(ctx, streamCheckpointID, changeStream.ResumeToken()); err != nil {
+			return false, err
+		}
+	}
+	logger.Log.Info("Feed generator stream started", "resumed", resumeToken != nil)
+
+	stats := make([]*collections.GeneratorStat, len(r.entries))
+	resetStats := func() {
+		for i, entry := range r.entries {
+			stats[i] = &collections.GeneratorStat{
+				Generator: entry.generator.Name(),
+				Type:      collections.FeedgenTaskTypeGenerate,
+				Trigger:   "stream",
+				StartedAt: time.Now(),
+			}
+		}
+	}
+	resetStats()
+
+	for {
+		// TryNext waits for new events for the max await time of the server (1s by default) before it returns false
+		if changeStream.TryNext(ctx) {
+			if err := r.streamBatch(ctx, changeStream, checkpointCollection, flushDelay, stats); err != nil {
+				return true, err
+			}
+		} else if err := changeStream.Err(); err != nil {
+			return true, err
+		} else if changeStream.ID() == 0 {
+			return true, errors.New("change stream closed by the server")
+		}
+
+		if time.Since(stats[0].StartedAt) >= streamStatDelay {
+			if err := r.generatorStatCollection.Insert(ctx, stats...); err != nil {
+				logger.Log.Error("failed to store generator stats", "error", err)
+			}
+			for _, stat := range stats {
+				logger.Log.Info(
+					"Feed generator stream stats",
+					"generator", stat.Generator,
+					"scanned", stat.Scanned,
+					"count", stat.Count,
+					"time", stat.Duration,
+				)
+			}
+			resetStats()
+		}
+	}
+}
+
+// streamBatch evaluates the current event of the change stream and the events that are already available,
+// for at most flushDelay, then inserts the selected posts and stores the resume token. The stats of the
+// entries are added to stats.
+func (r *Runner) streamBatch(
+	ctx context.Context,
+	changeStream *mongo.ChangeStream,
+	checkpointCollection *collections.ChangeStreamCheckpointCollection,
+	flushDelay time.Duration,
+	stats []*collections.GeneratorStat,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	startTime := time.Now()
+	for _, entry := range r.entries {
+		entry.cursor = nil
+		entry.scanned = 0
+		entry.inserted = 0
+	}
+
+	for {
+		var event struct {
+			FullDocument *collections.Post `bson:"fullDocument"`
+		}
+		if err := changeStream.Decode(&event); err != nil {
+			return fmt.Errorf("mongodb change stream decode error: %v", err)
+		}
+		if event.FullDocument != nil && !event.FullDocument.Hidden {
+			if err := r.evaluate(ctx, r.entries, event.FullDocument); err != nil {
+				return err
+			}
+		}
+
+		if time.Since(startTime) >= flushDelay || !changeStream.TryNext(ctx) {
+			break
+		}
+	}
+	if err := changeStream.Err(); err != nil {
+		return err
+	}
+
+	for _, entry := range r.entries {
+		if err := r.insertBatch(ctx, entry); err != nil {
+			return err
+		}
+	}
+	if err := checkpointCollection.Save(ctx, streamCheckpointID, changeStream.ResumeToken()); err != nil {
+		return err
+	}
+
+	elapsedTime := time.Since(startTime)
+	for i, entry := range r.entries {
+		stats[i].Duration += elapsedTime
+		stats[i].Scanned += entry.scanned
+		stats[i].Count += entry.inserted
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+// Package langid identifies the language of short texts like posts.
+//
+// It is a naive Bayes classifier over character 1-3 grams. The model is trained at first use from the
+// sample texts in the data directory, which are embedded into the binary, so detection works offline.
+// Adding a language is adding a data/<ISO 639-1 code>.txt file with a few thousand characters of text.
+// A language written in several scripts has a sample per script, e.g. data/az-cyrl.txt for Cyrillic
+// Azerbaijani, which are separate models that detect the same language.
+package langid
+
+import (
+	"embed"
+	"math"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// MinLetters is the minimum number of letters a text needs for its language to be detected.
+const MinLetters = 12
+
+// Result is the detected language of a text.
+type Result struct {
+	// ISO 639-1 code of the language, empty if the text is too short.
+	Lang string
+	// Probability of the language among the known languages, between 0 and 1.
+	Confidence float64
+}
+
+//go:embed data/*.txt
+var data embed.FS
+
+// maxNgram is the length of the longest character n-gram of the model.
+const maxNgram = 3
+
+// temperature flattens the posterior probabilities. Naive Bayes treats the overlapping n-grams of a
+// text as independent, which makes its raw probabilities overconfident.
+const temperature = 4
+
+type languageModel struct {
+	lang string
+	// Log probability of every n-gram seen in the sample text, by n-gram length.
+	logProbs [maxNgram]map[string]float64
+	// Log probability of an n-gram that isn't in the sample text, by n-gram length.
+	unseenLogProbs [maxNgram]float64
+}
+
+type model struct {
+	languages []*languageModel
+	// Letters of all sample texts
+	letters map[string]bool
+}
+
+var loadModel = sync.OnceValue(func() *model {
+	entries, err := data.ReadDir("data")
+	if err != nil {
+		panic("langid: " + err.Error())
+	}
+
+	var counts []*[maxNgram]map[string]int
+	var langs []string
+	var vocabulary [maxNgram]map[string]bool
+	for n := range maxNgram {
+		vocabulary[n] = make(map[string]bool)
+	}
+
+	for _, entry := range entries {
+		sample, err := data.ReadFile(path.Join("data", entry.Name()))
+		if err != nil {
+			panic("langid: " + err.Error())
+		}
+
+		var langCounts [maxNgram]map[string]int
+		for n := range maxNgram {
+			langCounts[n] = make(map[string]int)
+		}
+		forEachNgram(normalize(string(sample)), func(ngram string, n int) {
+			langCounts[n-1][ngram]++
+			vocabulary[n-1][ngram] = true
+		})
+
+		counts = append(counts, &langCounts)
+		lang, _, _ := strings.Cut(strings.TrimSuffix(entry.Name(), ".txt"), "-")
+		langs = append(langs, lang)
+	}
+
+	// Add-one smoothed probabilities
+	languages := make([]*languageModel, len(langs))
+	for i, lang := range langs {
+		language := &languageModel{lang: lang}
+		for n := range maxNgram {
+			total := 0
+			for _, count := range counts[i][n] {
+				total += count
+			}
+			denominator := float64(total + len(vocabulary[n]))
+
+			language.logProbs[n] = make(map[string]float64, len(counts[i][n]))
+			for ngram, count := range counts[i][n] {
+				language.logProbs[n][ngram] = math.Log(float64(count+1) / denominator)
+			}
+			language.unseenLogProbs[n] = math.Log(1 / denominator)
+		}
+		languages[i] = language
+	}
+
+	return &model{languages: languages, letters: vocabulary[0]}
+})
+
+// Languages returns the ISO 639-1 codes of the languages that can be detected.
+func Languages() []string {
+	languages := loadModel().languages
+
+	langs := make([]string, len(languages))
+	for i, language := range languages {
+		langs[i] = language.lang
+	}
+	slices.Sort(langs)
+
+	return slices.Compact(langs)
+}
+
+// Detect returns the most probable language of the text. Links, mentions, numbers and punctuation are ignored.
+// Texts with less than MinLetters letters, or mostly with letters of unknown scripts, are not detected.
+func Detect(text string) Result {
+	normalized := normalize(text)
+	model := loadModel()
+
+	letters, knownLetters := 0, 0
+	for _, r := range normalized {
+		if r != ' ' {
+			letters++
+			if model.letters[string(r)] {
+				knownLetters++
+			}
+		}
+	}
+	if letters < MinLetters || knownLetters*2 < letters {
+		return Result{}
+	}
+
+	scores := make([]float64, len(model.languages))
+	forEachNgram(normalized, func(ngram string, n int) {
+		for i, language := range model.languages {
+			logProb, ok := language.logProbs[n-1][ngram]
+			if !ok {
+				logProb = language.unseenLogProbs[n-1]
+			}
+			scores[i] += logProb
+		}
+	})
+
+	best := 0
+	for i := range scores {
+		if scores[i] > scores[best] {
+			best = i
+		}
+	}
+
+	// Softmax of the tempered scores, relative to the best score to avoid underflow.
+	// The models of the other scripts of the language count towards its probability.
+	lang := model.languages[best].lang
+	var sum, langSum float64
+	for i := range scores {
+		probability := math.Exp((scores[i] - scores[best]) / temperature)
+		sum += probability
+		if model.languages[i].lang == lang {
+			langSum += probability
+		}
+	}
+
+	return Result{
+		Lang:       lang,
+		Confidence: langSum / sum,
+	}
+}
+
+// normalize lowercases the words of the text and joins them with single spaces, with a space at both ends.
+// Links, mentions and everything except letters are removed.
+func normalize(text string) string {
+	var builder strings.Builder
+	builder.Grow(len(text) + 2)
+	builder.WriteByte(' ')
+
+	lastSpace := true
+	for _, word := range strings.Fields(text) {
+		if strings.HasPrefix(word, "@") || strings.Contains(word, "://") || strings.HasPrefix(word, "www.") {
+			continue
+		}
+
+		for _, r := range word + " " {
+			if unicode.IsLetter(r) || unicode.Is(unicode.Mn, r) {
+				builder.WriteRune(unicode.ToLower(r))
+				lastSpace = false
+			} else if !lastSpace {
+				builder.WriteByte(' ')
+				lastSpace = true
+			}
+		}
+	}
+
+	return builder.String()
+}
+
+// forEachNgram calls fn with every 1 to maxNgram long n-gram of the normalized text.
+// Unigrams are letters, longer n-grams may start or end with the space around a word but don't span words.
+func forEachNgram(normalized string, fn func(ngram string, n int)) {
+	runes := []rune(normalized)
+	for i := range runes {
+		for n := 1; n <= maxNgram && i+n <= len(runes); n++ {
+			ngram := runes[i : i+n]
+			if n == 1 {
+				if ngram[0] != ' ' {
+					fn(string(ngram), n)
+				}
+				continue
+			}
+			if slices.Contains(ngram[1:n-1], ' ') || ngram[0] == ' ' && ngram[n-1] == ' ' {
+				break
+			}
+			fn(string(ngram), n)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package langid
+
+import (
+	"slices"
+	"testing"
+)
+
+// heldOutTexts are post-like texts that are not part of the samples in the data directory.
+var heldOutTexts = map[string][]string{
+	"az": {
+		"Sabah tezdən işə getməliyəm, çox yorğunam",
+		"Bu həftə sonu Qəbələyə getməyi planlaşdırırıq",
+		"Dünən axşam dostlarımla çay içib söhbət etdik",
+		"Yeni telefonumun batareyası bir gün də davam gətirmir",
+		"Qonşumuzun pişiyi yenə bizim balkona çıxıb",
+		// Cyrillic Azerbaijani
+		"Азәрбајҹан Республикасы Ҹәнуби Гафгазда јерләшир",
+		"Мән бу ҝүн ишә ҝетмәдим, чүнки хәстә идим",
+		"Бакыда һава чох ҝөзәлдир, ахшам дәнизә ҝедәҹәјик",
+		"Сабаһ мәктәбдә имтаһан вар, бүтүн ҝеҹә охудум",
+	},
+	"tr": {
+		"Yarın sabah erkenden işe gitmem gerekiyor",
+		"Bugün İstanbul'da yağmur yağacak, şemsiyeni unutma",
+		"Bu akşam arkadaşlarla maç izlemeye gidiyoruz",
+		"Yeni aldığım kitabı bir haftada bitirdim",
+		"Annemin yaptığı mercimek çorbasının tadı bambaşka",
+	},
+	"ru": {
+		"Мы завтра поедем на море всей семьёй",
+		"Сегодня весь день идёт дождь, сижу дома",
+		"Кто-нибудь знает хороший ресторан в центре города?",
+		"Наконец-то закончил этот проект, можно отдохнуть",
+		"Спасибо всем за поздравления с днём рождения",
+	},
+	"uk": {
+		"Сьогодні дуже гарна погода, підемо гуляти",
+		"Дякую всім, хто прийшов на наш концерт учора",
+		"Шукаю гарну книжку на вихідні, що порадите?",
+		"Нарешті закінчилася зима, чекаю на весну",
+		"Їдемо до бабусі в село на все літо",
+	},
+	"en": {
+		"I can't believe how fast this year went by",
+		"Does anyone have a good recipe for banana bread?",
+		"Just finished my first marathon and my legs are done",
+		"The new update broke everything again, great job",
+		"We're heading to the mountains this weekend",
+	},
+	"de": {
+		"Ich habe heute keine Zeit, vielleicht morgen",
+		"Wir fahren am Wochenende zu meinen Eltern",
+		"Kann mir jemand ein gutes Buch empfehlen?",
+		"Der Zug hatte schon wieder eine Stunde Verspätung",
+		"Endlich Feierabend, jetzt gibt es Pizza",
+	},
+	"fr": {
+		"Je vais au marché ce matin avec ma sœur",
+		"Quelqu'un connaît un bon restaurant près de la gare ?",
+		"On part en vacances à la montagne la semaine prochaine",
+		"Il pleut encore, je reste à la maison aujourd'hui",
+		"Merci beaucoup pour vos messages d'anniversaire",
+	},
+	"es": {
+		"Mañana vamos a la playa con mis amigos",
+		"¿Alguien sabe dónde comprar entradas para el concierto?",
+		"Hoy hace mucho calor, no quiero salir de casa",
+		"Acabo de terminar de leer un libro increíble",
+		"Feliz cumpleaños a mi hermana pequeña",
+	},
+	"it": {
+		"Domani andiamo al mare con gli amici",
+		"Qualcuno conosce una buona pizzeria in centro?",
+		"Oggi piove tutto il giorno, resto a casa",
+		"Finalmente ho finito di scrivere la tesi",
+		"Stasera guardiamo la partita tutti insieme",
+	},
+	"pt": {
+		"Amanhã vamos à praia com os nossos amigos",
+		"Alguém conhece um bom restaurante perto daqui?",
+		"Hoje está chovendo muito, vou ficar em casa",
+		"Acabei de terminar um livro maravilhoso",
+		"Parabéns ao meu irmão pelo novo emprego",
+	},
+	"ar": {
+		"أنا ذاهب إلى السوق مع أخي اليوم",
+		"الطقس جميل جدا هذا الصباح",
+		"هل يعرف أحد مطعما جيدا في وسط المدينة؟",
+		"شكرا لكم جميعا على التهاني",
+		"سنسافر إلى البحر في نهاية الأسبوع",
+	},
+	"fa": {
+		"امروز هوا خیلی خوب است و به پارک می‌رویم",
+		"کسی یک کتاب خوب برای تعطیلات پیشنهاد می‌کند؟",
+		"دیشب با دوستانم به سینما رفتیم",
+		"بالاخره پروژه‌ام تمام شد و می‌توانم استراحت کنم",
+		"از همه برای تبریک تولدم ممنونم",
+	},
+	"ja": {
+		"今日はとても良い天気なので散歩に行きます",
+		"新しいカフェに行ってみたけど、とても美味しかった",
+		"明日は朝早く起きなければならない",
+		"週末は家族と一緒に温泉に行く予定です",
+		"この本を読み終わるのに一週間かかりました",
+	},
+}
+
+func TestDetectHeldOutTexts(t *testing.T) {
+	total, correct := 0, 0
+	for lang, texts := range heldOutTexts {
+		for _, text := range texts {
+			total++
+			result := Detect(text)
+			if result.Lang == lang {
+				correct++
+				continue
+			}
+			t.Errorf("Detect(%q) = %s (%.2f), want %s", text, result.Lang, result.Confidence, lang)
+		}
+	}
+	t.Logf("accuracy: %d/%d", correct, total)
+}
+
+// The texts of close languages are told apart with a high confidence.
+func TestDetectConfidence(t *testing.T) {
+	for _, lang := range []string{"az", "tr", "ru", "uk"} {
+		for _, text := range heldOutTexts[lang] {
+			if result := Detect(text); result.Lang == lang && result.Confidence < 0.5 {
+				t.Errorf("Detect(%q) = %s with confidence %.2f, want at least 0.5", text, result.Lang, result.Confidence)
+			}
+		}
+	}
+}
+
+func TestDetectUndetectableTexts(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{name: "empty", text: ""},
+		{name: "short", text: "Salam!"},
+		{name: "emojis", text: "🎉🎉🎉 🔥🔥"},
+		{name: "link and mention", text: "@someone.bsky.social https://example.com/some/long/path"},
+		{name: "numbers and punctuation", text: "2024-10-18 12:00 !!! ??? 12345678"},
+		{name: "unknown script", text: "오늘 날씨가 정말 좋아서 산책을 갔어요"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := Detect(test.text); result != (Result{}) {
+				t.Errorf("Detect(%q) = %+v, want no language", test.text, result)
+			}
+		})
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	want := []string{"ar", "az", "de", "en", "es", "fa", "fr", "it", "ja", "pt", "ru", "tr", "uk"}
+	if got := Languages(); !slices.Equal(got, want) {
+		t.Errorf("Languages() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+package manage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/api/middleware"
+	atcrypto "github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Dev keys, DID documents and service tokens are for testing the feed generator authentication locally.
+// They are not registered anywhere, so the API has to resolve the DID from the generated DID document.
+
+const (
+	DevKeyTypeK256 = "k256"
+	DevKeyTypeP256 = "p256"
+)
+
+// GenerateDevKey generates a private signing key of the given type, k256 or p256.
+func GenerateDevKey(keyType string) (atcrypto.PrivateKeyExportable, error) {
+	switch keyType {
+	case DevKeyTypeK256:
+		return atcrypto.GeneratePrivateKeyK256()
+	case DevKeyTypeP256:
+		return atcrypto.GeneratePrivateKeyP256()
+	default:
+		return nil, fmt.Errorf("invalid key type %s (expected %s or %s)", keyType, DevKeyTypeK256, DevKeyTypeP256)
+	}
+}
+
+// NewDevDIDDocument returns a DID document with the public key of the private key as the atproto signing key.
+func NewDevDIDDocument(did syntax.DID, handle string, key atcrypto.PrivateKey) (*identity.DIDDocument, error) {
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &identity.DIDDocument{
+		DID: did,
+		VerificationMethod: []identity.DocVerificationMethod{
+			{
+				ID:                 did.String() + "#atproto",
+				Type:               "Multikey",
+				Controller:         did.String(),
+				PublicKeyMultibase: publicKey.Multibase(),
+			},
+		},
+	}
+	if handle != "" {
+		doc.AlsoKnownAs = []string{"at://" + handle}
+	}
+
+	return doc, nil
+}
+
+// MintServiceToken returns a service JWT signed with the private key. The lexicon method is omitted if empty.
+func MintServiceToken(
+	key atcrypto.PrivateKey,
+	issuer string,
+	audience string,
+	lexiconMethod string,
+	expiresIn time.Duration,
+) (string, error) {
+	if issuer == "" {
+		return "", errors.New("issuer is required")
+	}
+	if audience == "" {
+		return "", errors.New("audience is required")
+	}
+
+	var method jwt.SigningMethod
+	switch key.(type) {
+	case *atcrypto.PrivateKeyK256:
+		method = middleware.SigningMethodES256K
+	case *atcrypto.PrivateKeyP256:
+		method = middleware.SigningMethodES256
+	default:
+		return "", middleware.ErrWrongKeyFormat
+	}
+
+	now := time.Now()
+	claims := middleware.ServiceClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		},
+		LexiconMethod: lexiconMethod,
+	}
+
+	return jwt.NewWithClaims(method, claims).SignedString(key)
+}
@@ -0,0 +1,100 @@
+package manage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/api/middleware"
+	"github.com/aykhans/bsky-feedgen/pkg/didresolver"
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/whyrusleeping/go-did"
+)
+
+const (
+	testServiceDID = "did:web:feeds.example.com"
+	testIssuerDID  = "did:plc:devdevdevdevdevdevdevdevd"
+	testMethod     = "app.bsky.feed.getFeedSkeleton"
+)
+
+// TestMintServiceTokenVerifies mints dev service tokens and verifies them with the API middleware in the
+// strict mode, resolving the issuer from the dev DID document.
+func TestMintServiceTokenVerifies(t *testing.T) {
+	tests := []struct {
+		name          string
+		audience      string
+		lexiconMethod string
+		wantCode      int
+	}{
+		{name: "scoped to the method", audience: testServiceDID, lexiconMethod: testMethod, wantCode: 200},
+		{name: "audience with fragment", audience: testServiceDID + "#bsky_fg", lexiconMethod: testMethod, wantCode: 200},
+		{name: "scoped to another method", audience: testServiceDID, lexiconMethod: "app.bsky.feed.getPosts", wantCode: 401},
+		{name: "unscoped", audience: testServiceDID, wantCode: 401},
+		{name: "other audience", audience: "did:web:other.example.com", lexiconMethod: testMethod, wantCode: 401},
+	}
+
+	serviceDID, err := did.ParseDID(testServiceDID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, keyType := range []string{DevKeyTypeK256, DevKeyTypeP256} {
+		key, err := GenerateDevKey(keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := NewDevDIDDocument(syntax.DID(testIssuerDID), "dev.example.com", key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		directory := didresolver.NewLocalDirectory(nil)
+		if err := directory.Insert(doc); err != nil {
+			t.Fatal(err)
+		}
+		auth := middleware.NewAuth(&serviceDID, directory, types.AuthModeStrict, 30*time.Second)
+
+		for _, test := range tests {
+			t.Run(keyType+" "+test.name, func(t *testing.T) {
+				token, err := MintServiceToken(key, testIssuerDID, test.audience, test.lexiconMethod, time.Minute)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var gotDID string
+				handler := auth.JWTAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					gotDID, _ = middleware.GetValue[string](r, middleware.UserDIDKey)
+				}))
+				request := httptest.NewRequest("GET", "/xrpc/"+testMethod, nil)
+				request.Header.Set("Authorization", "Bearer "+token)
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, request)
+
+				if recorder.Code != test.wantCode {
+					t.Fatalf("status = %d, want %d, body: %s", recorder.Code, test.wantCode, recorder.Body.String())
+				}
+				if test.wantCode == 200 && gotDID != testIssuerDID {
+					t.Errorf("user DID = %q, want %q", gotDID, testIssuerDID)
+				}
+			})
+		}
+	}
+}
+
+func TestMintServiceTokenErrors(t *testing.T) {
+	key, err := GenerateDevKey(DevKeyTypeK256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := MintServiceToken(key, "", testServiceDID, testMethod, time.Minute); err == nil {
+		t.Error("MintServiceToken without issuer succeeded")
+	}
+	if _, err := MintServiceToken(key, testIssuerDID, "", testMethod, time.Minute); err == nil {
+		t.Error("MintServiceToken without audience succeeded")
+	}
+	if _, err := GenerateDevKey("ed25519"); err == nil {
+		t.Error("GenerateDevKey(ed25519) succeeded")
+	}
+}
@@ -0,0 +1,58 @@
+package ranking
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	"github.com/aykhans/bsky-feedgen/pkg/types"
+)
+
+// Candidate is a post of a feed that is ranked.
+type Candidate struct {
+	PostID     string
+	DID        string
+	RecordKey  string
+	CreatedAt  time.Time
+	Reply      bool
+	Engagement *collections.Engagement // Nil if the post has no engagement yet
+	Score      float64
+}
+
+// Ranker scores the candidates of a feed.
+type Ranker interface {
+	Score(candidates []*Candidate, now time.Time)
+}
+
+// New returns the ranker of the configured algorithm.
+// Chronological (latest) feeds are served from their own collection and have no ranker.
+func New(rankingConfig *config.FeedRankingConfig) (Ranker, error) {
+	switch rankingConfig.Algorithm {
+	case types.FeedRankingHot:
+		return &HotRanker{
+			Gravity:         rankingConfig.Gravity,
+			AuthorPenalty:   rankingConfig.AuthorPenalty,
+			ReplyPenalty:    rankingConfig.ReplyPenalty,
+			ReplyHeavyRatio: rankingConfig.ReplyHeavyRatio,
+			VelocityWindow:  rankingConfig.VelocityWindow,
+		}, nil
+	default:
+		return nil, fmt.Errorf("ranking algorithm %s can't be materialized", rankingConfig.Algorithm)
+	}
+}
+
+// sortByScore sorts the candidates by descending score, newer posts first on ties.
+func sortByScore(candidates []*Candidate) {
+	slices.SortStableFunc(candidates, func(a, b *Candidate) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		default:
+			return b.CreatedAt.Compare(a.CreatedAt)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package ranking
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+)
+
+// Weights of the engagement kinds in the hot score.
+const (
+	hotLikeWeight   = 1.0
+	hotRepostWeight = 2.0
+	hotReplyWeight  = 3.0
+)
+
+// HotRanker scores posts by their engagement with a gravity style time decay:
+//
+//	score = (1 + engagement + recent engagement) / (age in hours + 2) ^ Gravity
+//
+// Engagement within VelocityWindow is counted twice, so posts gaining engagement quickly rise
+// above older posts with the same total. Every further post of the same author is multiplied
+// by AuthorPenalty once more, so a single author can't fill the top of the feed. The posts of
+// authors with at least ReplyHeavyRatio of their ranked posts being replies are multiplied by
+// ReplyPenalty.
+type HotRanker struct {
+	Gravity         float64
+	AuthorPenalty   float64
+	ReplyPenalty    float64
+	ReplyHeavyRatio float64
+	VelocityWindow  time.Duration
+}
+
+func (r HotRanker) Score(candidates []*Candidate, now time.Time) {
+	velocityStart := collections.EngagementBucket(now.Add(-r.VelocityWindow))
+
+	for _, candidate := range candidates {
+		points := 1.0
+		if candidate.Engagement != nil {
+			points += weightEngagement(candidate.Engagement.EngagementCounts)
+			for key, counts := range candidate.Engagement.Buckets {
+				bucketUnix, err := strconv.ParseInt(key, 10, 64)
+				if err != nil || counts == nil || time.Unix(bucketUnix, 0).Before(velocityStart) {
+					continue
+				}
+				points += weightEngagement(*counts)
+			}
+		}
+
+		ageHours := max(now.Sub(candidate.CreatedAt).Hours(), 0)
+		candidate.Score = points / math.Pow(ageHours+2, r.Gravity)
+	}
+
+	if r.ReplyPenalty < 1 {
+		authorPosts := make(map[string]int)
+		authorReplies := make(map[string]int)
+		for _, candidate := range candidates {
+			authorPosts[candidate.DID]++
+			if candidate.Reply {
+				authorReplies[candidate.DID]++
+			}
+		}
+		for _, candidate := range candidates {
+			if float64(authorReplies[candidate.DID]) >= r.ReplyHeavyRatio*float64(authorPosts[candidate.DID]) {
+				candidate.Score *= r.ReplyPenalty
+			}
+		}
+	}
+
+	if r.AuthorPenalty >= 1 {
+		return
+	}
+
+	// Penalize in order of the raw score, so the best post of every author keeps its score
+	sortByScore(candidates)
+	authorPosts := make(map[string]int)
+	for _, candidate := range candidates {
+		candidate.Score *= math.Pow(r.AuthorPenalty, float64(authorPosts[candidate.DID]))
+		authorPosts[candidate.DID]++
+	}
+}
+
+func weightEngagement(counts collections.EngagementCounts) float64 {
+	return hotLikeWeight*float64(max(counts.Likes, 0)) +
+		hotRepostWeight*float64(max(counts.Reposts, 0)) +
+		hotReplyWeight*float64(max(counts.Replies, 0))
+}
@@ -0,0 +1,99 @@
+package ranking
+
+import (
+	"context"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+)
+
+// Materializer computes the ranking of a feed and stores it in the feed_ranked collection,
+// so serving a page of the feed is a single indexed read.
+type Materializer struct {
+	feedName             string
+	feedCollection       *collections.FeedCollection
+	engagementCollection *collections.EngagementCollection
+	feedRankedCollection *collections.FeedRankedCollection
+	ranker               Ranker
+	window               time.Duration
+	maxItems             int64
+}
+
+func NewMaterializer(
+	feedName string,
+	feedCollection *collections.FeedCollection,
+	engagementCollection *collections.EngagementCollection,
+	feedRankedCollection *collections.FeedRankedCollection,
+	ranker Ranker,
+	window time.Duration,
+	maxItems int64,
+) *Materializer {
+	return &Materializer{
+		feedName:             feedName,
+		feedCollection:       feedCollection,
+		engagementCollection: engagementCollection,
+		feedRankedCollection: feedRankedCollection,
+		ranker:               ranker,
+		window:               window,
+		maxItems:             maxItems,
+	}
+}
+
+// Run ranks the feed's posts created within the window and replaces the stored ranking.
+// It returns the number of ranked posts.
+func (m *Materializer) Run(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+
+	feedItems, err := m.feedCollection.GetCreatedAfter(ctx, now.Add(-m.window))
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]string, len(feedItems))
+	for i, feedItem := range feedItems {
+		ids[i] = feedItem.ID
+	}
+	engagements, err := m.engagementCollection.GetByIDs(ctx, ids...)
+	if err != nil {
+		return 0, err
+	}
+
+	candidates := make([]*Candidate, len(feedItems))
+	for i, feedItem := range feedItems {
+		candidates[i] = &Candidate{
+			PostID:     feedItem.ID,
+			DID:        feedItem.DID,
+			RecordKey:  feedItem.RecordKey,
+			CreatedAt:  feedItem.CreatedAt,
+			Reply:      feedItem.Reply,
+			Engagement: engagements[feedItem.ID],
+		}
+	}
+
+	m.ranker.Score(candidates, now)
+	sortByScore(candidates)
+	if int64(len(candidates)) > m.maxItems {
+		candidates = candidates[:m.maxItems]
+	}
+
+	items := make([]*collections.FeedRanked, len(candidates))
+	for i, candidate := range candidates {
+		items[i] = &collections.FeedRanked{
+			ID:          m.feedName + "/" + candidate.PostID,
+			Feed:        m.feedName,
+			PostID:      candidate.PostID,
+			DID:         candidate.DID,
+			RecordKey:   candidate.RecordKey,
+			CreatedAt:   candidate.CreatedAt,
+			Score:       candidate.Score,
+			Rank:        int64(i),
+			GeneratedAt: now,
+		}
+	}
+
+	if err := m.feedRankedCollection.Replace(ctx, m.feedName, now, items...); err != nil {
+		return 0, err
+	}
+
+	return len(items), nil
+}
@@ -0,0 +1,62 @@
+package rules
+
+// FeedDefinition is the declarative definition of the posts a feed selects.
+// A post is evaluated in this order:
+//  1. Posts rejected by ReplyPolicy are skipped.
+//  2. Posts of authors in Authors.Allow are selected, posts of authors in Authors.Deny are skipped.
+//  3. Every other post is selected if it matches Match.
+type FeedDefinition struct {
+	Name        string      `json:"name"`
+	ReplyPolicy ReplyPolicy `json:"reply_policy,omitempty"`
+	Authors     Authors     `json:"authors"`
+	Match       *Condition  `json:"match"`
+}
+
+type Authors struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+type ReplyPolicy string
+
+const (
+	// ReplyPolicyAny accepts top-level posts and replies at any depth.
+	ReplyPolicyAny ReplyPolicy = "any"
+	// ReplyPolicyNone accepts only top-level posts.
+	ReplyPolicyNone ReplyPolicy = "none"
+	// ReplyPolicyRoot accepts top-level posts and direct replies to them.
+	ReplyPolicyRoot ReplyPolicy = "root"
+)
+
+// Condition matches a post if all of its non-empty fields match.
+// An empty condition matches every post.
+type Condition struct {
+	// Combinators
+	All []*Condition `json:"all,omitempty"`
+	Any []*Condition `json:"any,omitempty"`
+	Not *Condition   `json:"not,omitempty"`
+
+	// LangsAny matches if any of the post's languages is in the list.
+	LangsAny []string `json:"langs_any,omitempty"`
+	// LangsMax matches if the post has at most this many languages.
+	LangsMax *int `json:"langs_max,omitempty"`
+	// DetectedLangsAny matches if the language detected from the post text is in the list.
+	// Posts with too short texts have no detected language and never match.
+	DetectedLangsAny []string `json:"detected_langs_any,omitempty"`
+	// DetectedLangConfidenceMin matches if the confidence of the detected language is at least this value (0-1).
+	DetectedLangConfidenceMin *float64 `json:"detected_lang_confidence_min,omitempty"`
+	// TextRegex matches the post text against a RE2 regular expression.
+	TextRegex string `json:"text_regex,omitempty"`
+	// KeywordsAny matches if a word of the post text starts with any of the keywords, so inflected forms
+	// like "Azərbaycanda" match the keyword "azerbaycan". The text and the keywords are compared in the
+	// form returned by textnorm.Normalize, which also matches other spellings and scripts of a keyword.
+	KeywordsAny []string `json:"keywords_any,omitempty"`
+	// NormalizedTextRegex matches the post text in the form returned by textnorm.Normalize against a
+	// RE2 regular expression. The normalized text is lowercase ASCII for Latin and Cyrillic texts.
+	NormalizedTextRegex string `json:"normalized_text_regex,omitempty"`
+	// HashtagsAny matches if any of the post's hashtags is in the list.
+	// Hashtags are compared case-insensitively and without the leading '#'.
+	HashtagsAny []string `json:"hashtags_any,omitempty"`
+	// HasMedia matches posts with (true) or without (false) images or video.
+	HasMedia *bool `json:"has_media,omitempty"`
+}
@@ -0,0 +1,488 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/aykhans/bsky-feedgen/pkg/generator"
+	"github.com/aykhans/bsky-feedgen/pkg/langid"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+	"github.com/aykhans/bsky-feedgen/pkg/textnorm"
+)
+
+// Feed is a compiled FeedDefinition.
+type Feed struct {
+	Name        string
+	Users       generator.Users
+	replyPolicy ReplyPolicy
+	match       matcher
+}
+
+// matcher reports whether the post matches. The evaluated rules are added to t, unless it is nil.
+type matcher func(post *collections.Post, t *tracer) bool
+
+// Load reads and compiles the feed definition at path.
+func Load(path string) (*Feed, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed definition: %w", err)
+	}
+
+	return Parse(data)
+}
+
+// Parse compiles a JSON feed definition. Unknown fields are rejected, so typos don't silently widen a feed.
+func Parse(data []byte) (*Feed, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var definition FeedDefinition
+	if err := decoder.Decode(&definition); err != nil {
+		return nil, fmt.Errorf("failed to parse feed definition: %w", err)
+	}
+
+	return Compile(&definition)
+}
+
+func Compile(definition *FeedDefinition) (*Feed, error) {
+	if definition.Name == "" {
+		return nil, errors.New("feed definition has no name")
+	}
+
+	replyPolicy := definition.ReplyPolicy
+	switch replyPolicy {
+	case "":
+		replyPolicy = ReplyPolicyAny
+	case ReplyPolicyAny, ReplyPolicyNone, ReplyPolicyRoot:
+	default:
+		return nil, fmt.Errorf("feed %s: invalid reply_policy: %s", definition.Name, replyPolicy)
+	}
+
+	users := make(generator.Users)
+	for _, did := range definition.Authors.Deny {
+		users[did] = false
+	}
+	for _, did := range definition.Authors.Allow {
+		if _, ok := users[did]; ok {
+			return nil, fmt.Errorf("feed %s: author %s is both allowed and denied", definition.Name, did)
+		}
+		users[did] = true
+	}
+
+	if definition.Match == nil {
+		return nil, fmt.Errorf("feed %s: match is required", definition.Name)
+	}
+	match, err := compileCondition(definition.Match, "match")
+	if err != nil {
+		return nil, fmt.Errorf("feed %s: %w", definition.Name, err)
+	}
+
+	return &Feed{
+		Name:        definition.Name,
+		Users:       users,
+		replyPolicy: replyPolicy,
+		match:       match,
+	}, nil
+}
+
+// Match reports whether the feed selects the post.
+func (f *Feed) Match(post *collections.Post) bool {
+	return f.MatchUsers(post, f.Users)
+}
+
+// MatchUsers is like Match, but uses the given author lists instead of the ones of the definition.
+func (f *Feed) MatchUsers(post *collections.Post, users generator.Users) bool {
+	return f.evaluate(post, users, nil)
+}
+
+// ExplainUsers is like MatchUsers, but returns the trace of every evaluated rule.
+func (f *Feed) ExplainUsers(post *collections.Post, users generator.Users) *generator.Explanation {
+	t := &tracer{}
+	selected := f.evaluate(post, users, t)
+
+	return &generator.Explanation{Selected: selected, Steps: t.steps}
+}
+
+func (f *Feed) evaluate(post *collections.Post, users generator.Users, t *tracer) bool {
+	acceptsReply, replyDetail := f.acceptsReply(post)
+	if t != nil {
+		t.add("reply_policy", acceptsReply, "%s: %s", f.replyPolicy, replyDetail)
+	}
+	if !acceptsReply {
+		return false
+	}
+
+	if isValidUser := users.IsValid(post.DID); isValidUser != nil {
+		if t != nil {
+			if *isValidUser {
+				t.add("authors", true, "author %s is allowed, the post is selected without the match rules", post.DID)
+			} else {
+				t.add("authors", false, "author %s is denied", post.DID)
+			}
+		}
+		return *isValidUser
+	}
+	if t != nil {
+		t.add("authors", true, "author %s is not listed", post.DID)
+	}
+
+	return f.match(post, t)
+}
+
+// acceptsReply reports whether the reply policy accepts the post, with the reason.
+func (f *Feed) acceptsReply(post *collections.Post) (bool, string) {
+	reply, isTopLevel := post.Reply, !post.IsReply()
+
+	switch f.replyPolicy {
+	case ReplyPolicyNone:
+		if !isTopLevel {
+			return false, "replies are not accepted"
+		}
+	case ReplyPolicyRoot:
+		if reply != nil && reply.RootURI != reply.ParentURI {
+			return false, "reply to a reply, only direct replies to top-level posts are accepted"
+		}
+		if !isTopLevel {
+			return true, "direct reply to a top-level post"
+		}
+	default:
+		if !isTopLevel {
+			return true, "reply"
+		}
+	}
+
+	return true, "top-level post"
+}
+
+// tracer collects the evaluated rules of an explanation. Matchers get a nil tracer when the post is only
+// matched, so they check for nil before formatting details.
+type tracer struct {
+	steps []*generator.ExplanationStep
+}
+
+func (t *tracer) add(rule string, passed bool, format string, args ...any) {
+	t.steps = append(t.steps, &generator.ExplanationStep{Rule: rule, Passed: passed, Detail: fmt.Sprintf(format, args...)})
+}
+
+// reserve adds an empty step, so a combinator's step precedes the steps of its conditions.
+func (t *tracer) reserve(rule string) *generator.ExplanationStep {
+	step := &generator.ExplanationStep{Rule: rule}
+	t.steps = append(t.steps, step)
+	return step
+}
+
+func compileCondition(condition *Condition, path string) (matcher, error) {
+	if condition == nil {
+		return nil, fmt.Errorf("%s: empty condition", path)
+	}
+
+	var matchers []matcher
+
+	for _, list := range []struct {
+		name       string
+		conditions []*Condition
+	}{{"all", condition.All}, {"any", condition.Any}} {
+		if list.conditions == nil {
+			continue
+		}
+		if len(list.conditions) == 0 {
+			return nil, fmt.Errorf("%s.%s: at least one condition is required", path, list.name)
+		}
+
+		children := make([]matcher, len(list.conditions))
+		for i, child := range list.conditions {
+			var err error
+			children[i], err = compileCondition(child, fmt.Sprintf("%s.%s[%d]", path, list.name, i))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		rule := path + "." + list.name
+		if list.name == "all" {
+			matchers = append(matchers, func(post *collections.Post, t *tracer) bool {
+				if t != nil {
+					return traceChildren(post, t, rule, children, len(children))
+				}
+				for _, child := range children {
+					if !child(post, nil) {
+						return false
+					}
+				}
+				return true
+			})
+		} else {
+			matchers = append(matchers, func(post *collections.Post, t *tracer) bool {
+				if t != nil {
+					return traceChildren(post, t, rule, children, 1)
+				}
+				for _, child := range children {
+					if child(post, nil) {
+						return true
+					}
+				}
+				return false
+			})
+		}
+	}
+
+	if condition.Not != nil {
+		child, err := compileCondition(condition.Not, path+".not")
+		if err != nil {
+			return nil, err
+		}
+		rule := path + ".not"
+		matchers = append(matchers, func(post *collections.Post, t *tracer) bool {
+			if t == nil {
+				return !child(post, nil)
+			}
+			step := t.reserve(rule)
+			childTracer := &tracer{}
+			step.Passed = !child(post, childTracer)
+			step.Detail = "the condition doesn't match"
+			if !step.Passed {
+				step.Detail = "the condition matches"
+			}
+			// A condition with several fields has a step with the same rule, which is merged into this one
+			if len(childTracer.steps) > 0 && childTracer.steps[0].Rule == rule {
+				step.Detail += " (" + childTracer.steps[0].Detail + ")"
+				childTracer.steps = childTracer.steps[1:]
+			}
+			t.steps = append(t.steps, childTracer.steps...)
+			return step.Passed
+		})
+	}
+
+	if len(condition.LangsAny) > 0 {
+		langs := make(generator.Langs, len(condition.LangsAny))
+		for _, lang := range condition.LangsAny {
+			langs[lang] = true
+		}
+		rule, langsAny := path+".langs_any", condition.LangsAny
+		matchers = append(matchers, func(post *collections.Post, t *tracer) bool {
+			matched := langs.IsExistsAny(post.Langs)
+			if t != nil {
+				t.add(rule, matched, "post languages %v, expected any of %v", post.Langs, langsAny)
+			}
+			return matched
+		})
+	}
+
+	if condition.LangsMax != nil {
+		langsMax := *condition.LangsMax
+		rule := path + ".langs_max"
+		matchers = append(matchers, func(post *collections.Post, t *tracer) bool {
+			matched := len(post.Langs) <= langsMax
+			if t != nil {
+				t.add(rule, matched, "post has %d language(s), expected at most %d", len(post.Langs), langsMax)
+			}
+			return matched
+		})
+	}
+
+	if len(condition.DetectedLangsAny) > 0 {
+		knownLangs := langid.Languages()
+		langs := make(map[string]bool, len(condition.DetectedLangsAny))
+		for _, lang := range condition.DetectedLangsAny {
+			if !slices.Contains(knownLangs, lang) {
+				return nil, fmt.Errorf("%s.detected_langs_any: language %s can't be detected", path, lang)
+			}
+			langs[lang] = true
+		}
+		rule, detectedLangsAny := path+".detected_langs_any", condition.DetectedLangsAny
+		matchers = append(matchers, func(post *collections.Post, t *tracer) bool {
+			matched := langs[post.DetectedLang]
+			if t != nil {
+				t.add(rule, matched, "detected language %s, expected any of %v", detectedLangDetail(post), detectedLangsAny)
+			}
+			return matched
+		})
+	}
+
+	if condition.DetectedLangConfidenceMin != nil {
+		confidenceMin := *condition.DetectedLangConfidenceMin
+		if confidenceMin < 0 || confidenceMin > 1 {
+			return nil, fmt.Errorf("%s.detected_lang_confidence_min: must be between 0 and 1", path)
+		}
+		rule := path + ".detected_lang_confidence_min"
+		matchers = append(matchers, func(post *collections.Post, t *tracer) bool {
+			matched := post.DetectedLang != "" && post.DetectedLangConfidence >= confidenceMin
+			if t != nil {
+				t.add(rule, matched, "detected language %s, expected confidence at least %.2f", detectedLangDetail(post), confidenceMin)
+			}
+			return matched
+		})
+	}
+
+	if condition.TextRegex != "" {
+		textRegex, err := regexp.Compile(condition.TextRegex)
+		if err != nil {
+			return nil, fmt.Errorf("%s.text_regex: %w", path, err)
+		}
+		rule := path + ".text_regex"
+		matchers = append(matchers, func(post *collections.Post, t *tracer) bool {
+			if t == nil {
+				return textRegex.MatchString(post.Text)
+			}
+			if location := textRegex.FindStringIndex(post.Text); location != nil {
+				t.add(rule, true, "text matches %q at %q", textRegex.String(), post.Text[location[0]:location[1]])
+				return true
+			}
+			t.add(rule, false, "text doesn't match %q", textRegex.String())
+			return false
+		})
+	}
+
+	if len(condition.KeywordsAny) > 0 {
+		keywords := make([]string, len(condition.KeywordsAny))
+		for i, keyword := range condition.KeywordsAny {
+			keywords[i] = textnorm.Normalize(keyword)
+			if keywords[i] == "" || strings.IndexFunc(keywords[i], isNotLetter) >= 0 {
+				return nil, fmt.Errorf("%s.keywords_any: keyword %q must be a single word", path, keyword)
+			}
+		}
+		rule := path + ".keywords_any"
+		matchers = append(matchers, func(post *collections.Post, t *tracer) bool {
+			for _, word := range strings.FieldsFunc(textnorm.Normalize(post.Text), isNotLetter) {
+				for _, keyword := range keywords {
+					if strings.HasPrefix(word, keyword) {
+						if t != nil {
+							t.add(rule, true, "normalized word %q starts with keyword %q", word, keyword)
+						}
+						return true
+					}
+				}
+			}
+			if t != nil {
+				t.add(rule, false, "no normalized word starts with any of %v", keywords)
+			}
+			return false
+		})
+	}
+
+	if condition.NormalizedTextRegex != "" {
+		textRegex, err := regexp.Compile(condition.NormalizedTextRegex)
+		if err != nil {
+			return nil, fmt.Errorf("%s.normalized_text_regex: %w", path, err)
+		}
+		rule := path + ".normalized_text_regex"
+		matchers = append(matchers, func(post *collections.Post, t *tracer) bool {
+			normalizedText := textnorm.Normalize(post.Text)
+			if t == nil {
+				return textRegex.MatchString(normalizedText)
+			}
+			if location := textRegex.FindStringIndex(normalizedText); location != nil {
+				t.add(rule, true, "normalized text matches %q at %q", textRegex.String(), normalizedText[location[0]:location[1]])
+				return true
+			}
+			t.add(rule, false, "normalized text doesn't match %q", textRegex.String())
+			return false
+		})
+	}
+
+	if len(condition.HashtagsAny) > 0 {
+		hashtags := make(map[string]bool, len(condition.HashtagsAny))
+		for _, hashtag := range condition.HashtagsAny {
+			hashtags[normalizeHashtag(hashtag)] = true
+		}
+		rule, hashtagsAny := path+".hashtags_any", condition.HashtagsAny
+		matchers = append(matchers, func(post *collections.Post, t *tracer) bool {
+			matched := false
+			for _, hashtag := range postHashtags(post) {
+				if hashtags[normalizeHashtag(hashtag)] {
+					matched = true
+					break
+				}
+			}
+			if t != nil {
+				t.add(rule, matched, "post hashtags %v, expected any of %v", postHashtags(post), hashtagsAny)
+			}
+			return matched
+		})
+	}
+
+	if condition.HasMedia != nil {
+		hasMedia := *condition.HasMedia
+		rule := path + ".has_media"
+		matchers = append(matchers, func(post *collections.Post, t *tracer) bool {
+			postHasMedia := post.Embed.HasMedia()
+			if t != nil {
+				t.add(rule, postHasMedia == hasMedia, "post has media: %t, expected %t", postHasMedia, hasMedia)
+			}
+			return postHasMedia == hasMedia
+		})
+	}
+
+	switch len(matchers) {
+	case 0:
+		return func(post *collections.Post, t *tracer) bool {
+			if t != nil {
+				t.add(path, true, "empty condition")
+			}
+			return true
+		}, nil
+	case 1:
+		return matchers[0], nil
+	default:
+		return func(post *collections.Post, t *tracer) bool {
+			if t != nil {
+				return traceChildren(post, t, path, matchers, len(matchers))
+			}
+			for _, m := range matchers {
+				if !m(post, nil) {
+					return false
+				}
+			}
+			return true
+		}, nil
+	}
+}
+
+// traceChildren evaluates all children, unlike matching that stops at the deciding child, so the explanation
+// shows every condition. The combinator passes if at least required children match.
+func traceChildren(post *collections.Post, t *tracer, rule string, children []matcher, required int) bool {
+	step := t.reserve(rule)
+
+	matchedCount := 0
+	for _, child := range children {
+		if child(post, t) {
+			matchedCount++
+		}
+	}
+
+	step.Passed = matchedCount >= required
+	step.Detail = fmt.Sprintf("%d of %d conditions match", matchedCount, len(children))
+	return step.Passed
+}
+
+func detectedLangDetail(post *collections.Post) string {
+	if post.DetectedLang == "" {
+		return "none"
+	}
+
+	return fmt.Sprintf("%s (confidence %.2f)", post.DetectedLang, post.DetectedLangConfidence)
+}
+
+// postHashtags returns the self-labeled tags and the inline #hashtags of the post.
+func postHashtags(post *collections.Post) []string {
+	if post.Facets == nil {
+		return post.Tags
+	}
+
+	return append(post.Tags[:len(post.Tags):len(post.Tags)], post.Facets.Tags...)
+}
+
+func isNotLetter(r rune) bool {
+	return !unicode.IsLetter(r)
+}
+
+func normalizeHashtag(hashtag string) string {
+	return strings.ToLower(strings.TrimPrefix(hashtag, "#"))
+}
@@ -0,0 +1,306 @@
+package rules
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aykhans/bsky-feedgen/pkg/generator"
+	"github.com/aykhans/bsky-feedgen/pkg/storage/mongodb/collections"
+)
+
+const testAuthor = "did:plc:author"
+
+// parseMatch compiles a feed definition with the given match condition.
+func parseMatch(t *testing.T, match string) *Feed {
+	t.Helper()
+
+	feed, err := Parse([]byte(`{"name": "test", "match": ` + match + `}`))
+	if err != nil {
+		t.Fatalf("Parse(%s): %v", match, err)
+	}
+	return feed
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition string
+		wantError  string
+	}{
+		{name: "unknown field", definition: `{"name": "test", "match": {}, "replies": "none"}`, wantError: `unknown field "replies"`},
+		{name: "unknown condition field", definition: `{"name": "test", "match": {"keyword_any": ["baku"]}}`, wantError: `unknown field "keyword_any"`},
+		{name: "wrong field type", definition: `{"name": "test", "match": {"langs_max": "2"}}`, wantError: "failed to parse"},
+		{name: "without name", definition: `{"match": {}}`, wantError: "no name"},
+		{name: "without match", definition: `{"name": "test"}`, wantError: "match is required"},
+		{name: "invalid reply policy", definition: `{"name": "test", "reply_policy": "replies", "match": {}}`, wantError: "invalid reply_policy: replies"},
+		{
+			name:       "allowed and denied author",
+			definition: `{"name": "test", "authors": {"allow": ["did:plc:a"], "deny": ["did:plc:a"]}, "match": {}}`,
+			wantError:  "author did:plc:a is both allowed and denied",
+		},
+		{name: "empty all", definition: `{"name": "test", "match": {"all": []}}`, wantError: "match.all: at least one condition is required"},
+		{name: "nested empty any", definition: `{"name": "test", "match": {"not": {"any": []}}}`, wantError: "match.not.any: at least one condition"},
+		{name: "null condition", definition: `{"name": "test", "match": {"all": [{}, null]}}`, wantError: "match.all[1]: empty condition"},
+		{name: "unknown detected language", definition: `{"name": "test", "match": {"detected_langs_any": ["az", "xx"]}}`, wantError: "language xx can't be detected"},
+		{name: "confidence above 1", definition: `{"name": "test", "match": {"detected_lang_confidence_min": 1.5}}`, wantError: "must be between 0 and 1"},
+		{name: "negative confidence", definition: `{"name": "test", "match": {"detected_lang_confidence_min": -0.1}}`, wantError: "must be between 0 and 1"},
+		{name: "multi-word keyword", definition: `{"name": "test", "match": {"keywords_any": ["baki", "qarabağ atları"]}}`, wantError: `keyword "qarabağ atları" must be a single word`},
+		{name: "keyword with digits", definition: `{"name": "test", "match": {"keywords_any": ["baku2025"]}}`, wantError: "must be a single word"},
+		{name: "empty keyword", definition: `{"name": "test", "match": {"keywords_any": [""]}}`, wantError: "must be a single word"},
+		{name: "invalid text regex", definition: `{"name": "test", "match": {"text_regex": "(baku"}}`, wantError: "match.text_regex"},
+		{name: "invalid normalized text regex", definition: `{"name": "test", "match": {"any": [{"normalized_text_regex": "[a-"}]}}`, wantError: "match.any[0].normalized_text_regex"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse([]byte(test.definition))
+			if err == nil || !strings.Contains(err.Error(), test.wantError) {
+				t.Errorf("Parse error = %v, want an error containing %q", err, test.wantError)
+			}
+		})
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	feed, err := Parse([]byte(`{"name": "test", "authors": {"allow": ["did:plc:a"], "deny": ["did:plc:b"]}, "match": {}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Name != "test" || feed.replyPolicy != ReplyPolicyAny {
+		t.Errorf("name, reply policy = %s, %s, want test, any", feed.Name, feed.replyPolicy)
+	}
+	if !feed.Users["did:plc:a"] || feed.Users["did:plc:b"] || len(feed.Users) != 2 {
+		t.Errorf("users = %v, want did:plc:a allowed and did:plc:b denied", feed.Users)
+	}
+}
+
+func TestMatchConditions(t *testing.T) {
+	tests := []struct {
+		name  string
+		match string
+		post  collections.Post
+		want  bool
+	}{
+		{name: "empty condition", match: `{}`, post: collections.Post{}, want: true},
+
+		{name: "langs_any", match: `{"langs_any": ["az"]}`, post: collections.Post{Langs: []string{"en", "az"}}, want: true},
+		{name: "langs_any other language", match: `{"langs_any": ["az"]}`, post: collections.Post{Langs: []string{"tr"}}, want: false},
+		{name: "langs_any without languages", match: `{"langs_any": ["az"]}`, post: collections.Post{}, want: false},
+
+		{name: "langs_max", match: `{"langs_max": 2}`, post: collections.Post{Langs: []string{"az", "en"}}, want: true},
+		{name: "langs_max exceeded", match: `{"langs_max": 2}`, post: collections.Post{Langs: []string{"az", "en", "tr"}}, want: false},
+		{name: "langs_max 0", match: `{"langs_max": 0}`, post: collections.Post{}, want: true},
+
+		{name: "detected_langs_any", match: `{"detected_langs_any": ["az"]}`, post: collections.Post{DetectedLang: "az"}, want: true},
+		{name: "detected_langs_any other language", match: `{"detected_langs_any": ["az"]}`, post: collections.Post{DetectedLang: "tr"}, want: false},
+		{name: "detected_langs_any not detected", match: `{"detected_langs_any": ["az"]}`, post: collections.Post{}, want: false},
+
+		{name: "confidence", match: `{"detected_lang_confidence_min": 0.8}`, post: collections.Post{DetectedLang: "az", DetectedLangConfidence: 0.8}, want: true},
+		{name: "low confidence", match: `{"detected_lang_confidence_min": 0.8}`, post: collections.Post{DetectedLang: "az", DetectedLangConfidence: 0.6}, want: false},
+		{name: "confidence 0 not detected", match: `{"detected_lang_confidence_min": 0}`, post: collections.Post{}, want: false},
+
+		{name: "text_regex", match: `{"text_regex": "(?i)bak[ıu]"}`, post: collections.Post{Text: "Salam BAKU!"}, want: true},
+		{name: "text_regex without normalization", match: `{"text_regex": "baki"}`, post: collections.Post{Text: "Bakı"}, want: false},
+
+		{name: "keyword", match: `{"keywords_any": ["Azərbaycan"]}`, post: collections.Post{Text: "Azerbaycan"}, want: true},
+		{name: "keyword inflection", match: `{"keywords_any": ["azerbaycan"]}`, post: collections.Post{Text: "Azərbaycanda bu gün"}, want: true},
+		{name: "keyword in another script", match: `{"keywords_any": ["azerbaydjan"]}`, post: collections.Post{Text: "Новости Азербайджана"}, want: true},
+		{name: "keyword in a hashtag", match: `{"keywords_any": ["baki"]}`, post: collections.Post{Text: "#Bakı2025"}, want: true},
+		{name: "keyword inside a word", match: `{"keywords_any": ["azerbaijan"]}`, post: collections.Post{Text: "ProAzerbaijan"}, want: false},
+		{name: "keyword not found", match: `{"keywords_any": ["baki", "gence"]}`, post: collections.Post{Text: "Istanbul"}, want: false},
+
+		{name: "normalized_text_regex", match: `{"normalized_text_regex": "azerbaijan"}`, post: collections.Post{Text: "#VisitAzerbaijan2025"}, want: true},
+		{name: "normalized_text_regex folds letters", match: `{"normalized_text_regex": "^baki seheri$"}`, post: collections.Post{Text: "BAKI ŞƏHƏRİ"}, want: true},
+
+		{name: "hashtag from tags", match: `{"hashtags_any": ["#AzPulse"]}`, post: collections.Post{Tags: []string{"azpulse"}}, want: true},
+		{name: "hashtag from facets", match: `{"hashtags_any": ["baku"]}`, post: collections.Post{Facets: &collections.Facets{Tags: []string{"Baku"}}}, want: true},
+		{name: "other hashtag", match: `{"hashtags_any": ["baku"]}`, post: collections.Post{Tags: []string{"istanbul"}, Facets: &collections.Facets{Tags: []string{"ankara"}}}, want: false},
+
+		{name: "has_media", match: `{"has_media": true}`, post: collections.Post{Embed: &collections.Embed{MediaType: collections.EmbedMediaTypeVideo}}, want: true},
+		{name: "has_media without embed", match: `{"has_media": true}`, post: collections.Post{}, want: false},
+		{name: "has_media false", match: `{"has_media": false}`, post: collections.Post{Embed: &collections.Embed{QuoteURI: "at://did:plc:a/app.bsky.feed.post/1"}}, want: true},
+
+		{name: "all fields of a condition", match: `{"langs_any": ["az"], "has_media": true}`, post: collections.Post{Langs: []string{"az"}}, want: false},
+		{name: "all", match: `{"all": [{"langs_any": ["az"]}, {"langs_max": 1}]}`, post: collections.Post{Langs: []string{"az"}}, want: true},
+		{name: "all failing", match: `{"all": [{"langs_any": ["az"]}, {"langs_max": 1}]}`, post: collections.Post{Langs: []string{"az", "en"}}, want: false},
+		{name: "any", match: `{"any": [{"langs_any": ["az"]}, {"hashtags_any": ["baku"]}]}`, post: collections.Post{Tags: []string{"baku"}}, want: true},
+		{name: "any failing", match: `{"any": [{"langs_any": ["az"]}, {"hashtags_any": ["baku"]}]}`, post: collections.Post{}, want: false},
+		{name: "not", match: `{"not": {"detected_langs_any": ["tr"]}}`, post: collections.Post{DetectedLang: "az"}, want: true},
+		{name: "not failing", match: `{"not": {"detected_langs_any": ["tr"]}}`, post: collections.Post{DetectedLang: "tr"}, want: false},
+		{name: "not with a field", match: `{"langs_any": ["az"], "not": {"hashtags_any": ["spam"]}}`, post: collections.Post{Langs: []string{"az"}, Tags: []string{"spam"}}, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			feed := parseMatch(t, test.match)
+			test.post.DID = testAuthor
+			if got := feed.Match(&test.post); got != test.want {
+				t.Errorf("Match = %v, want %v", got, test.want)
+			}
+			// Explanations decide like matching
+			if got := feed.ExplainUsers(&test.post, feed.Users).Selected; got != test.want {
+				t.Errorf("ExplainUsers selected = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchReplyPolicyAndAuthors(t *testing.T) {
+	const rootURI, replyURI = "at://did:plc:a/app.bsky.feed.post/root", "at://did:plc:b/app.bsky.feed.post/reply"
+	topLevel := collections.Post{Reply: &collections.Reply{}}
+	directReply := collections.Post{Reply: &collections.Reply{RootURI: rootURI, ParentURI: rootURI}}
+	nestedReply := collections.Post{Reply: &collections.Reply{RootURI: rootURI, ParentURI: replyURI}}
+
+	tests := []struct {
+		name        string
+		replyPolicy string
+		post        collections.Post
+		users       generator.Users
+		want        bool
+	}{
+		{name: "any top-level", replyPolicy: "any", post: topLevel, want: true},
+		{name: "any nested reply", replyPolicy: "any", post: nestedReply, want: true},
+		{name: "none top-level", replyPolicy: "none", post: topLevel, want: true},
+		{name: "none direct reply", replyPolicy: "none", post: directReply, want: false},
+		{name: "root direct reply", replyPolicy: "root", post: directReply, want: true},
+		{name: "root nested reply", replyPolicy: "root", post: nestedReply, want: false},
+		{name: "allowed author without match", replyPolicy: "any", post: topLevel, users: generator.Users{testAuthor: true}, want: true},
+		{name: "denied author", replyPolicy: "any", post: collections.Post{Langs: []string{"az"}}, users: generator.Users{testAuthor: false}, want: false},
+		{name: "allowed author rejected by reply policy", replyPolicy: "none", post: directReply, users: generator.Users{testAuthor: true}, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			feed, err := Parse([]byte(`{"name": "test", "reply_policy": "` + test.replyPolicy + `", "match": {"langs_any": ["az"]}}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.post.DID = testAuthor
+			if test.post.Langs == nil && test.users == nil {
+				test.post.Langs = []string{"az"}
+			}
+
+			if got := feed.MatchUsers(&test.post, test.users); got != test.want {
+				t.Errorf("MatchUsers = %v, want %v", got, test.want)
+			}
+			if got := feed.ExplainUsers(&test.post, test.users).Selected; got != test.want {
+				t.Errorf("ExplainUsers selected = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExplainUsers(t *testing.T) {
+	type step struct {
+		rule   string
+		passed bool
+		detail string // Substring of the detail
+	}
+
+	tests := []struct {
+		name      string
+		match     string
+		post      collections.Post
+		users     generator.Users
+		wantSteps []step
+	}{
+		{
+			name:  "denied author",
+			match: `{"langs_any": ["az"]}`,
+			post:  collections.Post{Langs: []string{"az"}},
+			users: generator.Users{testAuthor: false},
+			wantSteps: []step{
+				{rule: "reply_policy", passed: true, detail: "top-level post"},
+				{rule: "authors", passed: false, detail: "is denied"},
+			},
+		},
+		{
+			// Every condition is evaluated, not only the deciding one
+			name:  "any",
+			match: `{"any": [{"langs_any": ["az"]}, {"keywords_any": ["baki"]}]}`,
+			post:  collections.Post{Langs: []string{"az"}, Text: "Bakıda"},
+			wantSteps: []step{
+				{rule: "reply_policy", passed: true},
+				{rule: "authors", passed: true, detail: "is not listed"},
+				{rule: "match.any", passed: true, detail: "2 of 2 conditions match"},
+				{rule: "match.any[0].langs_any", passed: true, detail: "post languages [az]"},
+				{rule: "match.any[1].keywords_any", passed: true, detail: `normalized word "bakida" starts with keyword "baki"`},
+			},
+		},
+		{
+			// The step of the condition with several fields is merged into the not step
+			name:  "not of several fields",
+			match: `{"not": {"detected_langs_any": ["tr"], "detected_lang_confidence_min": 0.9}}`,
+			post:  collections.Post{DetectedLang: "tr", DetectedLangConfidence: 0.5},
+			wantSteps: []step{
+				{rule: "reply_policy", passed: true},
+				{rule: "authors", passed: true},
+				{rule: "match.not", passed: true, detail: "the condition doesn't match (1 of 2 conditions match)"},
+				{rule: "match.not.detected_langs_any", passed: true, detail: "tr (confidence 0.50)"},
+				{rule: "match.not.detected_lang_confidence_min", passed: false, detail: "expected confidence at least 0.90"},
+			},
+		},
+		{
+			name:  "not of one field",
+			match: `{"not": {"hashtags_any": ["spam"]}}`,
+			post:  collections.Post{Tags: []string{"spam"}},
+			wantSteps: []step{
+				{rule: "reply_policy", passed: true},
+				{rule: "authors", passed: true},
+				{rule: "match.not", passed: false, detail: "the condition matches"},
+				{rule: "match.not.hashtags_any", passed: true, detail: "post hashtags [spam]"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			feed := parseMatch(t, test.match)
+			test.post.DID = testAuthor
+			explanation := feed.ExplainUsers(&test.post, test.users)
+
+			if len(explanation.Steps) != len(test.wantSteps) {
+				for _, got := range explanation.Steps {
+					t.Logf("%s %v %s", got.Rule, got.Passed, got.Detail)
+				}
+				t.Fatalf("%d steps, want %d", len(explanation.Steps), len(test.wantSteps))
+			}
+			for i, want := range test.wantSteps {
+				got := explanation.Steps[i]
+				if got.Rule != want.rule || got.Passed != want.passed || !strings.Contains(got.Detail, want.detail) {
+					t.Errorf("step %d = %s %v %q, want %s %v %q", i, got.Rule, got.Passed, got.Detail, want.rule, want.passed, want.detail)
+				}
+			}
+		})
+	}
+}
+
+func TestPostHashtags(t *testing.T) {
+	tags := make([]string, 1, 4)
+	tags[0] = "self"
+
+	tests := []struct {
+		name string
+		post *collections.Post
+		want []string
+	}{
+		{name: "without facets", post: &collections.Post{Tags: tags}, want: []string{"self"}},
+		{name: "without tags", post: &collections.Post{Facets: &collections.Facets{Tags: []string{"inline"}}}, want: []string{"inline"}},
+		{name: "tags and facets", post: &collections.Post{Tags: tags, Facets: &collections.Facets{Tags: []string{"inline", "other"}}}, want: []string{"self", "inline", "other"}},
+		{name: "empty", post: &collections.Post{}, want: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := postHashtags(test.post); !slices.Equal(got, test.want) {
+				t.Errorf("postHashtags = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	// The facet tags are not appended into the spare capacity of the post's tags
+	if spare := tags[:cap(tags)][1:]; slices.ContainsFunc(spare, func(tag string) bool { return tag != "" }) {
+		t.Errorf("postHashtags wrote %v into the post's tags", spare)
+	}
+}
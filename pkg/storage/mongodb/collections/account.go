@@ -0,0 +1,105 @@
+package collections
+
+import (
+	"context"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AccountCollection struct {
+	Collection *mongo.Collection
+}
+
+func NewAccountCollection(client *mongo.Client) (*AccountCollection, error) {
+	coll := client.Database(config.MongoDBBaseDB).Collection("account")
+	_, err := coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "updated_at", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "active", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccountCollection{Collection: coll}, nil
+}
+
+// Account is the hosting status of an account, as reported by #account and #identity firehose events.
+type Account struct {
+	ID        string    `bson:"_id"` // DID
+	Active    bool      `bson:"active"`
+	Status    string    `bson:"status,omitempty"` // Reason of inactivity: takendown, suspended, deleted, deactivated...
+	Handle    string    `bson:"handle,omitempty"`
+	Sequence  int64     `bson:"sequence"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+func (a Account) IsDeleted() bool {
+	return !a.Active && a.Status == "deleted"
+}
+
+// UpsertStatus stores the status of the given accounts, keeping their known handles.
+func (a AccountCollection) UpsertStatus(ctx context.Context, accounts ...*Account) error {
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(accounts))
+	for _, account := range accounts {
+		models = append(
+			models,
+			mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": account.ID}).
+				SetUpdate(bson.M{"$set": bson.M{
+					"active":     account.Active,
+					"status":     account.Status,
+					"sequence":   account.Sequence,
+					"updated_at": account.UpdatedAt,
+				}}).
+				SetUpsert(true),
+		)
+	}
+
+	_, err := a.Collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// UpdateHandles updates the handles of already known accounts. Unknown accounts are ignored.
+func (a AccountCollection) UpdateHandles(ctx context.Context, handles map[string]string) error {
+	if len(handles) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(handles))
+	for did, handle := range handles {
+		models = append(
+			models,
+			mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": did}).
+				SetUpdate(bson.M{"$set": bson.M{"handle": handle}}),
+		)
+	}
+
+	_, err := a.Collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// CutoffByDate deletes accounts whose status hasn't changed since the given time.
+func (a AccountCollection) CutoffByDate(ctx context.Context, before time.Time) (int64, error) {
+	result, err := a.Collection.DeleteMany(ctx, bson.M{"updated_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,112 @@
+package collections
+
+import (
+	"context"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type BlockCollection struct {
+	Collection *mongo.Collection
+}
+
+func NewBlockCollection(client *mongo.Client) (*BlockCollection, error) {
+	coll := client.Database(config.MongoDBBaseDB).Collection("block")
+	_, err := coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "did", Value: 1}, {Key: "subject", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "subject", Value: 1}, {Key: "did", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlockCollection{Collection: coll}, nil
+}
+
+// Block is an app.bsky.graph.block record: DID blocks Subject.
+// The ID has the "did/rkey" format.
+type Block struct {
+	ID        string    `bson:"_id"`
+	DID       string    `bson:"did"`
+	Subject   string    `bson:"subject"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// Insert stores the blocks, replacing already stored blocks with the same ID.
+func (b BlockCollection) Insert(ctx context.Context, blocks ...*Block) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, len(blocks))
+	for i, block := range blocks {
+		models[i] = mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": block.ID}).
+			SetReplacement(block).
+			SetUpsert(true)
+	}
+
+	_, err := b.Collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (b BlockCollection) DeleteByIDs(ctx context.Context, ids ...string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result, err := b.Collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// GetBlockedOrBlocking returns the DIDs among dids that the viewer blocks or that block the viewer.
+func (b BlockCollection) GetBlockedOrBlocking(ctx context.Context, viewerDID string, dids ...string) (map[string]bool, error) {
+	if len(dids) == 0 {
+		return map[string]bool{}, nil
+	}
+
+	cursor, err := b.Collection.Find(
+		ctx,
+		bson.M{
+			"$or": bson.A{
+				bson.M{"did": viewerDID, "subject": bson.M{"$in": dids}},
+				bson.M{"subject": viewerDID, "did": bson.M{"$in": dids}},
+			},
+		},
+		options.Find().SetProjection(bson.M{"did": 1, "subject": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	blockedDIDs := make(map[string]bool)
+	for cursor.Next(ctx) {
+		var block Block
+		if err := cursor.Decode(&block); err != nil {
+			return nil, err
+		}
+		if block.DID == viewerDID {
+			blockedDIDs[block.Subject] = true
+		} else {
+			blockedDIDs[block.DID] = true
+		}
+	}
+
+	return blockedDIDs, cursor.Err()
+}
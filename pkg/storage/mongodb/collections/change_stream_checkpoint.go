@@ -0,0 +1,53 @@
+package collections
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ChangeStreamCheckpointCollection struct {
+	Collection *mongo.Collection
+}
+
+func NewChangeStreamCheckpointCollection(client *mongo.Client) (*ChangeStreamCheckpointCollection, error) {
+	coll := client.Database(config.MongoDBBaseDB).Collection("change_stream_checkpoint")
+	return &ChangeStreamCheckpointCollection{Collection: coll}, nil
+}
+
+// ChangeStreamCheckpoint is the resume token of the last fully processed event of a change stream.
+// The ID is the name of the stream's reader, e.g. feedgen.
+type ChangeStreamCheckpoint struct {
+	ID          string    `bson:"_id"`
+	ResumeToken bson.Raw  `bson:"resume_token"`
+	UpdatedAt   time.Time `bson:"updated_at"`
+}
+
+// GetResumeToken returns the stored resume token of the given stream, or nil if there is no checkpoint.
+func (c ChangeStreamCheckpointCollection) GetResumeToken(ctx context.Context, id string) (bson.Raw, error) {
+	var checkpoint ChangeStreamCheckpoint
+	err := c.Collection.FindOne(ctx, bson.M{"_id": id}).Decode(&checkpoint)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return checkpoint.ResumeToken, nil
+}
+
+func (c ChangeStreamCheckpointCollection) Save(ctx context.Context, id string, resumeToken bson.Raw) error {
+	_, err := c.Collection.ReplaceOne(
+		ctx,
+		bson.M{"_id": id},
+		&ChangeStreamCheckpoint{ID: id, ResumeToken: resumeToken, UpdatedAt: time.Now().UTC()},
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
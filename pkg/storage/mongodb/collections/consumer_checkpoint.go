@@ -0,0 +1,80 @@
+package collections
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ConsumerCheckpointCollection struct {
+	Collection *mongo.Collection
+}
+
+func NewConsumerCheckpointCollection(client *mongo.Client) (*ConsumerCheckpointCollection, error) {
+	coll := client.Database(config.MongoDBBaseDB).Collection("consumer_checkpoint")
+	return &ConsumerCheckpointCollection{Collection: coll}, nil
+}
+
+// ConsumerCheckpoint is the last fully processed cursor of a consumer source.
+// The ID is the source host, since cursors are not portable between hosts.
+type ConsumerCheckpoint struct {
+	ID        string    `bson:"_id"`
+	Cursor    int64     `bson:"cursor"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// GetCursor returns the checkpointed cursor of the given source host, or nil if there is no checkpoint.
+func (c ConsumerCheckpointCollection) GetCursor(ctx context.Context, host string) (*int64, error) {
+	var checkpoint ConsumerCheckpoint
+	err := c.Collection.FindOne(ctx, bson.M{"_id": host}).Decode(&checkpoint)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &checkpoint.Cursor, nil
+}
+
+func (c ConsumerCheckpointCollection) GetAll(ctx context.Context) ([]*ConsumerCheckpoint, error) {
+	cursor, err := c.Collection.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var checkpoints []*ConsumerCheckpoint
+	if err = cursor.All(ctx, &checkpoints); err != nil {
+		return nil, err
+	}
+
+	return checkpoints, nil
+}
+
+// Save stores the cursor of every given source host.
+func (c ConsumerCheckpointCollection) Save(ctx context.Context, cursors map[string]int64) error {
+	if len(cursors) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	models := make([]mongo.WriteModel, 0, len(cursors))
+	for host, cursor := range cursors {
+		models = append(
+			models,
+			mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": host}).
+				SetReplacement(&ConsumerCheckpoint{ID: host, Cursor: cursor, UpdatedAt: now}).
+				SetUpsert(true),
+		)
+	}
+
+	_, err := c.Collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
@@ -0,0 +1,108 @@
+package collections
+
+import (
+	"context"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DuplicateClusterCollection struct {
+	Collection *mongo.Collection
+}
+
+func NewDuplicateClusterCollection(client *mongo.Client) (*DuplicateClusterCollection, error) {
+	coll := client.Database(config.MongoDBBaseDB).Collection("duplicate_cluster")
+	_, err := coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "feed", Value: 1}, {Key: "last_seen_at", Value: -1}},
+			},
+			{
+				Keys: bson.D{{Key: "updated_at", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DuplicateClusterCollection{Collection: coll}, nil
+}
+
+// DuplicateCluster is a flagged group of near-identical posts of different authors in a feed.
+// The ID has the "feed/did/rkey" format, with the ID of the first post of the cluster.
+type DuplicateCluster struct {
+	ID           string    `bson:"_id"`
+	Feed         string    `bson:"feed"` // Record key of the feed, e.g. AzPulse
+	Generator    string    `bson:"generator"`
+	Action       string    `bson:"action"`      // Duplicate action of the feed when the cluster was stored
+	Fingerprint  string    `bson:"fingerprint"` // Hex SimHash of the first post
+	SampleText   string    `bson:"sample_text"`
+	PostCount    int       `bson:"post_count"`
+	AuthorCount  int       `bson:"author_count"`
+	DroppedCount int       `bson:"dropped_count"` // Posts of the cluster that aren't in the feed
+	PostIDs      []string  `bson:"post_ids"`      // First post IDs of the cluster
+	DIDs         []string  `bson:"dids"`          // First authors of the cluster
+	FirstSeenAt  time.Time `bson:"first_seen_at"`
+	LastSeenAt   time.Time `bson:"last_seen_at"`
+	UpdatedAt    time.Time `bson:"updated_at"`
+}
+
+func DuplicateClusterID(feed string, postID string) string {
+	return feed + "/" + postID
+}
+
+// Upsert stores the clusters, replacing their previous versions.
+func (d DuplicateClusterCollection) Upsert(ctx context.Context, clusters ...*DuplicateCluster) error {
+	if len(clusters) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, len(clusters))
+	for i, cluster := range clusters {
+		models[i] = mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": cluster.ID}).
+			SetReplacement(cluster).
+			SetUpsert(true)
+	}
+
+	_, err := d.Collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// GetLatest returns the clusters of the feed, the most recently seen first.
+func (d DuplicateClusterCollection) GetLatest(ctx context.Context, feed string, limit int64) ([]*DuplicateCluster, error) {
+	cursor, err := d.Collection.Find(
+		ctx,
+		bson.M{"feed": feed},
+		options.Find().
+			SetSort(bson.D{{Key: "last_seen_at", Value: -1}}).
+			SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var clusters []*DuplicateCluster
+	if err = cursor.All(ctx, &clusters); err != nil {
+		return nil, err
+	}
+
+	return clusters, nil
+}
+
+// CutoffByDate deletes the clusters last updated before the given time.
+func (d DuplicateClusterCollection) CutoffByDate(ctx context.Context, before time.Time) (int64, error) {
+	result, err := d.Collection.DeleteMany(ctx, bson.M{"updated_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
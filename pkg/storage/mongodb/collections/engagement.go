@@ -0,0 +1,160 @@
+package collections
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EngagementBucketSize is the time span covered by a single engagement bucket.
+const EngagementBucketSize = time.Hour
+
+type EngagementCollection struct {
+	Collection *mongo.Collection
+}
+
+func NewEngagementCollection(client *mongo.Client) (*EngagementCollection, error) {
+	coll := client.Database(config.MongoDBBaseDB).Collection("engagement")
+	_, err := coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "post_created_at", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EngagementCollection{Collection: coll}, nil
+}
+
+// Engagement holds the like, repost and reply counters of a post.
+// The ID has the same "did/rkey" format as Post.ID.
+type Engagement struct {
+	ID               string    `bson:"_id"`
+	PostCreatedAt    time.Time `bson:"post_created_at"`
+	EngagementCounts `bson:",inline"`
+	// Buckets are keyed by the unix timestamp (seconds) of the bucket start,
+	// see EngagementBucketSize.
+	Buckets   map[string]*EngagementCounts `bson:"buckets"`
+	UpdatedAt time.Time                    `bson:"updated_at"`
+}
+
+type EngagementCounts struct {
+	Likes   int64 `bson:"likes"`
+	Reposts int64 `bson:"reposts"`
+	Replies int64 `bson:"replies"`
+}
+
+func (c EngagementCounts) IsZero() bool {
+	return c.Likes == 0 && c.Reposts == 0 && c.Replies == 0
+}
+
+// EngagementDelta is a change of the counters of a post within a single bucket.
+type EngagementDelta struct {
+	PostID        string
+	PostCreatedAt time.Time
+	Bucket        time.Time
+	EngagementCounts
+}
+
+// EngagementBucket returns the start of the bucket that t falls into.
+func EngagementBucket(t time.Time) time.Time {
+	return t.UTC().Truncate(EngagementBucketSize)
+}
+
+// Increment applies the given deltas to the total and bucket counters.
+// Engagement documents are only created by deltas with a positive counter,
+// so a late decrement never resurrects the counters of a pruned post.
+func (e EngagementCollection) Increment(ctx context.Context, deltas ...*EngagementDelta) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	models := make([]mongo.WriteModel, 0, len(deltas))
+	for _, delta := range deltas {
+		if delta.IsZero() {
+			continue
+		}
+
+		bucketKey := "buckets." + strconv.FormatInt(EngagementBucket(delta.Bucket).Unix(), 10)
+		models = append(
+			models,
+			mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": delta.PostID}).
+				SetUpdate(bson.M{
+					"$inc": bson.M{
+						"likes":                delta.Likes,
+						"reposts":              delta.Reposts,
+						"replies":              delta.Replies,
+						bucketKey + ".likes":   delta.Likes,
+						bucketKey + ".reposts": delta.Reposts,
+						bucketKey + ".replies": delta.Replies,
+					},
+					"$set":         bson.M{"updated_at": now},
+					"$setOnInsert": bson.M{"post_created_at": delta.PostCreatedAt},
+				}).
+				SetUpsert(delta.Likes > 0 || delta.Reposts > 0 || delta.Replies > 0),
+		)
+	}
+	if len(models) == 0 {
+		return nil
+	}
+
+	_, err := e.Collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (e EngagementCollection) GetByIDs(ctx context.Context, ids ...string) (map[string]*Engagement, error) {
+	engagements := make(map[string]*Engagement)
+	if len(ids) == 0 {
+		return engagements, nil
+	}
+
+	cursor, err := e.Collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	for cursor.Next(ctx) {
+		var engagement Engagement
+		if err := cursor.Decode(&engagement); err != nil {
+			return nil, err
+		}
+		engagements[engagement.ID] = &engagement
+	}
+
+	return engagements, cursor.Err()
+}
+
+func (e EngagementCollection) DeleteByIDs(ctx context.Context, ids ...string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result, err := e.Collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// CutoffByDate deletes the counters of posts created before the given time.
+func (e EngagementCollection) CutoffByDate(ctx context.Context, before time.Time) (int64, error) {
+	result, err := e.Collection.DeleteMany(ctx, bson.M{"post_created_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,116 @@
+package collections
+
+import (
+	"context"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type EngagementRecordCollection struct {
+	Collection *mongo.Collection
+}
+
+func NewEngagementRecordCollection(client *mongo.Client) (*EngagementRecordCollection, error) {
+	coll := client.Database(config.MongoDBBaseDB).Collection("engagement_record")
+	_, err := coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "created_at", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EngagementRecordCollection{Collection: coll}, nil
+}
+
+// EngagementRecord is a like, repost or reply counted in the engagement of a stored post.
+// Delete events only carry the record path, so the record is kept to know which counters to decrement.
+// The ID has the "did/collection/rkey" format.
+type EngagementRecord struct {
+	ID         string    `bson:"_id"`
+	Collection string    `bson:"collection"` // app.bsky.feed.like, app.bsky.feed.repost or app.bsky.feed.post (reply)
+	SubjectID  string    `bson:"subject_id"` // Post.ID of the liked, reposted or replied post
+	Bucket     time.Time `bson:"bucket"`     // Engagement bucket the record was counted in
+	CreatedAt  time.Time `bson:"created_at"`
+}
+
+// InsertNew inserts the records that don't exist yet and returns them.
+// Already existing records are left untouched, so replayed events are not counted twice.
+func (e EngagementRecordCollection) InsertNew(ctx context.Context, records ...*EngagementRecord) ([]*EngagementRecord, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(records))
+	for _, record := range records {
+		models = append(
+			models,
+			mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": record.ID}).
+				SetUpdate(bson.M{"$setOnInsert": record}).
+				SetUpsert(true),
+		)
+	}
+
+	result, err := e.Collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return nil, err
+	}
+
+	inserted := make([]*EngagementRecord, 0, len(result.UpsertedIDs))
+	for index := range result.UpsertedIDs {
+		inserted = append(inserted, records[index])
+	}
+
+	return inserted, nil
+}
+
+func (e EngagementRecordCollection) GetByIDs(ctx context.Context, ids ...string) ([]*EngagementRecord, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	cursor, err := e.Collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var records []*EngagementRecord
+	if err = cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (e EngagementRecordCollection) DeleteByIDs(ctx context.Context, ids ...string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result, err := e.Collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// CutoffByDate deletes records created before the given time.
+func (e EngagementRecordCollection) CutoffByDate(ctx context.Context, before time.Time) (int64, error) {
+	result, err := e.Collection.DeleteMany(ctx, bson.M{"created_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
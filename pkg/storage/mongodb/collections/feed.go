@@ -0,0 +1,400 @@
+package collections
+
+import (
+	"context"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FeedCollection holds the posts selected by a feed generator, one collection per generator.
+type FeedCollection struct {
+	Collection *mongo.Collection
+}
+
+// FeedCollectionName returns the name of the collection of the given generator, e.g. feed_az.
+func FeedCollectionName(generatorName string) string {
+	return "feed_" + generatorName
+}
+
+func NewFeedCollection(client *mongo.Client, generatorName string) (*FeedCollection, error) {
+	coll := client.Database(config.MongoDBBaseDB).Collection(FeedCollectionName(generatorName))
+
+	_, err := coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "sequence", Value: -1}},
+			},
+			{
+				// Keyset pagination of the feed, see GetBeforeKey
+				Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+			},
+			{
+				Keys: bson.D{{Key: "did", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FeedCollection{Collection: coll}, nil
+}
+
+type FeedItem struct {
+	ID        string    `bson:"_id"`
+	Sequence  int64     `bson:"sequence"`
+	DID       string    `bson:"did"`
+	RecordKey string    `bson:"record_key"`
+	CreatedAt time.Time `bson:"created_at"`
+	Reply     bool      `bson:"reply,omitempty"`
+	Hidden    bool      `bson:"hidden,omitempty"` // The author's account is inactive
+}
+
+// NewFeedItem returns the feed item of the post.
+func NewFeedItem(post *Post) *FeedItem {
+	return &FeedItem{
+		ID:        post.ID,
+		Sequence:  post.Sequence,
+		DID:       post.DID,
+		RecordKey: post.RecordKey,
+		CreatedAt: post.CreatedAt,
+		Reply:     post.IsReply(),
+		Hidden:    post.Hidden,
+	}
+}
+
+// FeedKey is the position of a document in the reverse chronological order of a feed,
+// by creation time and then by ID.
+type FeedKey struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+func (f FeedCollection) GetByCreatedAt(ctx context.Context, skip int64, limit int64) ([]*FeedItem, error) {
+	cursor, err := f.Collection.Find(
+		ctx, bson.M{"hidden": bson.M{"$ne": true}},
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetSkip(skip).
+			SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var feedItems []*FeedItem
+	if err = cursor.All(ctx, &feedItems); err != nil {
+		return nil, err
+	}
+
+	return feedItems, nil
+}
+
+// GetBeforeKey returns the visible documents after the given position in reverse chronological order,
+// starting from the newest document if before is nil. Unlike skipping, documents inserted after a page
+// was read don't shift the next page.
+func (f FeedCollection) GetBeforeKey(ctx context.Context, before *FeedKey, limit int64) ([]*FeedItem, error) {
+	filter := bson.M{"hidden": bson.M{"$ne": true}}
+	if before != nil {
+		filter["$or"] = bson.A{
+			bson.M{"created_at": bson.M{"$lt": before.CreatedAt}},
+			bson.M{"created_at": before.CreatedAt, "_id": bson.M{"$lt": before.ID}},
+		}
+	}
+
+	cursor, err := f.Collection.Find(
+		ctx, filter,
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var feedItems []*FeedItem
+	if err = cursor.All(ctx, &feedItems); err != nil {
+		return nil, err
+	}
+
+	return feedItems, nil
+}
+
+func (f FeedCollection) GetMaxSequence(ctx context.Context) (*int64, error) {
+	pipeline := mongo.Pipeline{
+		{
+			{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: nil},
+				{Key: "maxSequence", Value: bson.D{
+					{Key: "$max", Value: "$sequence"},
+				},
+				},
+			},
+			},
+		},
+	}
+
+	cursor, err := f.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var result struct {
+		MaxSequence int64 `bson:"maxSequence"`
+	}
+
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+		return &result.MaxSequence, err
+	}
+
+	return nil, nil
+}
+
+func (f FeedCollection) Insert(ctx context.Context, overwrite bool, feedItems ...*FeedItem) error {
+	switch len(feedItems) {
+	case 0:
+		return nil
+	case 1:
+		if overwrite == false {
+			_, err := f.Collection.InsertOne(ctx, feedItems[0])
+			return err
+		}
+		_, err := f.Collection.ReplaceOne(
+			ctx,
+			bson.M{"_id": feedItems[0].ID},
+			feedItems[0],
+			options.Replace().SetUpsert(true),
+		)
+		return err
+	default:
+		if overwrite == false {
+			documents := make([]any, len(feedItems))
+			for i, feed := range feedItems {
+				documents[i] = feed
+			}
+
+			_, err := f.Collection.InsertMany(ctx, documents)
+			return err
+		}
+		var models []mongo.WriteModel
+
+		for _, feed := range feedItems {
+			filter := bson.M{"_id": feed.ID}
+			model := mongo.NewReplaceOneModel().
+				SetFilter(filter).
+				SetReplacement(feed).
+				SetUpsert(true)
+			models = append(models, model)
+		}
+
+		opts := options.BulkWrite().SetOrdered(false)
+		_, err := f.Collection.BulkWrite(ctx, models, opts)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+}
+
+func (f FeedCollection) CutoffByCount(
+	ctx context.Context,
+	maxDocumentCount int64,
+) (int64, error) {
+	count, err := f.Collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+
+	if count <= maxDocumentCount {
+		return 0, nil
+	}
+
+	deleteCount := count - maxDocumentCount
+
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetLimit(deleteCount).
+		SetProjection(bson.M{"_id": 1})
+
+	cursor, err := f.Collection.Find(ctx, bson.M{}, findOpts)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	// Process documents in batches to avoid potential memory issues
+	const batchSize = 10000
+	var totalDeleted int64 = 0
+
+	for {
+		batch := make([]string, 0, batchSize)
+		batchCount := 0
+
+		for cursor.Next(ctx) && batchCount < batchSize {
+			var doc struct {
+				ID string `bson:"_id"`
+			}
+			if err = cursor.Decode(&doc); err != nil {
+				return totalDeleted, err
+			}
+			batch = append(batch, doc.ID)
+			batchCount++
+		}
+
+		if len(batch) == 0 {
+			break
+		}
+
+		// Delete the batch
+		result, err := f.Collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": batch}})
+		if err != nil {
+			return totalDeleted, err
+		}
+
+		totalDeleted += result.DeletedCount
+
+		if cursor.Err() != nil {
+			return totalDeleted, cursor.Err()
+		}
+
+		// If we didn't fill the batch, we're done
+		if batchCount < batchSize {
+			break
+		}
+	}
+
+	return totalDeleted, nil
+}
+
+func (f FeedCollection) DeleteByIDs(ctx context.Context, ids ...string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result, err := f.Collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (f FeedCollection) DeleteByDIDs(ctx context.Context, dids ...string) (int64, error) {
+	if len(dids) == 0 {
+		return 0, nil
+	}
+
+	result, err := f.Collection.DeleteMany(ctx, bson.M{"did": bson.M{"$in": dids}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// SetHiddenByDIDs hides or restores all documents of the given authors.
+func (f FeedCollection) SetHiddenByDIDs(ctx context.Context, hidden bool, dids ...string) (int64, error) {
+	if len(dids) == 0 {
+		return 0, nil
+	}
+
+	update := bson.M{"$set": bson.M{"hidden": true}}
+	if !hidden {
+		update = bson.M{"$unset": bson.M{"hidden": ""}}
+	}
+
+	result, err := f.Collection.UpdateMany(ctx, bson.M{"did": bson.M{"$in": dids}}, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+// GetCreatedAfter returns the visible documents created after the given time.
+func (f FeedCollection) GetCreatedAfter(ctx context.Context, after time.Time) ([]*FeedItem, error) {
+	cursor, err := f.Collection.Find(
+		ctx, bson.M{"created_at": bson.M{"$gt": after}, "hidden": bson.M{"$ne": true}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var feedItems []*FeedItem
+	if err = cursor.All(ctx, &feedItems); err != nil {
+		return nil, err
+	}
+
+	return feedItems, nil
+}
+
+// GetByDIDsCreatedAfter returns the documents of the given authors created after the given time, including hidden ones.
+func (f FeedCollection) GetByDIDsCreatedAfter(ctx context.Context, after time.Time, dids ...string) ([]*FeedItem, error) {
+	if len(dids) == 0 {
+		return nil, nil
+	}
+
+	cursor, err := f.Collection.Find(
+		ctx, bson.M{"did": bson.M{"$in": dids}, "created_at": bson.M{"$gt": after}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var feedItems []*FeedItem
+	if err = cursor.All(ctx, &feedItems); err != nil {
+		return nil, err
+	}
+
+	return feedItems, nil
+}
+
+// GetIDsByCreatedAt returns the IDs of all documents created in [since, until), including hidden ones.
+// A zero since or until leaves that side of the range open.
+func (f FeedCollection) GetIDsByCreatedAt(ctx context.Context, since time.Time, until time.Time) (map[string]bool, error) {
+	cursor, err := f.Collection.Find(
+		ctx,
+		CreatedAtRangeFilter(since, until),
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	ids := make(map[string]bool)
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID string `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		ids[doc.ID] = true
+	}
+
+	return ids, cursor.Err()
+}
+
+func (f FeedCollection) Exists(ctx context.Context, id string) (bool, error) {
+	count, err := f.Collection.CountDocuments(ctx, bson.M{"_id": id}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,129 @@
+package collections
+
+import (
+	"context"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type FeedAuthorCollection struct {
+	Collection *mongo.Collection
+}
+
+func NewFeedAuthorCollection(client *mongo.Client) (*FeedAuthorCollection, error) {
+	coll := client.Database(config.MongoDBBaseDB).Collection("feed_author")
+	_, err := coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "feed", Value: 1}, {Key: "did", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FeedAuthorCollection{Collection: coll}, nil
+}
+
+// FeedAuthor is an author that is explicitly included in (allowed) or excluded from (denied) a feed.
+// The ID has the "feed/did" format.
+type FeedAuthor struct {
+	ID        string    `bson:"_id"`
+	Feed      string    `bson:"feed"` // Record key of the feed, e.g. AzPulse
+	DID       string    `bson:"did"`
+	Allowed   bool      `bson:"allowed"`
+	Reason    string    `bson:"reason,omitempty"`
+	AddedBy   string    `bson:"added_by,omitempty"`
+	CreatedAt time.Time `bson:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+func FeedAuthorID(feed string, did string) string {
+	return feed + "/" + did
+}
+
+func (f FeedAuthorCollection) GetByFeed(ctx context.Context, feed string) ([]*FeedAuthor, error) {
+	cursor, err := f.Collection.Find(
+		ctx,
+		bson.M{"feed": feed},
+		options.Find().SetSort(bson.D{{Key: "did", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var authors []*FeedAuthor
+	if err = cursor.All(ctx, &authors); err != nil {
+		return nil, err
+	}
+
+	return authors, nil
+}
+
+func (f FeedAuthorCollection) CountByFeed(ctx context.Context, feed string) (int64, error) {
+	return f.Collection.CountDocuments(ctx, bson.M{"feed": feed})
+}
+
+// InsertNew inserts the authors that aren't listed for their feed yet and returns the number of inserted authors.
+// Already listed authors are left untouched.
+func (f FeedAuthorCollection) InsertNew(ctx context.Context, authors ...*FeedAuthor) (int64, error) {
+	if len(authors) == 0 {
+		return 0, nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(authors))
+	for _, author := range authors {
+		models = append(
+			models,
+			mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": author.ID}).
+				SetUpdate(bson.M{"$setOnInsert": author}).
+				SetUpsert(true),
+		)
+	}
+
+	result, err := f.Collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.UpsertedCount, nil
+}
+
+// Upsert stores the author of the feed, keeping the creation time of an already listed author.
+func (f FeedAuthorCollection) Upsert(ctx context.Context, author *FeedAuthor) error {
+	_, err := f.Collection.UpdateOne(
+		ctx,
+		bson.M{"_id": author.ID},
+		bson.M{
+			"$set": bson.M{
+				"feed":       author.Feed,
+				"did":        author.DID,
+				"allowed":    author.Allowed,
+				"reason":     author.Reason,
+				"added_by":   author.AddedBy,
+				"updated_at": author.UpdatedAt,
+			},
+			"$setOnInsert": bson.M{"created_at": author.CreatedAt},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (f FeedAuthorCollection) Delete(ctx context.Context, feed string, did string) (int64, error) {
+	result, err := f.Collection.DeleteOne(ctx, bson.M{"_id": FeedAuthorID(feed, did)})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,223 @@
+package collections
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type FeedModerationCollection struct {
+	Collection *mongo.Collection
+}
+
+func NewFeedModerationCollection(client *mongo.Client) (*FeedModerationCollection, error) {
+	coll := client.Database(config.MongoDBBaseDB).Collection("feed_moderation")
+	_, err := coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "feed", Value: 1}, {Key: "action", Value: 1}, {Key: "created_at", Value: -1}},
+			},
+			{
+				Keys: bson.D{{Key: "post_id", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "did", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FeedModerationCollection{Collection: coll}, nil
+}
+
+// FeedModeration is a post that is removed from or pinned to the top of a feed by an admin.
+// The ID has the "feed/did/rkey" format.
+type FeedModeration struct {
+	ID        string               `bson:"_id"`
+	Feed      string               `bson:"feed"`    // Record key of the feed, e.g. AzPulse
+	PostID    string               `bson:"post_id"` // Post.ID
+	DID       string               `bson:"did"`
+	RecordKey string               `bson:"record_key"`
+	Action    FeedModerationAction `bson:"action"`
+	Reason    string               `bson:"reason,omitempty"`
+	AddedBy   string               `bson:"added_by,omitempty"`
+	CreatedAt time.Time            `bson:"created_at"`
+	Hidden    bool                 `bson:"hidden,omitempty"` // The author's account is inactive
+}
+
+type FeedModerationAction string
+
+const (
+	// FeedModerationActionRemoved removes the post from the feed and keeps the generator from adding it again.
+	FeedModerationActionRemoved FeedModerationAction = "removed"
+	// FeedModerationActionPinned shows the post at the top of the first page of the feed.
+	FeedModerationActionPinned FeedModerationAction = "pinned"
+)
+
+func FeedModerationID(feed string, postID string) string {
+	return feed + "/" + postID
+}
+
+// Upsert stores the moderation of the post, replacing its previous moderation in the same feed.
+func (f FeedModerationCollection) Upsert(ctx context.Context, moderation *FeedModeration) error {
+	_, err := f.Collection.ReplaceOne(
+		ctx,
+		bson.M{"_id": moderation.ID},
+		moderation,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// Delete removes the moderation of the post in the feed, if it has the given action.
+func (f FeedModerationCollection) Delete(
+	ctx context.Context,
+	feed string,
+	postID string,
+	action FeedModerationAction,
+) (int64, error) {
+	result, err := f.Collection.DeleteOne(
+		ctx,
+		bson.M{"_id": FeedModerationID(feed, postID), "action": action},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// Get returns the moderation of the post in the feed, or nil if it isn't moderated.
+func (f FeedModerationCollection) Get(ctx context.Context, feed string, postID string) (*FeedModeration, error) {
+	var moderation FeedModeration
+	err := f.Collection.FindOne(ctx, bson.M{"_id": FeedModerationID(feed, postID)}).Decode(&moderation)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &moderation, nil
+}
+
+// GetByFeed returns the moderations of the feed with the given action, newest first.
+func (f FeedModerationCollection) GetByFeed(
+	ctx context.Context,
+	feed string,
+	action FeedModerationAction,
+) ([]*FeedModeration, error) {
+	cursor, err := f.Collection.Find(
+		ctx,
+		bson.M{"feed": feed, "action": action},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var moderations []*FeedModeration
+	if err = cursor.All(ctx, &moderations); err != nil {
+		return nil, err
+	}
+
+	return moderations, nil
+}
+
+// GetRemovedIDs returns the subset of the given post IDs that are removed from the feed.
+func (f FeedModerationCollection) GetRemovedIDs(ctx context.Context, feed string, ids ...string) (map[string]bool, error) {
+	removedIDs := make(map[string]bool)
+	if len(ids) == 0 {
+		return removedIDs, nil
+	}
+
+	moderationIDs := make([]string, len(ids))
+	for i, id := range ids {
+		moderationIDs[i] = FeedModerationID(feed, id)
+	}
+
+	cursor, err := f.Collection.Find(
+		ctx,
+		bson.M{"_id": bson.M{"$in": moderationIDs}, "action": FeedModerationActionRemoved},
+		options.Find().SetProjection(bson.M{"post_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			PostID string `bson:"post_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		removedIDs[doc.PostID] = true
+	}
+
+	return removedIDs, cursor.Err()
+}
+
+// DeleteByIDs unpins the given posts from every feed. Removals are kept, so the post stays out of
+// the feed if it is restored.
+func (f FeedModerationCollection) DeleteByIDs(ctx context.Context, ids ...string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result, err := f.Collection.DeleteMany(
+		ctx,
+		bson.M{"post_id": bson.M{"$in": ids}, "action": FeedModerationActionPinned},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// DeleteByDIDs unpins all posts of the given authors from every feed. Removals are kept.
+func (f FeedModerationCollection) DeleteByDIDs(ctx context.Context, dids ...string) (int64, error) {
+	if len(dids) == 0 {
+		return 0, nil
+	}
+
+	result, err := f.Collection.DeleteMany(
+		ctx,
+		bson.M{"did": bson.M{"$in": dids}, "action": FeedModerationActionPinned},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// SetHiddenByDIDs hides or restores all moderations of the given authors.
+func (f FeedModerationCollection) SetHiddenByDIDs(ctx context.Context, hidden bool, dids ...string) (int64, error) {
+	if len(dids) == 0 {
+		return 0, nil
+	}
+
+	update := bson.M{"$set": bson.M{"hidden": true}}
+	if !hidden {
+		update = bson.M{"$unset": bson.M{"hidden": ""}}
+	}
+
+	result, err := f.Collection.UpdateMany(ctx, bson.M{"did": bson.M{"$in": dids}}, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
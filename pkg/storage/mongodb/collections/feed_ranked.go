@@ -0,0 +1,163 @@
+package collections
+
+import (
+	"context"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FeedRankedCollection holds the materialized ranking of every feed that isn't served in chronological order.
+type FeedRankedCollection struct {
+	Collection *mongo.Collection
+}
+
+func NewFeedRankedCollection(client *mongo.Client) (*FeedRankedCollection, error) {
+	coll := client.Database(config.MongoDBBaseDB).Collection("feed_ranked")
+	_, err := coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "feed", Value: 1}, {Key: "rank", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "feed", Value: 1}, {Key: "generated_at", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "post_id", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "did", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FeedRankedCollection{Collection: coll}, nil
+}
+
+// FeedRanked is a post at a position of a feed's ranking. The ID has the "feed/did/rkey" format.
+type FeedRanked struct {
+	ID          string    `bson:"_id"`
+	Feed        string    `bson:"feed"`
+	PostID      string    `bson:"post_id"` // Post.ID
+	DID         string    `bson:"did"`
+	RecordKey   string    `bson:"record_key"`
+	CreatedAt   time.Time `bson:"created_at"`
+	Score       float64   `bson:"score"`
+	Rank        int64     `bson:"rank"`
+	GeneratedAt time.Time `bson:"generated_at"`
+	Hidden      bool      `bson:"hidden,omitempty"` // The author's account is inactive
+}
+
+// GetByRank returns the visible ranked posts of the feed in rank order.
+func (f FeedRankedCollection) GetByRank(ctx context.Context, feed string, skip int64, limit int64) ([]*FeedRanked, error) {
+	cursor, err := f.Collection.Find(
+		ctx, bson.M{"feed": feed, "hidden": bson.M{"$ne": true}},
+		options.Find().
+			SetSort(bson.D{{Key: "rank", Value: 1}}).
+			SetSkip(skip).
+			SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var feedRankedItems []*FeedRanked
+	if err = cursor.All(ctx, &feedRankedItems); err != nil {
+		return nil, err
+	}
+
+	return feedRankedItems, nil
+}
+
+// Replace stores a new ranking of the feed and removes the posts of the previous ranking that are not part of it.
+// All items must have the same GeneratedAt.
+func (f FeedRankedCollection) Replace(ctx context.Context, feed string, generatedAt time.Time, items ...*FeedRanked) error {
+	if len(items) > 0 {
+		models := make([]mongo.WriteModel, 0, len(items))
+		for _, item := range items {
+			models = append(
+				models,
+				mongo.NewReplaceOneModel().
+					SetFilter(bson.M{"_id": item.ID}).
+					SetReplacement(item).
+					SetUpsert(true),
+			)
+		}
+
+		_, err := f.Collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := f.Collection.DeleteMany(ctx, bson.M{"feed": feed, "generated_at": bson.M{"$lt": generatedAt}})
+	return err
+}
+
+// DeleteByIDs removes the given posts (Post.ID) from the rankings of all feeds.
+func (f FeedRankedCollection) DeleteByIDs(ctx context.Context, ids ...string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result, err := f.Collection.DeleteMany(ctx, bson.M{"post_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// DeleteByFeedIDs removes the given posts (Post.ID) from the ranking of the feed.
+func (f FeedRankedCollection) DeleteByFeedIDs(ctx context.Context, feed string, ids ...string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result, err := f.Collection.DeleteMany(ctx, bson.M{"feed": feed, "post_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (f FeedRankedCollection) DeleteByDIDs(ctx context.Context, dids ...string) (int64, error) {
+	if len(dids) == 0 {
+		return 0, nil
+	}
+
+	result, err := f.Collection.DeleteMany(ctx, bson.M{"did": bson.M{"$in": dids}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// SetHiddenByDIDs hides or restores all documents of the given authors.
+func (f FeedRankedCollection) SetHiddenByDIDs(ctx context.Context, hidden bool, dids ...string) (int64, error) {
+	if len(dids) == 0 {
+		return 0, nil
+	}
+
+	update := bson.M{"$set": bson.M{"hidden": true}}
+	if !hidden {
+		update = bson.M{"$unset": bson.M{"hidden": ""}}
+	}
+
+	result, err := f.Collection.UpdateMany(ctx, bson.M{"did": bson.M{"$in": dids}}, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
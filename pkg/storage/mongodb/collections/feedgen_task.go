@@ -0,0 +1,152 @@
+package collections
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type FeedgenTaskCollection struct {
+	Collection *mongo.Collection
+}
+
+func NewFeedgenTaskCollection(client *mongo.Client) (*FeedgenTaskCollection, error) {
+	coll := client.Database(config.MongoDBBaseDB).Collection("feedgen_task")
+	_, err := coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "created_at", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FeedgenTaskCollection{Collection: coll}, nil
+}
+
+// FeedgenTask is a generator run or cutoff requested from the API service and executed by the feedgen service.
+type FeedgenTask struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Generator   string             `bson:"generator"`
+	Type        FeedgenTaskType    `bson:"type"`
+	Status      FeedgenTaskStatus  `bson:"status"`
+	Error       string             `bson:"error,omitempty"`
+	RequestedBy string             `bson:"requested_by,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at"`
+	StartedAt   *time.Time         `bson:"started_at,omitempty"`
+	CompletedAt *time.Time         `bson:"completed_at,omitempty"`
+}
+
+type FeedgenTaskType string
+
+const (
+	FeedgenTaskTypeGenerate FeedgenTaskType = "generate"
+	FeedgenTaskTypeCutoff   FeedgenTaskType = "cutoff"
+)
+
+func (t FeedgenTaskType) IsValid() bool {
+	return t == FeedgenTaskTypeGenerate || t == FeedgenTaskTypeCutoff
+}
+
+type FeedgenTaskStatus string
+
+const (
+	FeedgenTaskStatusPending FeedgenTaskStatus = "pending"
+	FeedgenTaskStatusRunning FeedgenTaskStatus = "running"
+	FeedgenTaskStatusDone    FeedgenTaskStatus = "done"
+	FeedgenTaskStatusFailed  FeedgenTaskStatus = "failed"
+)
+
+// Insert stores the task and sets its ID.
+func (f FeedgenTaskCollection) Insert(ctx context.Context, task *FeedgenTask) error {
+	result, err := f.Collection.InsertOne(ctx, task)
+	if err != nil {
+		return err
+	}
+
+	id, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return errors.New("feedgen task ID is not an ObjectID")
+	}
+	task.ID = id
+
+	return nil
+}
+
+// ClaimPending marks the oldest pending task of the given generators as running and returns it.
+// It returns nil if there is no pending task.
+func (f FeedgenTaskCollection) ClaimPending(ctx context.Context, generators ...string) (*FeedgenTask, error) {
+	var task FeedgenTask
+	err := f.Collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"status": FeedgenTaskStatusPending, "generator": bson.M{"$in": generators}},
+		bson.M{"$set": bson.M{"status": FeedgenTaskStatusRunning, "started_at": time.Now()}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "created_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&task)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &task, nil
+}
+
+// Complete marks the task as done, or as failed if taskErr is not nil.
+func (f FeedgenTaskCollection) Complete(ctx context.Context, id primitive.ObjectID, taskErr error) error {
+	update := bson.M{"status": FeedgenTaskStatusDone, "completed_at": time.Now()}
+	if taskErr != nil {
+		update["status"] = FeedgenTaskStatusFailed
+		update["error"] = taskErr.Error()
+	}
+
+	_, err := f.Collection.UpdateByID(ctx, id, bson.M{"$set": update})
+	return err
+}
+
+// GetLatest returns the latest tasks of the generator, newest first.
+func (f FeedgenTaskCollection) GetLatest(ctx context.Context, generator string, limit int64) ([]*FeedgenTask, error) {
+	cursor, err := f.Collection.Find(
+		ctx,
+		bson.M{"generator": generator},
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var tasks []*FeedgenTask
+	if err = cursor.All(ctx, &tasks); err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+// CutoffByDate deletes tasks created before the given time.
+func (f FeedgenTaskCollection) CutoffByDate(ctx context.Context, before time.Time) (int64, error) {
+	result, err := f.Collection.DeleteMany(ctx, bson.M{"created_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
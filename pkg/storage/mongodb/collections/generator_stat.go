@@ -0,0 +1,95 @@
+package collections
+
+import (
+	"context"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type GeneratorStatCollection struct {
+	Collection *mongo.Collection
+}
+
+func NewGeneratorStatCollection(client *mongo.Client) (*GeneratorStatCollection, error) {
+	coll := client.Database(config.MongoDBBaseDB).Collection("generator_stat")
+	_, err := coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "generator", Value: 1}, {Key: "started_at", Value: -1}},
+			},
+			{
+				Keys: bson.D{{Key: "started_at", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GeneratorStatCollection{Collection: coll}, nil
+}
+
+// GeneratorStat is the result of a generation or cutoff run of a generator.
+type GeneratorStat struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Generator string             `bson:"generator"`
+	Type      FeedgenTaskType    `bson:"type"`
+	Trigger   string             `bson:"trigger"` // cron, task or stream
+	StartedAt time.Time          `bson:"started_at"`
+	Duration  time.Duration      `bson:"duration"`
+	Scanned   int64              `bson:"scanned,omitempty"` // Posts evaluated by the generator
+	Count     int64              `bson:"count"`             // Posts inserted into or deleted from the feed
+	Error     string             `bson:"error,omitempty"`
+}
+
+func (g GeneratorStatCollection) Insert(ctx context.Context, stats ...*GeneratorStat) error {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	documents := make([]any, len(stats))
+	for i, stat := range stats {
+		documents[i] = stat
+	}
+
+	_, err := g.Collection.InsertMany(ctx, documents)
+	return err
+}
+
+// GetLatest returns the latest stats of the generator, newest first.
+func (g GeneratorStatCollection) GetLatest(ctx context.Context, generator string, limit int64) ([]*GeneratorStat, error) {
+	cursor, err := g.Collection.Find(
+		ctx,
+		bson.M{"generator": generator},
+		options.Find().
+			SetSort(bson.D{{Key: "started_at", Value: -1}}).
+			SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var stats []*GeneratorStat
+	if err = cursor.All(ctx, &stats); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// CutoffByDate deletes stats of runs started before the given time.
+func (g GeneratorStatCollection) CutoffByDate(ctx context.Context, before time.Time) (int64, error) {
+	result, err := g.Collection.DeleteMany(ctx, bson.M{"started_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
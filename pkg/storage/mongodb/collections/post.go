@@ -26,6 +26,9 @@ func NewPostCollection(client *mongo.Client) (*PostCollection, error) {
 			{
 				Keys: bson.D{{Key: "created_at", Value: 1}},
 			},
+			{
+				Keys: bson.D{{Key: "did", Value: 1}},
+			},
 		},
 	)
 	if err != nil {
@@ -46,6 +49,17 @@ type Post struct {
 	Text      string    `bson:"text"`
 	Facets    *Facets   `bson:"facets"`
 	Reply     *Reply    `bson:"reply"`
+	Embed     *Embed    `bson:"embed,omitempty"`
+	Hidden    bool      `bson:"hidden,omitempty"` // The author's account is inactive
+
+	// Language detected from the text, empty if the text is too short. See the langid package.
+	DetectedLang           string  `bson:"detected_lang,omitempty"`
+	DetectedLangConfidence float64 `bson:"detected_lang_confidence,omitempty"`
+}
+
+// IsReply reports whether the post is a reply. The consumer stores an empty Reply for top-level posts.
+func (p *Post) IsReply() bool {
+	return p.Reply != nil && p.Reply.ParentURI != ""
 }
 
 type Facets struct {
@@ -59,6 +73,35 @@ type Reply struct {
 	ParentURI string `bson:"parent_uri"`
 }
 
+// Embed is the summary of the images, video, link card and quoted record embedded in a post.
+// A record with media embed fills both the media fields and QuoteURI.
+type Embed struct {
+	MediaType  EmbedMediaType `bson:"media_type,omitempty"`
+	ImageCount int            `bson:"image_count,omitempty"`
+	ImageAlts  []string       `bson:"image_alts,omitempty"`
+	VideoAlt   string         `bson:"video_alt,omitempty"`
+	External   *External      `bson:"external,omitempty"`
+	QuoteURI   string         `bson:"quote_uri,omitempty"` // AT URI of the quoted record
+}
+
+type EmbedMediaType string
+
+const (
+	EmbedMediaTypeImages EmbedMediaType = "images"
+	EmbedMediaTypeVideo  EmbedMediaType = "video"
+)
+
+// External is a link card.
+type External struct {
+	URI         string `bson:"uri"`
+	Title       string `bson:"title"`
+	Description string `bson:"description"`
+}
+
+func (e *Embed) HasMedia() bool {
+	return e != nil && e.MediaType != ""
+}
+
 func (p PostCollection) CutoffByCount(
 	ctx context.Context,
 	maxDocumentCount int64,
@@ -209,3 +252,96 @@ func (p PostCollection) Insert(ctx context.Context, overwrite bool, posts ...*Po
 		return nil
 	}
 }
+
+func (p PostCollection) DeleteByIDs(ctx context.Context, ids ...string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result, err := p.Collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (p PostCollection) DeleteByDIDs(ctx context.Context, dids ...string) (int64, error) {
+	if len(dids) == 0 {
+		return 0, nil
+	}
+
+	result, err := p.Collection.DeleteMany(ctx, bson.M{"did": bson.M{"$in": dids}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// SetHiddenByDIDs hides or restores all documents of the given authors.
+func (p PostCollection) SetHiddenByDIDs(ctx context.Context, hidden bool, dids ...string) (int64, error) {
+	if len(dids) == 0 {
+		return 0, nil
+	}
+
+	update := bson.M{"$set": bson.M{"hidden": true}}
+	if !hidden {
+		update = bson.M{"$unset": bson.M{"hidden": ""}}
+	}
+
+	result, err := p.Collection.UpdateMany(ctx, bson.M{"did": bson.M{"$in": dids}}, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+// GetCreatedAtByIDs returns the creation time of the stored posts among the given IDs.
+func (p PostCollection) GetCreatedAtByIDs(ctx context.Context, ids ...string) (map[string]time.Time, error) {
+	createdAts := make(map[string]time.Time)
+	if len(ids) == 0 {
+		return createdAts, nil
+	}
+
+	cursor, err := p.Collection.Find(
+		ctx,
+		bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"_id": 1, "created_at": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID        string    `bson:"_id"`
+			CreatedAt time.Time `bson:"created_at"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		createdAts[doc.ID] = doc.CreatedAt
+	}
+
+	return createdAts, cursor.Err()
+}
+
+// CreatedAtRangeFilter returns the filter of the documents created in [since, until).
+// A zero since or until leaves that side of the range open.
+func CreatedAtRangeFilter(since time.Time, until time.Time) bson.M {
+	createdAt := bson.M{}
+	if !since.IsZero() {
+		createdAt["$gte"] = since
+	}
+	if !until.IsZero() {
+		createdAt["$lt"] = until
+	}
+	if len(createdAt) == 0 {
+		return bson.M{}
+	}
+
+	return bson.M{"created_at": createdAt}
+}
@@ -0,0 +1,102 @@
+package collections
+
+import (
+	"context"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type PostTombstoneCollection struct {
+	Collection *mongo.Collection
+}
+
+func NewPostTombstoneCollection(client *mongo.Client) (*PostTombstoneCollection, error) {
+	coll := client.Database(config.MongoDBBaseDB).Collection("post_tombstone")
+	_, err := coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "deleted_at", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostTombstoneCollection{Collection: coll}, nil
+}
+
+// PostTombstone marks a post that was deleted by its author.
+// The ID has the same "did/rkey" format as Post.ID.
+type PostTombstone struct {
+	ID        string    `bson:"_id"`
+	Sequence  int64     `bson:"sequence"`
+	DID       string    `bson:"did"`
+	RecordKey string    `bson:"record_key"`
+	DeletedAt time.Time `bson:"deleted_at"`
+}
+
+func (p PostTombstoneCollection) Insert(ctx context.Context, tombstones ...*PostTombstone) error {
+	if len(tombstones) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(tombstones))
+	for _, tombstone := range tombstones {
+		models = append(
+			models,
+			mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": tombstone.ID}).
+				SetReplacement(tombstone).
+				SetUpsert(true),
+		)
+	}
+
+	_, err := p.Collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// GetExistingIDs returns the subset of the given post IDs that have a tombstone.
+func (p PostTombstoneCollection) GetExistingIDs(ctx context.Context, ids ...string) (map[string]bool, error) {
+	existingIDs := make(map[string]bool)
+	if len(ids) == 0 {
+		return existingIDs, nil
+	}
+
+	cursor, err := p.Collection.Find(
+		ctx,
+		bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID string `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		existingIDs[doc.ID] = true
+	}
+
+	return existingIDs, cursor.Err()
+}
+
+// CutoffByDate deletes tombstones of posts deleted before the given time.
+func (p PostTombstoneCollection) CutoffByDate(ctx context.Context, before time.Time) (int64, error) {
+	result, err := p.Collection.DeleteMany(ctx, bson.M{"deleted_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
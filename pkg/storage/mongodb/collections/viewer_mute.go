@@ -0,0 +1,134 @@
+package collections
+
+import (
+	"context"
+	"time"
+
+	"github.com/aykhans/bsky-feedgen/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ViewerMuteCollection struct {
+	Collection *mongo.Collection
+}
+
+func NewViewerMuteCollection(client *mongo.Client) (*ViewerMuteCollection, error) {
+	coll := client.Database(config.MongoDBBaseDB).Collection("viewer_mute")
+	_, err := coll.Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{{Key: "viewer", Value: 1}, {Key: "did", Value: 1}},
+			},
+			{
+				Keys: bson.D{{Key: "viewer", Value: 1}, {Key: "list", Value: 1}},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ViewerMuteCollection{Collection: coll}, nil
+}
+
+// ViewerMute is an account on a mute list submitted by a viewer. The posts of muted accounts are
+// not shown to the viewer. The ID has the "viewer/list/did" format.
+type ViewerMute struct {
+	ID        string    `bson:"_id"`
+	Viewer    string    `bson:"viewer"` // DID of the viewer
+	List      string    `bson:"list"`   // Name of the mute list
+	DID       string    `bson:"did"`    // Muted account
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// ViewerMuteList is the summary of a mute list of a viewer.
+type ViewerMuteList struct {
+	Name      string    `bson:"_id"`
+	Count     int64     `bson:"count"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// ReplaceList replaces the accounts of the viewer's mute list. An empty dids deletes the list.
+func (v ViewerMuteCollection) ReplaceList(ctx context.Context, viewer string, list string, dids ...string) error {
+	if _, err := v.Collection.DeleteMany(ctx, bson.M{"viewer": viewer, "list": list}); err != nil {
+		return err
+	}
+	if len(dids) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	documents := make([]any, len(dids))
+	for i, did := range dids {
+		documents[i] = &ViewerMute{
+			ID:        viewer + "/" + list + "/" + did,
+			Viewer:    viewer,
+			List:      list,
+			DID:       did,
+			CreatedAt: now,
+		}
+	}
+
+	_, err := v.Collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	return err
+}
+
+// DeleteList deletes the viewer's mute list and returns the number of deleted accounts.
+func (v ViewerMuteCollection) DeleteList(ctx context.Context, viewer string, list string) (int64, error) {
+	result, err := v.Collection.DeleteMany(ctx, bson.M{"viewer": viewer, "list": list})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// GetLists returns the mute lists of the viewer, sorted by name.
+func (v ViewerMuteCollection) GetLists(ctx context.Context, viewer string) ([]*ViewerMuteList, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"viewer": viewer}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$list"},
+			{Key: "count", Value: bson.M{"$sum": 1}},
+			{Key: "updated_at", Value: bson.M{"$max": "$created_at"}},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+
+	cursor, err := v.Collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	lists := []*ViewerMuteList{}
+	if err = cursor.All(ctx, &lists); err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+// GetMuted returns the DIDs among dids that are on a mute list of the viewer.
+func (v ViewerMuteCollection) GetMuted(ctx context.Context, viewer string, dids ...string) (map[string]bool, error) {
+	if len(dids) == 0 {
+		return map[string]bool{}, nil
+	}
+
+	mutedDIDs, err := v.Collection.Distinct(ctx, "did", bson.M{"viewer": viewer, "did": bson.M{"$in": dids}})
+	if err != nil {
+		return nil, err
+	}
+
+	muted := make(map[string]bool, len(mutedDIDs))
+	for _, did := range mutedDIDs {
+		if didString, ok := did.(string); ok {
+			muted[didString] = true
+		}
+	}
+
+	return muted, nil
+}
@@ -0,0 +1,263 @@
+// Package textnorm normalizes post texts for keyword matching, so the different spellings of a word
+// compare equal: "AZƏRBAYCANDA", "azerbaycanda", "Азәрбајҹанда" and "аzerbaycanda" (with a Cyrillic "а")
+// are all normalized to "azerbaycanda".
+package textnorm
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize returns the text in a form for keyword matching. The steps are:
+//  1. NFKC normalization, which maps compatibility characters like fullwidth and mathematical letters
+//     to their plain forms, and removal of invisible format characters like zero width spaces.
+//  2. Case folding.
+//  3. Homoglyph mapping: the Cyrillic and Greek letters of mostly Latin words are replaced with the
+//     Latin letters they look like, and the Latin letters of mostly Cyrillic words with the Cyrillic
+//     letters they look like.
+//  4. Transliteration of the words written in Cyrillic to the Azerbaijani Latin alphabet.
+//  5. Diacritic folding: letters are reduced to their base ASCII letters, e.g. "ə" to "e" and "ş" to "s".
+//
+// Characters other than letters are kept, so the result can be matched with regular expressions.
+func Normalize(text string) string {
+	text = norm.NFKC.String(text)
+	text = strings.Map(
+		func(r rune) rune {
+			if unicode.Is(unicode.Cf, r) {
+				return -1
+			}
+			return r
+		},
+		text,
+	)
+	text = cases.Fold().String(text)
+
+	var builder strings.Builder
+	builder.Grow(len(text))
+
+	runes := []rune(text)
+	for start := 0; start < len(runes); {
+		if !isWordRune(runes[start]) {
+			builder.WriteRune(runes[start])
+			start++
+			continue
+		}
+
+		end := start + 1
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+		writeWord(&builder, runes[start:end])
+		start = end
+	}
+
+	return foldDiacritics(builder.String())
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.Is(unicode.Mn, r)
+}
+
+// writeWord writes the word with its homoglyphs mapped or its Cyrillic letters transliterated. Mixed words
+// are mapped to their majority script: the Cyrillic and Greek letters of mostly Latin words are replaced with
+// the Latin letters they look like, and the Latin letters of mostly Cyrillic words are replaced with the
+// Cyrillic letters they look like before the word is transliterated.
+func writeWord(builder *strings.Builder, word []rune) {
+	latinCount, cyrillicCount, greekCount := 0, 0, 0
+	for _, r := range word {
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latinCount++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillicCount++
+		case unicode.Is(unicode.Greek, r):
+			greekCount++
+		}
+	}
+
+	switch {
+	case latinCount > 0 && cyrillicCount > latinCount+greekCount:
+		for _, r := range word {
+			if cyrillic, ok := latinToCyrillic[r]; ok {
+				r = cyrillic
+			}
+			writeCyrillicRune(builder, r)
+		}
+	case latinCount > 0 && (cyrillicCount > 0 || greekCount > 0):
+		for _, r := range word {
+			if latin, ok := homoglyphs[r]; ok {
+				r = latin
+			}
+			builder.WriteRune(r)
+		}
+	case cyrillicCount > 0:
+		for _, r := range word {
+			writeCyrillicRune(builder, r)
+		}
+	default:
+		for _, r := range word {
+			builder.WriteRune(r)
+		}
+	}
+}
+
+// writeCyrillicRune writes the transliteration of a Cyrillic letter, or the rune itself if it has none.
+func writeCyrillicRune(builder *strings.Builder, r rune) {
+	if latin, ok := cyrillicToLatin[r]; ok {
+		builder.WriteString(latin)
+	} else {
+		builder.WriteRune(r)
+	}
+}
+
+// foldDiacritics removes the combining marks of the decomposed text and replaces the letters
+// that don't decompose to a base letter.
+func foldDiacritics(text string) string {
+	text = norm.NFD.String(text)
+
+	var builder strings.Builder
+	builder.Grow(len(text))
+	for _, r := range text {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if folded, ok := foldedLetters[r]; ok {
+			builder.WriteString(folded)
+			continue
+		}
+		builder.WriteRune(r)
+	}
+
+	return norm.NFC.String(builder.String())
+}
+
+// foldedLetters are the lowercase letters without a decomposition to a base letter and combining marks.
+var foldedLetters = map[rune]string{
+	'ə': "e",
+	'ı': "i",
+	'ł': "l",
+	'ø': "o",
+	'đ': "d",
+	'ħ': "h",
+	'æ': "ae",
+	'œ': "oe",
+	'þ': "th",
+}
+
+// cyrillicToLatin transliterates the lowercase letters of the Azerbaijani Cyrillic alphabet to the
+// Azerbaijani Latin alphabet. The Russian and Ukrainian letters that aren't in the Azerbaijani alphabet
+// are transliterated to their closest Azerbaijani Latin spelling, so "азербайджан" is "azerbaydjan".
+var cyrillicToLatin = map[rune]string{
+	'а': "a",
+	'б': "b",
+	'в': "v",
+	'г': "q",
+	'ғ': "ğ",
+	'д': "d",
+	'е': "e",
+	'ә': "ə",
+	'ж': "j",
+	'з': "z",
+	'и': "i",
+	'ы': "ı",
+	'ј': "y",
+	'к': "k",
+	'ҝ': "g",
+	'л': "l",
+	'м': "m",
+	'н': "n",
+	'о': "o",
+	'ө': "ö",
+	'п': "p",
+	'р': "r",
+	'с': "s",
+	'т': "t",
+	'у': "u",
+	'ү': "ü",
+	'ф': "f",
+	'х': "x",
+	'һ': "h",
+	'ч': "ç",
+	'ҹ': "c",
+	'ш': "ş",
+	// Russian and Ukrainian letters
+	'й': "y",
+	'ё': "yo",
+	'ю': "yu",
+	'я': "ya",
+	'э': "e",
+	'ц': "ts",
+	'щ': "şç",
+	'ъ': "",
+	'ь': "",
+	'і': "i",
+	'ї': "yi",
+	'є': "ye",
+	'ґ': "g",
+}
+
+// homoglyphs maps the lowercase Cyrillic and Greek letters that look like Latin letters to those letters.
+var homoglyphs = map[rune]rune{
+	// Cyrillic
+	'а': 'a',
+	'в': 'b',
+	'ԁ': 'd',
+	'е': 'e',
+	'ё': 'e',
+	'һ': 'h',
+	'н': 'h',
+	'і': 'i',
+	'ї': 'i',
+	'ј': 'j',
+	'к': 'k',
+	'м': 'm',
+	'о': 'o',
+	'р': 'p',
+	'ԛ': 'q',
+	'г': 'r',
+	'ѕ': 's',
+	'т': 't',
+	'у': 'y',
+	'ү': 'y',
+	'ԝ': 'w',
+	'х': 'x',
+	'с': 'c',
+	'ә': 'ə',
+	// Greek
+	'α': 'a',
+	'β': 'b',
+	'ε': 'e',
+	'η': 'n',
+	'ι': 'i',
+	'κ': 'k',
+	'ν': 'v',
+	'ο': 'o',
+	'ρ': 'p',
+	'τ': 't',
+	'υ': 'u',
+	'χ': 'x',
+	'γ': 'y',
+	'ω': 'w',
+}
+
+// latinToCyrillic maps the lowercase Latin letters that look like Cyrillic letters to those letters.
+// The letters are folded before the mapping, so "h" is mapped to "н", the lookalike of the uppercase "H".
+var latinToCyrillic = map[rune]rune{
+	'a': 'а',
+	'b': 'в',
+	'c': 'с',
+	'e': 'е',
+	'h': 'н',
+	'i': 'і',
+	'j': 'ј',
+	'k': 'к',
+	'm': 'м',
+	'o': 'о',
+	'p': 'р',
+	't': 'т',
+	'x': 'х',
+	'y': 'у',
+}
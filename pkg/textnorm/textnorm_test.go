@@ -0,0 +1,56 @@
+package textnorm
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		// NFKC normalization
+		{name: "fullwidth letters", text: "ＡＺＥＲＢＡＹＣＡＮ", want: "azerbaycan"},
+		{name: "mathematical letters", text: "𝐀𝐳𝐞𝐫𝐛𝐚𝐲𝐜𝐚𝐧", want: "azerbaycan"},
+		{name: "ligature", text: "ﬁle", want: "file"},
+		{name: "zero width space", text: "azər​baycan", want: "azerbaycan"},
+		{name: "soft hyphen", text: "azər­baycan", want: "azerbaycan"},
+
+		// Case folding
+		{name: "uppercase", text: "AZƏRBAYCANDA", want: "azerbaycanda"},
+		{name: "sharp s", text: "STRASSE straße", want: "strasse strasse"},
+		{name: "dotted capital i", text: "İsmayıllı", want: "ismayilli"},
+
+		// Homoglyph mapping
+		{name: "latin word with a cyrillic letter", text: "аzerbaycanda", want: "azerbaycanda"},
+		{name: "latin word with a greek letter", text: "αzerbaycan", want: "azerbaycan"},
+		{name: "latin word with cyrillic letters", text: "аzеrbаycаn", want: "azerbaycan"},
+		{name: "cyrillic word with a latin letter", text: "aзербайджан", want: "azerbaydjan"},
+		{name: "uppercase cyrillic word with latin letters", text: "AЗEРБAЙДЖAH", want: "azerbaydjan"},
+		{name: "cyrillic word with a latin r lookalike", text: "азepбайджан", want: "azerbaydjan"},
+
+		// Transliteration
+		{name: "azerbaijani cyrillic", text: "Азәрбајҹанда", want: "azerbaycanda"},
+		{name: "russian", text: "Азербайджан", want: "azerbaydjan"},
+		{name: "russian soft sign", text: "Гянджа, Шеки и Ленкорань", want: "qyandja, seki i lenkoran"},
+		{name: "ukrainian", text: "Україна", want: "ukrayina"},
+
+		// Diacritic folding
+		{name: "azerbaijani letters", text: "şəki ağac çörək ılıq", want: "seki agac corek iliq"},
+		{name: "turkish letters", text: "Azerbaycan'ın güzelliği", want: "azerbaycan'in guzelligi"},
+		{name: "letters without decomposition", text: "Œuvre łódź", want: "oeuvre lodz"},
+
+		// Other characters
+		{name: "punctuation and digits", text: "Bakı-da, 2024!", want: "baki-da, 2024!"},
+		{name: "hashtag and mention", text: "#Azərbaycan @baki.bsky.social", want: "#azerbaycan @baki.bsky.social"},
+		{name: "greek word", text: "Ελλάδα", want: "ελλαδα"},
+		{name: "empty", text: "", want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Normalize(test.text); got != test.want {
+				t.Errorf("Normalize(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package types
+
+import "fmt"
+
+type AuthMode string
+
+var (
+	// Requests with an invalid service JWT are served anonymously
+	AuthModeLenient AuthMode = "lenient"
+	// Requests with an invalid service JWT are rejected
+	AuthModeStrict AuthMode = "strict"
+)
+
+func (m AuthMode) String() string {
+	return string(m)
+}
+
+func (m AuthMode) IsValid() bool {
+	return m == AuthModeLenient || m == AuthModeStrict
+}
+
+func (m AuthMode) Equal(other AuthMode) bool {
+	return m == other
+}
+
+func (m AuthMode) IsLenient() bool {
+	return m == AuthModeLenient
+}
+
+func (m AuthMode) IsStrict() bool {
+	return m == AuthModeStrict
+}
+
+func (m *AuthMode) Set(value string) error {
+	switch value {
+	case AuthModeLenient.String(), "":
+		*m = AuthModeLenient
+	case AuthModeStrict.String():
+		*m = AuthModeStrict
+	default:
+		return fmt.Errorf("invalid auth mode value: %s", value)
+	}
+
+	return nil
+}
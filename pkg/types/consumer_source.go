@@ -0,0 +1,43 @@
+package types
+
+import "fmt"
+
+type ConsumerSource string
+
+var (
+	ConsumerSourceFirehose  ConsumerSource = "firehose"
+	ConsumerSourceJetstream ConsumerSource = "jetstream"
+)
+
+func (s ConsumerSource) String() string {
+	return string(s)
+}
+
+func (s ConsumerSource) IsValid() bool {
+	return s == ConsumerSourceFirehose || s == ConsumerSourceJetstream
+}
+
+func (s ConsumerSource) Equal(other ConsumerSource) bool {
+	return s == other
+}
+
+func (s ConsumerSource) IsFirehose() bool {
+	return s == ConsumerSourceFirehose
+}
+
+func (s ConsumerSource) IsJetstream() bool {
+	return s == ConsumerSourceJetstream
+}
+
+func (s *ConsumerSource) Set(value string) error {
+	switch value {
+	case ConsumerSourceFirehose.String(), "":
+		*s = ConsumerSourceFirehose
+	case ConsumerSourceJetstream.String():
+		*s = ConsumerSourceJetstream
+	default:
+		return fmt.Errorf("invalid source value: %s", value)
+	}
+
+	return nil
+}
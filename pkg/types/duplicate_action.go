@@ -0,0 +1,57 @@
+package types
+
+import "fmt"
+
+type DuplicateAction string
+
+var (
+	DuplicateActionOff  DuplicateAction = "off"
+	DuplicateActionFlag DuplicateAction = "flag"
+	DuplicateActionDrop DuplicateAction = "drop"
+	DuplicateActionCap  DuplicateAction = "cap"
+)
+
+func (a DuplicateAction) String() string {
+	return string(a)
+}
+
+func (a DuplicateAction) IsValid() bool {
+	return a == DuplicateActionOff || a == DuplicateActionFlag || a == DuplicateActionDrop || a == DuplicateActionCap
+}
+
+func (a DuplicateAction) Equal(other DuplicateAction) bool {
+	return a == other
+}
+
+func (a DuplicateAction) IsOff() bool {
+	return a == DuplicateActionOff
+}
+
+func (a DuplicateAction) IsFlag() bool {
+	return a == DuplicateActionFlag
+}
+
+func (a DuplicateAction) IsDrop() bool {
+	return a == DuplicateActionDrop
+}
+
+func (a DuplicateAction) IsCap() bool {
+	return a == DuplicateActionCap
+}
+
+func (a *DuplicateAction) Set(value string) error {
+	switch value {
+	case DuplicateActionOff.String(), "":
+		*a = DuplicateActionOff
+	case DuplicateActionFlag.String():
+		*a = DuplicateActionFlag
+	case DuplicateActionDrop.String():
+		*a = DuplicateActionDrop
+	case DuplicateActionCap.String():
+		*a = DuplicateActionCap
+	default:
+		return fmt.Errorf("invalid duplicate action value: %s", value)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package types
+
+import "fmt"
+
+type FeedRanking string
+
+var (
+	FeedRankingLatest FeedRanking = "latest"
+	FeedRankingHot    FeedRanking = "hot"
+)
+
+func (r FeedRanking) String() string {
+	return string(r)
+}
+
+func (r FeedRanking) IsValid() bool {
+	return r == FeedRankingLatest || r == FeedRankingHot
+}
+
+func (r FeedRanking) Equal(other FeedRanking) bool {
+	return r == other
+}
+
+func (r FeedRanking) IsLatest() bool {
+	return r == FeedRankingLatest
+}
+
+func (r FeedRanking) IsHot() bool {
+	return r == FeedRankingHot
+}
+
+func (r *FeedRanking) Set(value string) error {
+	switch value {
+	case FeedRankingLatest.String(), "":
+		*r = FeedRankingLatest
+	case FeedRankingHot.String():
+		*r = FeedRankingHot
+	default:
+		return fmt.Errorf("invalid ranking value: %s", value)
+	}
+
+	return nil
+}
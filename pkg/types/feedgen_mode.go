@@ -0,0 +1,43 @@
+package types
+
+import "fmt"
+
+type FeedgenMode string
+
+var (
+	FeedgenModeCron   FeedgenMode = "cron"
+	FeedgenModeStream FeedgenMode = "stream"
+)
+
+func (m FeedgenMode) String() string {
+	return string(m)
+}
+
+func (m FeedgenMode) IsValid() bool {
+	return m == FeedgenModeCron || m == FeedgenModeStream
+}
+
+func (m FeedgenMode) Equal(other FeedgenMode) bool {
+	return m == other
+}
+
+func (m FeedgenMode) IsCron() bool {
+	return m == FeedgenModeCron
+}
+
+func (m FeedgenMode) IsStream() bool {
+	return m == FeedgenModeStream
+}
+
+func (m *FeedgenMode) Set(value string) error {
+	switch value {
+	case FeedgenModeCron.String(), "":
+		*m = FeedgenModeCron
+	case FeedgenModeStream.String():
+		*m = FeedgenModeStream
+	default:
+		return fmt.Errorf("invalid mode value: %s", value)
+	}
+
+	return nil
+}
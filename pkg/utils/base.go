@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/bluesky-social/indigo/atproto/syntax"
 	"github.com/whyrusleeping/go-did"
 )
 
@@ -149,3 +150,31 @@ func ParseString[T any](s string) (T, error) {
 func ToPtr[T any](value T) *T {
 	return &value
 }
+
+// FromPtr returns the value pointed to by ptr, or the zero value of T if ptr is nil.
+func FromPtr[T any](ptr *T) T {
+	if ptr == nil {
+		var zero T
+		return zero
+	}
+
+	return *ptr
+}
+
+// ParsePostURI returns the DID and record key of a post AT URI.
+func ParsePostURI(uri string) (string, string, error) {
+	atURI, err := syntax.ParseATURI(uri)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid post uri: %w", err)
+	}
+	if atURI.Collection() != "app.bsky.feed.post" || atURI.RecordKey() == "" {
+		return "", "", fmt.Errorf("invalid post uri: %s is not a post", uri)
+	}
+
+	did, err := atURI.Authority().AsDID()
+	if err != nil {
+		return "", "", fmt.Errorf("invalid post uri: %w", err)
+	}
+
+	return did.String(), atURI.RecordKey().String(), nil
+}